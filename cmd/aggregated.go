@@ -0,0 +1,253 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	"github.com/rcrozean/kube-stress/pkg/client"
+	"github.com/rcrozean/kube-stress/pkg/util"
+)
+
+type AggregatedConfig struct {
+	apiService      string
+	resource        string
+	namespace       string
+	compareResource string
+	numClients      int
+	qps             float32
+	totalDuration   time.Duration
+}
+
+var (
+	aggregatedConfig *AggregatedConfig
+	aggregatedCmd    *cobra.Command
+)
+
+func init() {
+	aggregatedConfig = &AggregatedConfig{}
+	aggregatedCmd = &cobra.Command{
+		Use:   "aggregated",
+		Short: "List the resources of an aggregated APIService through the kube-aggregator proxy",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := aggregatedCommand(); err != nil {
+				klog.Errorf("Error executing aggregated command: %v", err)
+				os.Exit(1)
+			}
+		},
+	}
+	rootCmd.AddCommand(aggregatedCmd)
+	aggregatedCmd.Flags().StringVar(&aggregatedConfig.apiService, "api-service", "v1beta1.metrics.k8s.io", "Name of the APIService whose resources to list (must be served by an aggregated apiserver)")
+	aggregatedCmd.Flags().StringVar(&aggregatedConfig.resource, "resource", "pods", "Resource of the APIService to list (e.g 'pods' and 'nodes' for metrics.k8s.io)")
+	aggregatedCmd.Flags().StringVar(&aggregatedConfig.namespace, "namespace", "", "Namespace to list the resources in (empty value means all namespaces, and must be empty for cluster-scoped resources)")
+	aggregatedCmd.Flags().StringVar(&aggregatedConfig.compareResource, "compare-resource", "", "Core/v1 resource of similar size to list in the same namespace, alternating with the proxied calls, to isolate the proxy overhead (e.g 'configmaps')")
+	aggregatedCmd.Flags().IntVar(&aggregatedConfig.numClients, "num-clients", 10, "Number of clients to use for spreading the list calls")
+	aggregatedCmd.Flags().Float32Var(&aggregatedConfig.qps, "qps", 10.0, "QPS to generate for the list calls (shared by the proxied and direct calls)")
+	aggregatedCmd.Flags().DurationVar(&aggregatedConfig.totalDuration, "total-duration", 5*time.Minute, "Total duration for which to run this command")
+}
+
+// The fields of an apiregistration.k8s.io/v1 APIService needed to find its resources.
+type apiService struct {
+	Spec struct {
+		Group   string `json:"group"`
+		Version string `json:"version"`
+		Service *struct {
+			Namespace string `json:"namespace"`
+			Name      string `json:"name"`
+		} `json:"service"`
+	} `json:"spec"`
+	Status struct {
+		Conditions []struct {
+			Type    string `json:"type"`
+			Status  string `json:"status"`
+			Message string `json:"message"`
+		} `json:"conditions"`
+	} `json:"status"`
+}
+
+// Latencies and sizes of the calls going one way, proxied or direct.
+type aggregatedPath struct {
+	name      string
+	path      string
+	latencies *util.LatencyTracker
+	total     atomic.Uint64
+	failed    atomic.Uint64
+	bytes     atomic.Uint64
+}
+
+func aggregatedCommand() error {
+	if err := checkQPSPerClient(aggregatedConfig.qps, aggregatedConfig.numClients); err != nil {
+		return err
+	}
+	if err := checkFileDescriptors(aggregatedConfig.numClients); err != nil {
+		return err
+	}
+	clients := client.CreateKubeClients(loadKubeConfig(aggregatedCmd), aggregatedConfig.numClients)
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	proxied, err := aggregatedResourcePath(ctx, clients[0])
+	if err != nil {
+		return err
+	}
+	paths := []*aggregatedPath{{name: "proxied", path: proxied, latencies: util.NewLatencyTracker()}}
+	if aggregatedConfig.compareResource != "" {
+		direct := path.Join("/api/v1", namespacePath(aggregatedConfig.namespace), aggregatedConfig.compareResource)
+		paths = append(paths, &aggregatedPath{name: "direct", path: direct, latencies: util.NewLatencyTracker()})
+	}
+	if err := waitForStart(ctx); err != nil {
+		return err
+	}
+	klog.V(1).Infof("Listing %v using %v clients and QPS = %v for %v",
+		describeAggregatedPaths(paths),
+		aggregatedConfig.numClients,
+		aggregatedConfig.qps,
+		aggregatedConfig.totalDuration)
+	defer reportAggregated(paths)
+	fetchAggregated(ctx, clients, paths)
+	return nil
+}
+
+// Path listing the resource of the APIService, after checking that it's served by an available aggregated apiserver.
+func aggregatedResourcePath(ctx context.Context, c *kubernetes.Clientset) (string, error) {
+	data, err := c.Discovery().RESTClient().Get().
+		AbsPath("/apis/apiregistration.k8s.io/v1/apiservices", aggregatedConfig.apiService).
+		DoRaw(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get APIService '%v': %v", aggregatedConfig.apiService, err)
+	}
+	var service apiService
+	if err := json.Unmarshal(data, &service); err != nil {
+		return "", fmt.Errorf("failed to decode APIService '%v': %v", aggregatedConfig.apiService, err)
+	}
+	if service.Spec.Service == nil {
+		return "", fmt.Errorf("APIService '%v' is served by the kube-apiserver itself, not through the aggregator proxy", aggregatedConfig.apiService)
+	}
+	for _, condition := range service.Status.Conditions {
+		if condition.Type == "Available" && condition.Status != "True" {
+			klog.Warningf("APIService '%v' is not available: %v", aggregatedConfig.apiService, condition.Message)
+		}
+	}
+	groupVersion := service.Spec.Group + "/" + service.Spec.Version
+	resources, err := c.Discovery().ServerResourcesForGroupVersion(groupVersion)
+	if err != nil {
+		return "", fmt.Errorf("failed to discover the resources of %v: %v", groupVersion, err)
+	}
+	for _, resource := range resources.APIResources {
+		if resource.Name != aggregatedConfig.resource {
+			continue
+		}
+		if !resource.Namespaced && aggregatedConfig.namespace != "" {
+			return "", fmt.Errorf("'%v' of %v are cluster-scoped, --namespace must be empty", resource.Name, groupVersion)
+		}
+		klog.Infof("APIService '%v' proxies %v to service %v/%v", aggregatedConfig.apiService, groupVersion,
+			service.Spec.Service.Namespace, service.Spec.Service.Name)
+		return path.Join("/apis", groupVersion, namespacePath(aggregatedConfig.namespace), resource.Name), nil
+	}
+	return "", fmt.Errorf("%v doesn't serve '%v'", groupVersion, aggregatedConfig.resource)
+}
+
+// Path segment scoping a list to a namespace (empty for all namespaces).
+func namespacePath(namespace string) string {
+	if namespace == "" {
+		return ""
+	}
+	return path.Join("namespaces", namespace)
+}
+
+func describeAggregatedPaths(paths []*aggregatedPath) string {
+	if len(paths) == 1 {
+		return paths[0].path
+	}
+	return fmt.Sprintf("%v alternating with %v", paths[0].path, paths[1].path)
+}
+
+// Alternate the proxied and direct calls, so that both see the same load on the server.
+func fetchAggregated(ctx context.Context, clients []*kubernetes.Clientset, paths []*aggregatedPath) {
+	start := time.Now()
+	ticker := time.NewTicker(time.Duration(1000000000.0/aggregatedConfig.qps) * time.Nanosecond)
+	defer ticker.Stop()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for i := 0; time.Since(start) < aggregatedConfig.totalDuration; i++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			client := clients[i%len(clients)]
+			p := paths[i%len(paths)]
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				p.total.Add(1)
+				requestStart := time.Now()
+				size, err := fetchAggregatedList(ctx, client, p.path)
+				if err != nil {
+					p.failed.Add(1)
+					logRequestError("Error seen with %v list call: %v", p.name, err)
+					return
+				}
+				latency := time.Since(requestStart)
+				p.latencies.Record(latency)
+				p.bytes.Add(uint64(size))
+				klog.V(2).Infof("%v list call took: %v (%v bytes)", p.name, latency, size)
+			}()
+		}
+	}
+}
+
+func fetchAggregatedList(ctx context.Context, c *kubernetes.Clientset, path string) (int64, error) {
+	requestCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	rc, err := c.Discovery().RESTClient().Get().AbsPath(path).Stream(requestCtx)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+	return io.Copy(ioutil.Discard, rc)
+}
+
+func reportAggregated(paths []*aggregatedPath) {
+	summaries := make([]util.LatencySummary, len(paths))
+	for i, p := range paths {
+		fc, tc := p.failed.Load(), p.total.Load()
+		summaries[i] = p.latencies.Summary()
+		l := summaries[i]
+		klog.Infof("%d out of %d %v list calls failed, failure rate: %v%%", fc, tc, p.name, float64(fc)/float64(tc)*100)
+		klog.Infof("%v list latency (%v): p50 = %v, p90 = %v, p99 = %v", p.name, p.path, l.P50, l.P90, l.P99)
+		if succeeded := tc - fc; succeeded > 0 {
+			klog.Infof("%v list response size: mean = %v bytes", p.name, p.bytes.Load()/succeeded)
+		}
+	}
+	if len(paths) == 2 && summaries[0].Count > 0 && summaries[1].Count > 0 {
+		proxied, direct := summaries[0], summaries[1]
+		klog.Infof("Proxy overhead (proxied - direct latency): mean = %v, p50 = %v, p90 = %v, p99 = %v",
+			proxied.Mean-direct.Mean, proxied.P50-direct.P50, proxied.P90-direct.P90, proxied.P99-direct.P99)
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	"github.com/rcrozean/kube-stress/pkg/client"
+	"github.com/rcrozean/kube-stress/pkg/util"
+)
+
+type ChurnConfig struct {
+	namespace       string
+	createNamespace bool
+	deleteNamespace bool
+	objectSize      int
+	population      int
+	churnRate       float32
+	fillQPS         float32
+	numClients      int
+	totalDuration   time.Duration
+}
+
+var (
+	churnConfig *ChurnConfig
+	churnCmd    *cobra.Command
+)
+
+func init() {
+	churnConfig = &ChurnConfig{}
+	churnCmd = &cobra.Command{
+		Use:   "churn",
+		Short: "Keep a steady population of objects by continuously creating new ones and deleting the oldest",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := churnCommand(); err != nil {
+				klog.Errorf("Error executing churn command: %v", err)
+				os.Exit(1)
+			}
+		},
+	}
+	rootCmd.AddCommand(churnCmd)
+	churnCmd.Flags().StringVar(&churnConfig.namespace, "namespace", KubeStress, "Namespace where the churned configmaps are created")
+	churnCmd.Flags().BoolVar(&churnConfig.createNamespace, "create-namespace", false, "Create the namespace before churning if it doesn't exist")
+	churnCmd.Flags().BoolVar(&churnConfig.deleteNamespace, "delete-namespace-on-exit", false, "Delete the namespace and all its contents (including the remaining objects) on exit")
+	churnCmd.Flags().IntVar(&churnConfig.objectSize, "object-size-bytes", 1000, "Size of each configmap to be created")
+	churnCmd.Flags().IntVar(&churnConfig.population, "population", 100, "Number of objects kept in the namespace at steady state")
+	churnCmd.Flags().Float32Var(&churnConfig.churnRate, "churn-rate", 10.0, "Number of objects replaced (one created, the oldest deleted) per second")
+	churnCmd.Flags().Float32Var(&churnConfig.fillQPS, "fill-qps", 50.0, "QPS of the create calls filling up the population before churning")
+	churnCmd.Flags().IntVar(&churnConfig.numClients, "num-clients", 10, "Number of clients to use for spreading the create and delete calls")
+	churnCmd.Flags().DurationVar(&churnConfig.totalDuration, "total-duration", 5*time.Minute, "Total duration of the churn, after filling up the population")
+}
+
+func churnCommand() error {
+	if churnConfig.population < 1 {
+		return fmt.Errorf("--population must be at least 1")
+	}
+	if churnConfig.churnRate <= 0 || churnConfig.fillQPS <= 0 {
+		return fmt.Errorf("--churn-rate and --fill-qps must be positive")
+	}
+	if err := checkQPSPerClient(2*churnConfig.churnRate, churnConfig.numClients); err != nil {
+		return err
+	}
+	if err := checkDestructive(destructiveDelete, float64(churnConfig.churnRate), churnConfig.namespace); err != nil {
+		return err
+	}
+	if churnConfig.deleteNamespace {
+		if err := checkDestructive(destructiveDeleteNamespace, 0, churnConfig.namespace); err != nil {
+			return err
+		}
+	}
+	if err := checkFileDescriptors(churnConfig.numClients); err != nil {
+		return err
+	}
+	clients := client.CreateKubeClients(loadKubeConfig(churnCmd), churnConfig.numClients)
+	if churnConfig.createNamespace {
+		if err := ensureNamespace(context.Background(), clients[0], churnConfig.namespace); err != nil {
+			return fmt.Errorf("failed to create namespace: %v", err)
+		}
+	}
+	if churnConfig.deleteNamespace {
+		defer deleteNamespace(context.Background(), clients[0], churnConfig.namespace)
+	}
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	stats := &churnStats{
+		createLatencies: util.NewLatencyTracker(),
+		deleteLatencies: util.NewLatencyTracker(),
+	}
+	klog.V(1).Infof("Filling up a population of %v configmaps in namespace '%v' with QPS = %v",
+		churnConfig.population, churnConfig.namespace, churnConfig.fillQPS)
+	if err := fillPopulation(ctx, clients, stats); err != nil {
+		return err
+	}
+	// Only the calls of the churn itself are reported.
+	stats.createLatencies = util.NewLatencyTracker()
+	stats.createFailures.Store(0)
+	if err := waitForStart(ctx); err != nil {
+		return err
+	}
+	klog.V(1).Infof("Churning the population at %v objects per second using %v clients for %v",
+		churnConfig.churnRate, churnConfig.numClients, churnConfig.totalDuration)
+	churnObjects(ctx, clients, stats)
+	return nil
+}
+
+// Names of the live objects, oldest first, and the counters and latencies of the run.
+type churnStats struct {
+	lock            sync.Mutex
+	names           []string
+	createFailures  atomic.Uint64
+	deleteFailures  atomic.Uint64
+	deleted         atomic.Uint64
+	createLatencies *util.LatencyTracker
+	deleteLatencies *util.LatencyTracker
+}
+
+func (s *churnStats) push(name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.names = append(s.names, name)
+}
+
+// Take out the oldest object, empty if there is none.
+func (s *churnStats) pop() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.names) == 0 {
+		return ""
+	}
+	name := s.names[0]
+	s.names = s.names[1:]
+	return name
+}
+
+func (s *churnStats) size() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.names)
+}
+
+func fillPopulation(ctx context.Context, clients []*kubernetes.Clientset, stats *churnStats) error {
+	ticker := time.NewTicker(time.Duration(1000000000.0/churnConfig.fillQPS) * time.Nanosecond)
+	defer ticker.Stop()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	var issued atomic.Int64
+	for i := 0; stats.size() < churnConfig.population; i++ {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("stopped while filling up the population")
+		case <-ticker.C:
+			// Calls in flight are counted too, so the population isn't overshot.
+			if int(issued.Load()) >= churnConfig.population {
+				continue
+			}
+			issued.Add(1)
+			client := clients[i%len(clients)]
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if !churnCreate(ctx, client, stats) {
+					issued.Add(-1)
+				}
+			}()
+		}
+	}
+	return nil
+}
+
+func churnObjects(ctx context.Context, clients []*kubernetes.Clientset, stats *churnStats) {
+	start := time.Now()
+	ticker := time.NewTicker(time.Duration(1000000000.0/churnConfig.churnRate) * time.Nanosecond)
+	defer ticker.Stop()
+	defer func() {
+		elapsed := time.Since(start)
+		cl, dl := stats.createLatencies.Summary(), stats.deleteLatencies.Summary()
+		klog.Infof("Achieved a churn rate of %.2f objects per second (target %v), %d objects left",
+			float64(stats.deleted.Load())/elapsed.Seconds(), churnConfig.churnRate, stats.size())
+		klog.Infof("Create latency: p50 = %v, p90 = %v, p99 = %v (%d failures)", cl.P50, cl.P90, cl.P99, stats.createFailures.Load())
+		klog.Infof("Delete latency: p50 = %v, p90 = %v, p99 = %v (%d failures)", dl.P50, dl.P90, dl.P99, stats.deleteFailures.Load())
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for i := 0; time.Since(start) < churnConfig.totalDuration; i++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			client := clients[i%len(clients)]
+			oldest := stats.pop()
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				churnCreate(ctx, client, stats)
+			}()
+			go func() {
+				defer wg.Done()
+				if oldest != "" {
+					churnDelete(ctx, client, oldest, stats)
+				}
+			}()
+		}
+	}
+}
+
+// Create a new object, adding it to the population if successful.
+func churnCreate(ctx context.Context, client *kubernetes.Clientset, stats *churnStats) bool {
+	configmap := newConfigMap(churnConfig.objectSize)
+	start := time.Now()
+	if _, err := client.CoreV1().ConfigMaps(churnConfig.namespace).Create(ctx, configmap, metav1.CreateOptions{}); err != nil {
+		stats.createFailures.Add(1)
+		logRequestError("Failed to create object: %v", err)
+		return false
+	}
+	stats.createLatencies.Record(time.Since(start))
+	stats.push(configmap.Name)
+	return true
+}
+
+func churnDelete(ctx context.Context, client *kubernetes.Clientset, name string, stats *churnStats) {
+	start := time.Now()
+	if err := client.CoreV1().ConfigMaps(churnConfig.namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
+		stats.deleteFailures.Add(1)
+		logRequestError("Failed to delete object %v: %v", name, err)
+		return
+	}
+	stats.deleteLatencies.Record(time.Since(start))
+	stats.deleted.Add(1)
+}
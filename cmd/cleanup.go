@@ -0,0 +1,85 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"sort"
+	"sync"
+
+	"k8s.io/klog/v2"
+)
+
+// Phases of the shutdown of a command, run in this order: what serves the run goes away first, then
+// its results are written out, and finally what it set up in the cluster is torn down.
+const (
+	cleanupStopServers = iota
+	cleanupFlushOutputs
+	cleanupTeardown
+)
+
+type cleanupStep struct {
+	phase int
+	name  string
+	fn    func()
+}
+
+// Registry of the cleanup steps of a command, run once by the command on every exit path
+// (errors, being stopped early and normal completion) before it exits.
+type cleanups struct {
+	lock  sync.Mutex
+	steps []cleanupStep
+	done  bool
+}
+
+// Register a step, run in its phase after the steps of the same phase registered before it.
+func (c *cleanups) add(phase int, name string, fn func()) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.steps = append(c.steps, cleanupStep{phase: phase, name: name, fn: fn})
+}
+
+// Run only the steps writing out the results, unless the cleanup already started (the outputs being flushed
+// or already flushed then). Nothing runs afterwards, the process being about to exit.
+func (c *cleanups) flushOutputs() {
+	if !c.lock.TryLock() {
+		return
+	}
+	defer c.lock.Unlock()
+	if c.done {
+		return
+	}
+	c.done = true
+	for _, step := range c.steps {
+		if step.phase == cleanupFlushOutputs {
+			klog.V(2).Infof("Cleaning up: %v", step.name)
+			step.fn()
+		}
+	}
+}
+
+// Run all the registered steps, doing nothing when called again.
+func (c *cleanups) run() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.done {
+		return
+	}
+	c.done = true
+	sort.SliceStable(c.steps, func(i, j int) bool { return c.steps[i].phase < c.steps[j].phase })
+	for _, step := range c.steps {
+		klog.V(2).Infof("Cleaning up: %v", step.name)
+		step.fn()
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	"github.com/rcrozean/kube-stress/pkg/client"
+)
+
+type ConsistencyCheckConfig struct {
+	namespace       string
+	createNamespace bool
+	deleteNamespace bool
+	objectSize      int
+	burstSize       int
+	rounds          int
+	numClients      int
+	pollInterval    time.Duration
+	convergeTimeout time.Duration
+}
+
+var (
+	consistencyCheckConfig *ConsistencyCheckConfig
+	consistencyCheckCmd    *cobra.Command
+)
+
+func init() {
+	consistencyCheckConfig = &ConsistencyCheckConfig{}
+	consistencyCheckCmd = &cobra.Command{
+		Use:   "consistency-check",
+		Short: "Create a burst of objects, then compare a watch cache list against a quorum one until they converge",
+		Run: func(cmd *cobra.Command, args []string) {
+			exitOnError(cmd.Name(), consistencyCheckCommand())
+		},
+	}
+	rootCmd.AddCommand(consistencyCheckCmd)
+	consistencyCheckCmd.Flags().StringVar(&consistencyCheckConfig.namespace, "namespace", KubeStress, "Namespace where the configmaps of the bursts are created")
+	consistencyCheckCmd.Flags().BoolVar(&consistencyCheckConfig.createNamespace, "create-namespace", false, "Create the namespace before the check if it doesn't exist")
+	consistencyCheckCmd.Flags().BoolVar(&consistencyCheckConfig.deleteNamespace, "delete-namespace-on-exit", false, "Delete the namespace and all its contents (including the created objects) on exit")
+	consistencyCheckCmd.Flags().IntVar(&consistencyCheckConfig.objectSize, "object-size-bytes", 1000, "Size of each configmap to be created")
+	consistencyCheckCmd.Flags().IntVar(&consistencyCheckConfig.burstSize, "burst-size", 100, "Number of configmaps created as fast as possible in each burst")
+	consistencyCheckCmd.Flags().IntVar(&consistencyCheckConfig.rounds, "rounds", 1, "Number of bursts, each followed by the comparison of the lists")
+	consistencyCheckCmd.Flags().IntVar(&consistencyCheckConfig.numClients, "num-clients", 10, "Number of clients to use for spreading the create calls of a burst")
+	consistencyCheckCmd.Flags().DurationVar(&consistencyCheckConfig.pollInterval, "poll-interval", 100*time.Millisecond, "Interval between the comparisons of the lists until they converge")
+	consistencyCheckCmd.Flags().DurationVar(&consistencyCheckConfig.convergeTimeout, "converge-timeout", time.Minute, "How long the lists may take to converge after a burst before the check fails")
+}
+
+func consistencyCheckCommand() error {
+	if consistencyCheckConfig.burstSize < 1 || consistencyCheckConfig.rounds < 1 {
+		return fmt.Errorf("--burst-size and --rounds must be at least 1")
+	}
+	// All the configmaps of a burst are created at once.
+	if err := checkDestructive(destructiveCreate, float64(consistencyCheckConfig.burstSize), consistencyCheckConfig.namespace); err != nil {
+		return err
+	}
+	if consistencyCheckConfig.deleteNamespace {
+		if err := checkDestructive(destructiveDeleteNamespace, 0, consistencyCheckConfig.namespace); err != nil {
+			return err
+		}
+	}
+	if err := checkFileDescriptors(consistencyCheckConfig.numClients); err != nil {
+		return err
+	}
+	clients := client.CreateKubeClients(loadKubeConfig(consistencyCheckCmd), consistencyCheckConfig.numClients)
+	if consistencyCheckConfig.createNamespace {
+		if err := ensureNamespace(context.Background(), clients[0], consistencyCheckConfig.namespace); err != nil {
+			return fmt.Errorf("failed to create namespace: %v", err)
+		}
+	}
+	if consistencyCheckConfig.deleteNamespace {
+		defer deleteNamespace(context.Background(), clients[0], consistencyCheckConfig.namespace)
+	}
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	if err := waitForStart(ctx); err != nil {
+		return err
+	}
+	klog.V(1).Infof("Running %v bursts of %v configmaps in namespace '%v' using %v clients",
+		consistencyCheckConfig.rounds,
+		consistencyCheckConfig.burstSize,
+		consistencyCheckConfig.namespace,
+		consistencyCheckConfig.numClients)
+	var slowest time.Duration
+	diverged := 0
+	for round := 1; round <= consistencyCheckConfig.rounds; round++ {
+		converged, err := consistencyCheckRound(ctx, clients, round)
+		if err != nil {
+			return err
+		}
+		if converged > 0 {
+			diverged++
+		}
+		slowest = max(slowest, converged)
+	}
+	klog.Infof("The watch cache lagged the quorum list after %d out of %d bursts, converging within %v at worst",
+		diverged, consistencyCheckConfig.rounds, slowest)
+	return nil
+}
+
+// Run a burst of creates then compare the lists until they converge, returning how long that took after the
+// burst (0 if the first comparison found no discrepancy).
+func consistencyCheckRound(ctx context.Context, clients []*kubernetes.Clientset, round int) (time.Duration, error) {
+	created, err := createBurst(ctx, clients)
+	if err != nil {
+		return 0, err
+	}
+	burstEnd := time.Now()
+	klog.V(1).Infof("Burst %d: created %d configmaps", round, len(created))
+
+	for comparisons := 0; ; comparisons++ {
+		cached, cachedRV, err := listBurstNames(ctx, clients[0], "0")
+		if err != nil {
+			return 0, fmt.Errorf("failed to list from the watch cache: %v", err)
+		}
+		quorum, quorumRV, err := listBurstNames(ctx, clients[0], "")
+		if err != nil {
+			return 0, fmt.Errorf("failed to list from etcd: %v", err)
+		}
+		var missingFromCache, missingFromQuorum, extraInCache int
+		for name := range created {
+			if !cached[name] {
+				missingFromCache++
+			}
+			if !quorum[name] {
+				missingFromQuorum++
+			}
+		}
+		for name := range cached {
+			if !quorum[name] {
+				extraInCache++
+			}
+		}
+		if missingFromQuorum > 0 {
+			// Created objects always are in a quorum list read after the creates returned.
+			return 0, fmt.Errorf("burst %d: %d created configmaps are missing from the quorum list", round, missingFromQuorum)
+		}
+		if missingFromCache == 0 && extraInCache == 0 {
+			if comparisons == 0 {
+				klog.Infof("Burst %d: the watch cache list matched the quorum one right away", round)
+				return 0, nil
+			}
+			converged := time.Since(burstEnd)
+			klog.Infof("Burst %d: the watch cache list converged with the quorum one %v after the burst", round, converged)
+			return converged, nil
+		}
+		if comparisons == 0 {
+			klog.Warningf("Burst %d: the watch cache list (rv %v) misses %d created configmaps and has %d unknown to the quorum list (rv %v)",
+				round, cachedRV, missingFromCache, extraInCache, quorumRV)
+		}
+		if time.Since(burstEnd) > consistencyCheckConfig.convergeTimeout {
+			return 0, fmt.Errorf("burst %d: the watch cache list didn't converge within %v, it still misses %d created configmaps and has %d unknown ones",
+				round, consistencyCheckConfig.convergeTimeout, missingFromCache, extraInCache)
+		}
+		select {
+		case <-ctx.Done():
+			return 0, &runStoppedError{reason: stopReasonSignal}
+		case <-time.After(consistencyCheckConfig.pollInterval):
+		}
+	}
+}
+
+// Create a burst of configmaps spread across the clients, returning the names of those created.
+func createBurst(ctx context.Context, clients []*kubernetes.Clientset) (map[string]bool, error) {
+	var lock sync.Mutex
+	created := map[string]bool{}
+	var wg sync.WaitGroup
+	work := make(chan struct{}, consistencyCheckConfig.burstSize)
+	for i := 0; i < consistencyCheckConfig.burstSize; i++ {
+		work <- struct{}{}
+	}
+	close(work)
+	for _, c := range clients {
+		wg.Add(1)
+		go func(c *kubernetes.Clientset) {
+			defer wg.Done()
+			for range work {
+				configmap := newConfigMap(consistencyCheckConfig.objectSize)
+				if _, err := c.CoreV1().ConfigMaps(consistencyCheckConfig.namespace).Create(ctx, configmap, metav1.CreateOptions{}); err != nil {
+					logRequestError("Failed to create object: %v", err)
+					continue
+				}
+				lock.Lock()
+				created[configmap.Name] = true
+				lock.Unlock()
+			}
+		}(c)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return nil, &runStoppedError{reason: stopReasonSignal}
+	}
+	return created, nil
+}
+
+// List the names of the configmaps created by this run at the given resource version ("0" being served from
+// the watch cache and "" from etcd), along with the resource version of the list.
+func listBurstNames(ctx context.Context, c *kubernetes.Clientset, resourceVersion string) (map[string]bool, string, error) {
+	list, err := c.CoreV1().ConfigMaps(consistencyCheckConfig.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector:   labels.SelectorFromSet(labels.Set{RunIDLabel: runID}).String(),
+		ResourceVersion: resourceVersion,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	names := make(map[string]bool, len(list.Items))
+	for _, item := range list.Items {
+		names[item.Name] = true
+	}
+	return names, list.ResourceVersion, nil
+}
@@ -16,8 +16,10 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"syscall"
@@ -26,6 +28,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/spf13/cobra"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
@@ -41,11 +44,43 @@ type CreateConfig struct {
 	objectCount int
 	numClients  int
 	qps         float32
+
+	manifestFilepath string
+	createNamespace  bool
+	deleteNamespace  bool
+
+	numNamespaces         int
+	namespaceDistribution string
+	zipfExponent          float64
+
+	resourceQuotaAware bool
+	quotaBackoff       time.Duration
+
+	// Payload diversity: random labels, sizes and unique annotations.
+	labelKeys         int
+	labelCardinality  int
+	minObjectSize     int
+	uniqueAnnotations bool
+
+	sizeDistribution string
+	sizeSigma        float64
+	maxObjectSize    int
 }
 
+// Supported values for --namespace-distribution.
+const (
+	namespaceDistributionUniform = "uniform"
+	namespaceDistributionZipf    = "zipf"
+)
+
 var (
 	createConfig *CreateConfig
 	createCmd    *cobra.Command
+
+	// Creates rejected by a ResourceQuota, with --resource-quota-aware.
+	quotaHits atomic.Uint64
+	// Unix time in nanoseconds until which creates are paused after a quota hit, with --quota-backoff.
+	quotaPausedUntil atomic.Int64
 )
 
 func init() {
@@ -62,15 +97,85 @@ func init() {
 	}
 	rootCmd.AddCommand(createCmd)
 	createCmd.Flags().StringVar(&createConfig.namespace, "namespace", KubeStress, "Namespace name where the test objects will be created")
+	createCmd.Flags().BoolVar(&createConfig.createNamespace, "create-namespace", false, "Create the namespace before creating the objects if it doesn't exist")
+	createCmd.Flags().BoolVar(&createConfig.deleteNamespace, "delete-namespace-on-exit", false, "Delete the namespace and all its contents (including the created objects) on exit")
+	createCmd.Flags().IntVar(&createConfig.numNamespaces, "num-namespaces", 1, "Number of namespaces to spread the objects across, named '<namespace>-<index>' when more than one")
+	createCmd.Flags().StringVar(&createConfig.namespaceDistribution, "namespace-distribution", namespaceDistributionUniform, "How objects are spread across the namespaces: 'uniform' or 'zipf' (a few hot namespaces hold most objects)")
+	createCmd.Flags().Float64Var(&createConfig.zipfExponent, "zipf-exponent", 1.0, "Exponent of the zipf namespace distribution, higher values make it more skewed")
 	createCmd.Flags().StringVar(&createConfig.objectType, "object-type", "configmaps", "Type of objects to create (supported values are 'pods' and 'configmaps'")
 	createCmd.Flags().IntVar(&createConfig.objectSize, "object-size-bytes", 40000, "Size of each object to be created (only used for 'configmap' object type)")
 	createCmd.Flags().IntVar(&createConfig.objectCount, "object-count", 100, "Number of objects to create")
 	createCmd.Flags().IntVar(&createConfig.numClients, "num-clients", 10, "Number of clients to use for spreading the create calls")
 	createCmd.Flags().Float32Var(&createConfig.qps, "qps", 10.0, "QPS to use while creating the objects")
+	createCmd.Flags().IntVar(&createConfig.labelKeys, "payload-label-keys", 0, "Number of extra labels set on each object, valued randomly out of --payload-label-cardinality values (drawn from the --seed generator)")
+	createCmd.Flags().IntVar(&createConfig.labelCardinality, "payload-label-cardinality", 10, "Number of distinct values of each --payload-label-keys label")
+	createCmd.Flags().IntVar(&createConfig.minObjectSize, "payload-min-size-bytes", 0, "Smallest object size of the 'uniform' and 'lognormal' --object-size-distribution (alone, randomizes the size of each object uniformly between this and --object-size-bytes)")
+	createCmd.Flags().StringVar(&createConfig.sizeDistribution, "object-size-distribution", sizeDistributionFixed, "Distribution of the object sizes, drawn from the --seed generator: 'fixed' (all --object-size-bytes), 'uniform' (between --payload-min-size-bytes and --object-size-bytes) or 'lognormal' (median --object-size-bytes, spread by --object-size-sigma, clamped between --payload-min-size-bytes and --object-size-max-bytes)")
+	createCmd.Flags().Float64Var(&createConfig.sizeSigma, "object-size-sigma", 1.0, "Standard deviation of the logarithm of the sizes with --object-size-distribution=lognormal (1 spreads most sizes within a factor of 7 of the median)")
+	createCmd.Flags().IntVar(&createConfig.maxObjectSize, "object-size-max-bytes", 1000000, "Largest object size with --object-size-distribution=lognormal (configmaps must stay under 1MiB)")
+	createCmd.Flags().BoolVar(&createConfig.uniqueAnnotations, "payload-unique-annotations", false, "Set an annotation with a value unique to each object")
+	createCmd.Flags().BoolVar(&createConfig.resourceQuotaAware, "resource-quota-aware", false, "Count the creates rejected by a ResourceQuota separately from the other failures")
+	createCmd.Flags().DurationVar(&createConfig.quotaBackoff, "quota-backoff", 0, "Pause the creates for this long after a ResourceQuota rejected one (only with --resource-quota-aware, 0 means no pause)")
+	createCmd.Flags().StringVar(&createConfig.manifestFilepath, "manifest-output-filepath", "", "Path to the output JSON file where the run manifest (effective config, server, identity, version) will be written")
 }
 
 func createCommand() error {
-	clients := client.CreateKubeClients(client.GetKubeConfig(kubeconfig), createConfig.numClients)
+	if err := checkQPSPerClient(createConfig.qps, createConfig.numClients); err != nil {
+		return err
+	}
+	if createConfig.quotaBackoff > 0 && !createConfig.resourceQuotaAware {
+		return fmt.Errorf("--quota-backoff requires --resource-quota-aware")
+	}
+	if createConfig.labelKeys < 0 || createConfig.labelCardinality < 1 {
+		return fmt.Errorf("--payload-label-keys can't be negative and --payload-label-cardinality must be at least 1")
+	}
+	if err := checkObjectSizeDistribution(); err != nil {
+		return err
+	}
+	if createConfig.numNamespaces < 1 {
+		return fmt.Errorf("--num-namespaces must be at least 1")
+	}
+	namespaces := []string{createConfig.namespace}
+	if createConfig.numNamespaces > 1 {
+		namespaces = indexedNamespaces(createConfig.namespace, createConfig.numNamespaces)
+	}
+	if err := checkDestructive(destructiveCreate, float64(createConfig.qps), namespaces...); err != nil {
+		return err
+	}
+	if createConfig.deleteNamespace {
+		if err := checkDestructive(destructiveDeleteNamespace, 0, namespaces...); err != nil {
+			return err
+		}
+	}
+	var namespaceChoice *util.WeightedChoice
+	switch createConfig.namespaceDistribution {
+	case namespaceDistributionUniform:
+		namespaceChoice = util.NewZipfChoice(namespaces, 0)
+	case namespaceDistributionZipf:
+		namespaceChoice = util.NewZipfChoice(namespaces, createConfig.zipfExponent)
+	default:
+		return fmt.Errorf("unsupported --namespace-distribution value '%v'", createConfig.namespaceDistribution)
+	}
+	config := loadKubeConfig(createCmd)
+	if createConfig.manifestFilepath != "" {
+		if err := writeManifest(createConfig.manifestFilepath, createCmd, config); err != nil {
+			return fmt.Errorf("failed to write run manifest: %v", err)
+		}
+	}
+	if err := checkFileDescriptors(createConfig.numClients); err != nil {
+		return err
+	}
+	clients := client.CreateKubeClients(config, createConfig.numClients)
+	for _, namespace := range namespaces {
+		if createConfig.createNamespace {
+			if err := ensureNamespace(context.Background(), clients[0], namespace); err != nil {
+				return fmt.Errorf("failed to create namespace: %v", err)
+			}
+		}
+		if createConfig.deleteNamespace {
+			defer deleteNamespace(context.Background(), clients[0], namespace)
+		}
+	}
 
 	// Setup signal handling for the process.
 	sigs := make(chan os.Signal, 1)
@@ -91,34 +196,53 @@ func createCommand() error {
 		}
 	}()
 
-	klog.V(1).Infof("Creating %v objects of type '%v' (%v bytes each) in namespace '%v' using %v clients and QPS = %v",
+	if err := waitForStart(ctx); err != nil {
+		return err
+	}
+	klog.V(1).Infof("Creating %v objects of type '%v' (%v bytes, '%v' size distribution) in %v namespace(s) '%v' using %v clients and QPS = %v",
 		createConfig.objectCount,
 		createConfig.objectType,
 		createConfig.objectSize,
+		createConfig.sizeDistribution,
+		len(namespaces),
 		createConfig.namespace,
 		createConfig.numClients,
 		createConfig.qps)
-	createObjects(ctx, clients)
+	createObjects(ctx, clients, namespaceChoice)
 	return nil
 }
 
-func createObjects(ctx context.Context, clients []*kubernetes.Clientset) {
+func createObjects(ctx context.Context, clients []*kubernetes.Clientset, namespaceChoice *util.WeightedChoice) {
 	ticker := time.NewTicker(time.Duration(1000000000.0/createConfig.qps) * time.Nanosecond)
 	defer ticker.Stop()
 
 	var wg sync.WaitGroup
 	var numObjectsCreated uint32
+	perNamespace := map[string]*atomic.Uint32{}
+	for _, namespace := range namespaceChoice.Names() {
+		perNamespace[namespace] = &atomic.Uint32{}
+	}
+	defer reportNamespaceCounts(namespaceChoice.Names(), perNamespace)
+	defer createdSizes.report()
+	if createConfig.resourceQuotaAware {
+		defer func() { klog.Infof("Creates rejected by a ResourceQuota: %v", quotaHits.Load()) }()
+	}
 	for i := 0; atomic.LoadUint32(&numObjectsCreated) < uint32(createConfig.objectCount); i++ {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
+			if time.Now().UnixNano() < quotaPausedUntil.Load() {
+				continue
+			}
 			client := clients[i%len(clients)]
+			namespace := namespaceChoice.Pick(rng)
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				if err := createObject(ctx, client); err == nil {
+				if err := createObject(ctx, client, namespace); err == nil {
 					atomic.AddUint32(&numObjectsCreated, 1)
+					perNamespace[namespace].Add(1)
 				}
 			}()
 		}
@@ -128,11 +252,62 @@ func createObjects(ctx context.Context, clients []*kubernetes.Clientset) {
 	klog.V(1).Infof("Successfully created %v objects", numObjectsCreated)
 }
 
-func createObject(ctx context.Context, client *kubernetes.Clientset) error {
+func reportNamespaceCounts(namespaces []string, counts map[string]*atomic.Uint32) {
+	if len(namespaces) == 1 {
+		return
+	}
+	for _, namespace := range namespaces {
+		klog.Infof("Created %v objects in namespace '%v'", counts[namespace].Load(), namespace)
+	}
+}
+
+func createObject(ctx context.Context, client *kubernetes.Clientset, namespace string) error {
 	start := time.Now()
-	objectName := "configmap-" + uuid.Must(uuid.NewRandom()).String()
 	// TODO: Implement other object-types below.
-	configmap := &corev1.ConfigMap{
+	configmap := newDiverseConfigMap()
+	objectName := configmap.Name
+
+	_, err := client.CoreV1().ConfigMaps(namespace).Create(ctx, configmap, metav1.CreateOptions{})
+	if err != nil {
+		if createConfig.resourceQuotaAware && isQuotaExceeded(err) {
+			quotaHits.Add(1)
+			if createConfig.quotaBackoff > 0 {
+				quotaPausedUntil.Store(time.Now().Add(createConfig.quotaBackoff).UnixNano())
+			}
+			klog.V(2).Infof("Create of object %v rejected by a ResourceQuota: %v", objectName, err)
+			return err
+		}
+		logRequestError("Failed to create object: %v", err)
+		return err
+	}
+
+	createdSizes.record(len(configmap.Data[objectName]))
+	klog.V(2).Infof("Created object %v successfully (took %v)", objectName, time.Since(start))
+	return nil
+}
+
+// Build a configmap varied by the --payload-* flags, so the population exercises label indexing and dedup
+// more realistically than identical objects.
+func newDiverseConfigMap() *corev1.ConfigMap {
+	configmap := newConfigMap(nextObjectSize())
+	for i := 0; i < createConfig.labelKeys; i++ {
+		configmap.Labels[fmt.Sprintf("%v/label-%d", KubeStress, i)] = fmt.Sprintf("value-%d", rng.IntRange(0, createConfig.labelCardinality-1))
+	}
+	if createConfig.uniqueAnnotations {
+		configmap.Annotations = map[string]string{KubeStress + "/unique": uuid.Must(uuid.NewRandom()).String()}
+	}
+	return configmap
+}
+
+// Whether the error is the quota admission rejecting a create, which is a Forbidden one without a more specific reason.
+func isQuotaExceeded(err error) bool {
+	return apierrors.IsForbidden(err) && strings.Contains(err.Error(), "exceeded quota")
+}
+
+// Build a configmap with a unique name holding a random value of the given size.
+func newConfigMap(objectSize int) *corev1.ConfigMap {
+	objectName := "configmap-" + uuid.Must(uuid.NewRandom()).String()
+	return &corev1.ConfigMap{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: "v1",
 			Kind:       "ConfigMap",
@@ -142,17 +317,9 @@ func createObject(ctx context.Context, client *kubernetes.Clientset) error {
 			// Below label helps selectively list/delete objects created by kube-stress.
 			Labels: map[string]string{
 				KubeStress: objectName,
+				RunIDLabel: runID,
 			},
 		},
-		Data: map[string]string{objectName: util.RandomString(createConfig.objectSize)},
-	}
-
-	_, err := client.CoreV1().ConfigMaps(createConfig.namespace).Create(ctx, configmap, metav1.CreateOptions{})
-	if err != nil {
-		klog.Errorf("Failed to create object: %v", err)
-		return err
+		Data: map[string]string{objectName: util.RandomString(objectSize)},
 	}
-
-	klog.V(2).Infof("Created object %v successfully (took %v)", objectName, time.Since(start))
-	return nil
 }
@@ -0,0 +1,173 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rcrozean/kube-stress/pkg/client"
+	"github.com/rcrozean/kube-stress/pkg/util"
+)
+
+// Everything known about a successful list call that can be written to the CSV output.
+type listRow struct {
+	start       time.Time
+	latency     time.Duration
+	pageSize    int
+	truncated   bool
+	annotated   bool
+	clientIndex int
+	namespace   string
+	status      int
+	compressed  bool
+	tableRows   int
+	// Fraction of the calls sampled to the outputs when this one was.
+	sampleRate float64
+	// Calls in flight when this one started, itself included.
+	inFlight int64
+	// Only set with --follow-continue, the page index being "total" for the row of the whole list.
+	listID         uint64
+	pageIndex      string
+	continueLength int
+	// Only set with --clusters.
+	cluster string
+	// Content-Length of the response (-1 when unknown) and the bytes actually read from its body.
+	contentLength int64
+	bodyBytes     int64
+	// Only parsed with --measure-apiserver-queue-wait.
+	serverTiming []client.ServerTimingMetric
+	// UUID sent with --send-request-ids and the audit ID of the response, of the last page with --follow-continue.
+	requestID string
+	auditID   string
+	// Only set with --measure-decode, the latency then being the network time only.
+	decodeTime  time.Duration
+	objectCount int
+	// Only set for the events of the watch command, the start being the arrival time of the event.
+	eventType       string
+	objectKey       string
+	resourceVersion string
+	// Delay from the time the write of the object was sent to the arrival of its event, when known.
+	deliveryLatency time.Duration
+	deliveryTimed   bool
+}
+
+// Pauses of this process' garbage collector, for the gc_pause column.
+var gcPauses = util.NewGCPauseTracker()
+
+// Columns supported by --csv-columns.
+var listCSVColumns = map[string]func(r *listRow) string{
+	"start_time": func(r *listRow) string { return r.start.Format(time.RFC3339Nano) },
+	"latency":    func(r *listRow) string { return formatLatency(r.latency) },
+	"page_size":  func(r *listRow) string { return fmt.Sprintf("%v", r.pageSize) },
+	"truncated":  func(r *listRow) string { return fmt.Sprintf("%v", r.truncated) },
+	"annotated":  func(r *listRow) string { return fmt.Sprintf("%v", r.annotated) },
+	"run_id":     func(r *listRow) string { return runID },
+	// Each row stands for 1/sample_rate calls with --sample-rate.
+	"sample_rate":     func(r *listRow) string { return fmt.Sprintf("%v", r.sampleRate) },
+	"client_index":    func(r *listRow) string { return fmt.Sprintf("%v", r.clientIndex) },
+	"namespace":       func(r *listRow) string { return r.namespace },
+	"status":          func(r *listRow) string { return fmt.Sprintf("%v", r.status) },
+	"compressed":      func(r *listRow) string { return fmt.Sprintf("%v", r.compressed) },
+	"table_rows":      func(r *listRow) string { return fmt.Sprintf("%v", r.tableRows) },
+	"in_flight":       func(r *listRow) string { return fmt.Sprintf("%v", r.inFlight) },
+	"list_id":         func(r *listRow) string { return fmt.Sprintf("%v", r.listID) },
+	"page_index":      func(r *listRow) string { return r.pageIndex },
+	"continue_length": func(r *listRow) string { return fmt.Sprintf("%v", r.continueLength) },
+	"cluster":         func(r *listRow) string { return r.cluster },
+	"content_length":  func(r *listRow) string { return fmt.Sprintf("%v", r.contentLength) },
+	"body_bytes":      func(r *listRow) string { return fmt.Sprintf("%v", r.bodyBytes) },
+	"request_id":      func(r *listRow) string { return r.requestID },
+	"audit_id":        func(r *listRow) string { return r.auditID },
+	// Only filled with --measure-decode.
+	"decode_time":  func(r *listRow) string { return formatLatency(r.decodeTime) },
+	"object_count": func(r *listRow) string { return fmt.Sprintf("%v", r.objectCount) },
+	// Only filled for the events of the watch command.
+	"event_type":       func(r *listRow) string { return r.eventType },
+	"object_key":       func(r *listRow) string { return r.objectKey },
+	"resource_version": func(r *listRow) string { return r.resourceVersion },
+	// Empty for the events of writes which didn't record their time, see the watch command.
+	"delivery_latency": func(r *listRow) string {
+		if !r.deliveryTimed {
+			return ""
+		}
+		return formatLatency(r.deliveryLatency)
+	},
+	// Whether a client-side GC pause overlapped the call, in which case its latency isn't all the server's.
+	"gc_pause": func(r *listRow) string { return fmt.Sprintf("%v", gcPauses.Overlaps(r.start, r.start.Add(r.latency))) },
+	// All the Server-Timing metrics of the response, as 'name=duration' pairs separated by semicolons.
+	"server_timing": func(r *listRow) string {
+		pairs := make([]string, len(r.serverTiming))
+		for i, metric := range r.serverTiming {
+			pairs[i] = metric.Name + "=" + formatLatency(metric.Duration)
+		}
+		return strings.Join(pairs, ";")
+	},
+}
+
+// Prefix of the columns getting the duration of a single Server-Timing metric, e.g 'server_timing_etcd'.
+const serverTimingColumnPrefix = "server_timing_"
+
+// Columns written when --csv-columns isn't set, without a header.
+var defaultListCSVColumns = []string{"latency", "page_size", "truncated", "annotated", "run_id"}
+
+// Columns written by the watch command when --csv-columns isn't set, preceded by a header.
+var defaultWatchCSVColumns = []string{"start_time", "event_type", "object_key", "resource_version", "client_index", "delivery_latency"}
+
+// Columns appended to the default ones with --measure-decode.
+var decodeCSVColumns = []string{"decode_time", "object_count"}
+
+// Columns appended to the default ones with --follow-continue.
+var pageCSVColumns = []string{"list_id", "page_index", "continue_length"}
+
+// Parse and validate a comma-separated list of CSV column names.
+func parseCSVColumns(spec string) ([]string, error) {
+	columns := strings.Split(spec, ",")
+	for _, column := range columns {
+		if metric, ok := strings.CutPrefix(column, serverTimingColumnPrefix); ok && metric != "" {
+			continue
+		}
+		if _, ok := listCSVColumns[column]; !ok {
+			known := make([]string, 0, len(listCSVColumns))
+			for name := range listCSVColumns {
+				known = append(known, name)
+			}
+			sort.Strings(known)
+			return nil, fmt.Errorf("unknown CSV column '%v' (known columns are %v and %v<metric>)", column, strings.Join(known, ", "), serverTimingColumnPrefix)
+		}
+	}
+	return columns, nil
+}
+
+func (r *listRow) csv(columns []string) []string {
+	values := make([]string, len(columns))
+	for i, column := range columns {
+		if fn, ok := listCSVColumns[column]; ok {
+			values[i] = fn(r)
+			continue
+		}
+		// Metrics missing from the response are left empty, telling them apart from instant ones.
+		name := strings.TrimPrefix(column, serverTimingColumnPrefix)
+		for _, metric := range r.serverTiming {
+			if metric.Name == name {
+				values[i] = formatLatency(metric.Duration)
+				break
+			}
+		}
+	}
+	return values
+}
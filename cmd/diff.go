@@ -0,0 +1,113 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+type DiffConfig struct {
+	threshold float64
+}
+
+var (
+	diffConfig *DiffConfig
+	diffCmd    *cobra.Command
+)
+
+func init() {
+	diffConfig = &DiffConfig{}
+	diffCmd = &cobra.Command{
+		Use:   "diff <baseline-summary.json> <candidate-summary.json>",
+		Short: "Compare the JSON summaries of two runs and flag regressions",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := diffCommand(args[0], args[1]); err != nil {
+				klog.Errorf("Error executing diff command: %v", err)
+				os.Exit(1)
+			}
+		},
+	}
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().Float64Var(&diffConfig.threshold, "threshold", 10.0, "Percentage change in the wrong direction beyond which a metric is flagged as a regression")
+}
+
+// A compared metric, where higherIsBetter tells which direction of change is a regression.
+type diffMetric struct {
+	name           string
+	baseline       float64
+	candidate      float64
+	higherIsBetter bool
+}
+
+func diffCommand(baselineFilepath, candidateFilepath string) error {
+	baseline, err := readSummary(baselineFilepath)
+	if err != nil {
+		return fmt.Errorf("failed to read baseline summary: %v", err)
+	}
+	candidate, err := readSummary(candidateFilepath)
+	if err != nil {
+		return fmt.Errorf("failed to read candidate summary: %v", err)
+	}
+
+	var regressions []string
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "METRIC\tBASELINE\tCANDIDATE\tCHANGE\tSTATUS")
+	for _, m := range summaryMetrics(baseline, candidate) {
+		change := percentChange(m.baseline, m.candidate)
+		status := colorize("ok", colorGreen)
+		if m.higherIsBetter && change < -diffConfig.threshold || !m.higherIsBetter && change > diffConfig.threshold {
+			// Only the last column is colored, so the escape codes don't throw off the alignment.
+			status = colorize("REGRESSION", colorRed)
+			regressions = append(regressions, m.name)
+		}
+		fmt.Fprintf(w, "%v\t%.4g\t%.4g\t%+.2f%%\t%v\n", m.name, m.baseline, m.candidate, change, status)
+	}
+	w.Flush()
+
+	if len(regressions) > 0 {
+		fmt.Printf("%v: %d metric(s) regressed beyond %v%%: %v\n", colorize("FAIL", colorRed), len(regressions), diffConfig.threshold, regressions)
+		return fmt.Errorf("candidate regressed compared to baseline")
+	}
+	fmt.Printf("%v: no metric regressed beyond %v%%\n", colorize("PASS", colorGreen), diffConfig.threshold)
+	return nil
+}
+
+// The metrics compared between two runs.
+func summaryMetrics(baseline, candidate *RunSummary) []diffMetric {
+	return []diffMetric{
+		{"p50", baseline.Latency.P50.Seconds(), candidate.Latency.P50.Seconds(), false},
+		{"p99", baseline.Latency.P99.Seconds(), candidate.Latency.P99.Seconds(), false},
+		{"failure-rate", baseline.FailureRate, candidate.FailureRate, false},
+		{"achieved-qps", baseline.AchievedQPS, candidate.AchievedQPS, true},
+	}
+}
+
+// Percentage change from baseline to candidate, infinite if only the candidate is non-zero.
+func percentChange(baseline, candidate float64) float64 {
+	if baseline == 0 {
+		if candidate == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return (candidate - baseline) / baseline * 100
+}
@@ -0,0 +1,196 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	"github.com/rcrozean/kube-stress/pkg/client"
+	"github.com/rcrozean/kube-stress/pkg/util"
+)
+
+type DiscoveryConfig struct {
+	legacy        bool
+	numClients    int
+	qps           float32
+	totalDuration time.Duration
+}
+
+const (
+	// Accept header asking for aggregated discovery, preferring v2 over v2beta1, and the legacy documents otherwise.
+	aggregatedDiscoveryAccept = "application/json;g=apidiscovery.k8s.io;v=v2;as=APIGroupDiscoveryList," +
+		"application/json;g=apidiscovery.k8s.io;v=v2beta1;as=APIGroupDiscoveryList," +
+		"application/json"
+	legacyDiscoveryAccept = "application/json"
+)
+
+var (
+	discoveryConfig *DiscoveryConfig
+	discoveryCmd    *cobra.Command
+)
+
+func init() {
+	discoveryConfig = &DiscoveryConfig{}
+	discoveryCmd = &cobra.Command{
+		Use:   "discovery",
+		Short: "Fetch the API discovery documents (/api and /apis) repeatedly",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := discoveryCommand(); err != nil {
+				klog.Errorf("Error executing discovery command: %v", err)
+				os.Exit(1)
+			}
+		},
+	}
+	rootCmd.AddCommand(discoveryCmd)
+	discoveryCmd.Flags().BoolVar(&discoveryConfig.legacy, "legacy", false, "Fetch the legacy discovery documents (/api, /apis and every group version) even if the server supports aggregated discovery")
+	discoveryCmd.Flags().IntVar(&discoveryConfig.numClients, "num-clients", 10, "Number of clients to use for spreading the discovery calls")
+	discoveryCmd.Flags().Float32Var(&discoveryConfig.qps, "qps", 10.0, "QPS to generate for the discovery calls")
+	discoveryCmd.Flags().DurationVar(&discoveryConfig.totalDuration, "total-duration", 5*time.Minute, "Total duration for which to run this command")
+}
+
+func discoveryCommand() error {
+	if err := checkQPSPerClient(discoveryConfig.qps, discoveryConfig.numClients); err != nil {
+		return err
+	}
+	if err := checkFileDescriptors(discoveryConfig.numClients); err != nil {
+		return err
+	}
+	// Traced configs record the content type the documents are served as.
+	configs, _ := client.TracedConfigs(loadKubeConfig(discoveryCmd), discoveryConfig.numClients)
+	clients := client.CreateKubeClientsForConfigs(configs)
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	paths, accept, err := discoveryPaths(ctx, clients[0])
+	if err != nil {
+		return err
+	}
+	if err := waitForStart(ctx); err != nil {
+		return err
+	}
+	klog.V(1).Infof("Fetching %v discovery documents using %v clients and QPS = %v for %v",
+		len(paths),
+		discoveryConfig.numClients,
+		discoveryConfig.qps,
+		discoveryConfig.totalDuration)
+	fetchDiscovery(ctx, clients, paths, accept)
+	return nil
+}
+
+// Paths of the discovery documents to fetch, and the Accept header to fetch them with. Aggregated discovery
+// only takes /api and /apis, while legacy discovery also takes a document for every group version.
+func discoveryPaths(ctx context.Context, c *kubernetes.Clientset) ([]string, string, error) {
+	if !discoveryConfig.legacy {
+		_, contentType, err := fetchDiscoveryDocument(ctx, c, "/apis", aggregatedDiscoveryAccept)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to fetch the discovery document: %v", err)
+		}
+		if strings.Contains(contentType, "g=apidiscovery.k8s.io") {
+			klog.Infof("Server supports aggregated discovery (%v)", contentType)
+			return []string{"/api", "/apis"}, aggregatedDiscoveryAccept, nil
+		}
+		klog.Infof("Server doesn't support aggregated discovery, falling back to legacy discovery")
+	}
+	groups, err := c.Discovery().ServerGroups()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list the API groups: %v", err)
+	}
+	paths := []string{"/api", "/apis", "/api/v1"}
+	for _, group := range groups.Groups {
+		for _, version := range group.Versions {
+			paths = append(paths, "/apis/"+version.GroupVersion)
+		}
+	}
+	return paths, legacyDiscoveryAccept, nil
+}
+
+func fetchDiscovery(ctx context.Context, clients []*kubernetes.Clientset, paths []string, accept string) {
+	start := time.Now()
+	ticker := time.NewTicker(time.Duration(1000000000.0/discoveryConfig.qps) * time.Nanosecond)
+	defer ticker.Stop()
+
+	var totalCount, failedCount, totalBytes atomic.Uint64
+	latencies := util.NewLatencyTracker()
+	defer func() {
+		fc, tc := failedCount.Load(), totalCount.Load()
+		l := latencies.Summary()
+		klog.Infof("%d out of %d requests failed, failure rate: %v%%", fc, tc, float64(fc)/float64(tc)*100)
+		klog.Infof("Discovery latency: p50 = %v, p90 = %v, p99 = %v", l.P50, l.P90, l.P99)
+		if succeeded := tc - fc; succeeded > 0 {
+			klog.Infof("Discovery response size: mean = %v bytes", totalBytes.Load()/succeeded)
+		}
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for i := 0; time.Since(start) < discoveryConfig.totalDuration; i++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			client := clients[i%len(clients)]
+			path := paths[i%len(paths)]
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				totalCount.Add(1)
+				requestStart := time.Now()
+				size, _, err := fetchDiscoveryDocument(ctx, client, path, accept)
+				if err != nil {
+					failedCount.Add(1)
+					logRequestError("Error seen with discovery call: %v", err)
+					return
+				}
+				latency := time.Since(requestStart)
+				latencies.Record(latency)
+				totalBytes.Add(uint64(size))
+				klog.V(2).Infof("Discovery call for %v took: %v (%v bytes)", path, latency, size)
+			}()
+		}
+	}
+}
+
+// Fetch a discovery document, returning its size and the content type it was served as.
+func fetchDiscoveryDocument(ctx context.Context, c *kubernetes.Clientset, path, accept string) (int64, string, error) {
+	requestCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	requestCtx, info := client.WithResponseInfo(requestCtx)
+
+	rc, err := c.Discovery().RESTClient().Get().
+		AbsPath(path).
+		SetHeader("Accept", accept).
+		Stream(requestCtx)
+	if err != nil {
+		return 0, "", err
+	}
+	defer rc.Close()
+	size, err := io.Copy(ioutil.Discard, rc)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, info.Header.Get("Content-Type"), nil
+}
@@ -0,0 +1,186 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+// Supported --dry-run values.
+const (
+	dryRunNone   = "none"
+	dryRunClient = "client"
+)
+
+// Requests and objects a command is expected to send, create and delete over its run.
+type dryRunPlan struct {
+	// Expected duration of the commands without --total-duration.
+	duration time.Duration
+	requests int
+	created  int
+	deleted  int
+	// Caveat on the expected numbers, e.g when they're only an upper bound.
+	note string
+}
+
+// Expected totals of the commands writing objects, the other commands only sending qps * total-duration requests.
+var dryRunPlans = map[string]func() dryRunPlan{
+	"create": func() dryRunPlan {
+		duration := time.Duration(float64(createConfig.objectCount) / float64(createConfig.qps) * float64(time.Second))
+		return dryRunPlan{duration: duration, requests: createConfig.objectCount, created: createConfig.objectCount}
+	},
+	"churn": func() dryRunPlan {
+		churned := expectedRequests(churnConfig.churnRate, churnConfig.totalDuration)
+		created := churnConfig.population + churned
+		return dryRunPlan{requests: created + churned, created: created, deleted: churned}
+	},
+	"consistency-check": func() dryRunPlan {
+		created := consistencyCheckConfig.burstSize * consistencyCheckConfig.rounds
+		return dryRunPlan{requests: created, created: created, note: "plus the lists compared after each burst"}
+	},
+	"propagation": func() dryRunPlan {
+		created := expectedRequests(propagationConfig.qps, propagationConfig.totalDuration)
+		return dryRunPlan{requests: created, created: created, note: "plus the watches of the created configmaps"}
+	},
+	"mix": func() dryRunPlan {
+		requests := expectedRequests(mixConfig.qps, mixConfig.totalDuration)
+		return dryRunPlan{requests: requests, created: requests, note: "objects created is an upper bound, depending on the create share of --verb-mix"}
+	},
+	"watch-latency": func() dryRunPlan {
+		writes := expectedRequests(watchLatencyConfig.qps, watchLatencyConfig.totalDuration)
+		return dryRunPlan{requests: writes + 2, created: 1, deleted: 1, note: "writes being sequential, slow ones lower the number of requests"}
+	},
+}
+
+// Number of requests sent at qps over d.
+func expectedRequests(qps float32, d time.Duration) int {
+	return int(math.Round(float64(qps) * d.Seconds()))
+}
+
+// Log the plan of the command from its flags, ahead of the requests of a client dry-run.
+func logDryRunPlan(cmd *cobra.Command) {
+	var qps float32
+	var duration time.Duration
+	if cmd.Flags().Lookup("qps") != nil {
+		qps, _ = cmd.Flags().GetFloat32("qps")
+	}
+	if cmd.Flags().Lookup("total-duration") != nil {
+		duration, _ = cmd.Flags().GetDuration("total-duration")
+	}
+	plan := dryRunPlan{requests: expectedRequests(qps, duration)}
+	if planFor, ok := dryRunPlans[cmd.Name()]; ok {
+		plan = planFor()
+	}
+	if plan.duration > 0 {
+		duration = plan.duration
+	}
+	klog.Infof("Dry run plan of the %v command: %v QPS for %v, %v requests expected, %v objects created and %v deleted",
+		cmd.Name(), qps, duration, plan.requests, plan.created, plan.deleted)
+	if plan.note != "" {
+		klog.Infof("Dry run plan note: %v", plan.note)
+	}
+	if f := cmd.Flags().Lookup("namespace"); f != nil {
+		klog.Infof("Dry run plan namespace: '%v'", f.Value)
+	}
+	if f := cmd.Flags().Lookup("delete-namespace-on-exit"); f != nil && f.Value.String() == "true" {
+		klog.Infof("Dry run plan deletes the namespace and everything in it on exit")
+	}
+}
+
+// Requests intercepted by the client dry-run, which stops the process once --dry-run-requests were logged.
+var dryRunIntercepted struct {
+	sync.Mutex
+	count int
+}
+
+// Whether the requests are intercepted rather than sent, i.e --dry-run=client without --confirm.
+func dryRunActive() bool {
+	return dryRun == dryRunClient && !dryRunConfirmed
+}
+
+// Log an intercepted request, ending the dry run once enough were logged.
+func interceptDryRunRequest(req *http.Request) {
+	dryRunIntercepted.Lock()
+	defer dryRunIntercepted.Unlock()
+	dryRunIntercepted.count++
+	if dryRunIntercepted.count > dryRunRequests {
+		return
+	}
+	var selectors []string
+	for _, key := range []string{"labelSelector", "fieldSelector"} {
+		if s := req.URL.Query().Get(key); s != "" {
+			selectors = append(selectors, key+"="+s)
+		}
+	}
+	klog.Infof("Dry run request %d: %v %v (namespace '%v', selectors [%v], body %d bytes)",
+		dryRunIntercepted.count, req.Method, req.URL, requestNamespace(req.URL.Path), strings.Join(selectors, " "), max(req.ContentLength, 0))
+	if dryRunIntercepted.count == dryRunRequests {
+		finishDryRun(dryRunIntercepted.count)
+	}
+}
+
+func dryRunInterceptedCount() int {
+	dryRunIntercepted.Lock()
+	defer dryRunIntercepted.Unlock()
+	return dryRunIntercepted.count
+}
+
+// Namespace from the path of a request, empty for cluster-scoped and all-namespaces requests.
+func requestNamespace(path string) string {
+	_, rest, ok := strings.Cut(path, "/namespaces/")
+	if !ok {
+		return ""
+	}
+	namespace, _, _ := strings.Cut(rest, "/")
+	return namespace
+}
+
+// End a client dry-run, even when the command is still going or failed on the intercepted requests.
+func finishDryRun(intercepted int) {
+	klog.Infof("Dry run done after %d requests, none were sent (pass --confirm to run against the server)", intercepted)
+	klog.Flush()
+	os.Exit(0)
+}
+
+// Check the --dry-run flags, logging the plan and intercepting the requests of the command.
+func applyDryRun(cmd *cobra.Command) error {
+	switch dryRun {
+	case dryRunNone:
+		if dryRunConfirmed {
+			return fmt.Errorf("--confirm is only used with --dry-run=%v", dryRunClient)
+		}
+		return nil
+	case dryRunClient:
+	default:
+		return fmt.Errorf("unsupported --dry-run value '%v' (supported values are '%v' and '%v')", dryRun, dryRunNone, dryRunClient)
+	}
+	if dryRunRequests < 1 {
+		return fmt.Errorf("--dry-run-requests must be at least 1")
+	}
+	logDryRunPlan(cmd)
+	if dryRunConfirmed {
+		klog.Infof("Dry run confirmed, running against the server")
+	}
+	return nil
+}
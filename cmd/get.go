@@ -0,0 +1,368 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	"github.com/rcrozean/kube-stress/pkg/client"
+	"github.com/rcrozean/kube-stress/pkg/util"
+)
+
+type GetConfig struct {
+	namespace     string
+	objectType    string
+	nameSource    string
+	numClients    int
+	qps           float32
+	totalDuration time.Duration
+	// Served from the watch cache when set ('0' for any version), from etcd with a quorum read when empty.
+	resourceVersion string
+	// Only the informer names of objects created at most this long ago get picked, 0 meaning all.
+	nameMaxAge time.Duration
+}
+
+// Supported values for --name-source.
+const (
+	nameSourceList     = "list"
+	nameSourceInformer = "informer"
+)
+
+var (
+	getConfig *GetConfig
+	getCmd    *cobra.Command
+)
+
+func init() {
+	getConfig = &GetConfig{}
+	getCmd = &cobra.Command{
+		Use:   "get",
+		Short: "Get random objects of a given type in the cluster by name",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := getCommand(); err != nil {
+				klog.Errorf("Error executing get command: %v", err)
+				os.Exit(1)
+			}
+		},
+	}
+	rootCmd.AddCommand(getCmd)
+	getCmd.Flags().StringVar(&getConfig.namespace, "namespace", KubeStress, "Namespace to get the objects from (empty value means all namespaces)")
+	getCmd.Flags().StringVar(&getConfig.objectType, "object-type", "configmaps", "Type of objects to get (any core/v1 resource, e.g 'pods' and 'configmaps'), or '<resource>/<subresource>' to get a subresource of them (e.g 'pods/status', 'replicationcontrollers/scale' or 'pods/log')")
+	getCmd.Flags().StringVar(&getConfig.nameSource, "name-source", nameSourceList, "Where the names of the objects to get come from: 'list' (a single list at startup) or 'informer' (a live informer cache, so only existing objects are targeted)")
+	getCmd.Flags().DurationVar(&getConfig.nameMaxAge, "name-max-age", 0, "With --name-source=informer, only get the objects created at most this long ago, the older ones getting evicted from the names, e.g to model controllers acting on fresh objects (0 means all the objects)")
+	getCmd.Flags().StringVar(&getConfig.resourceVersion, "resource-version", "", "Resource version of the get calls: empty for quorum reads from etcd, '0' for any version from the watch cache, or one the object must be at least at, also served from the watch cache")
+	getCmd.Flags().IntVar(&getConfig.numClients, "num-clients", 10, "Number of clients to use for spreading the get calls")
+	getCmd.Flags().Float32Var(&getConfig.qps, "qps", 10.0, "QPS to generate for the get calls")
+	getCmd.Flags().DurationVar(&getConfig.totalDuration, "total-duration", 5*time.Minute, "Total duration for which to run this command")
+}
+
+// Pool of "namespace/name" keys supporting constant time random picks and removals.
+type namePool struct {
+	lock  sync.RWMutex
+	keys  []string
+	index map[string]int
+	// Only set with a max age, the keys being evicted once picked past it.
+	maxAge  time.Duration
+	created map[string]time.Time
+}
+
+func newNamePool() *namePool {
+	return &namePool{index: map[string]int{}}
+}
+
+func (p *namePool) add(key string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if _, ok := p.index[key]; ok {
+		return
+	}
+	p.index[key] = len(p.keys)
+	p.keys = append(p.keys, key)
+}
+
+// Add the key of an object created at the given time, unless it's already past the max age of the pool.
+func (p *namePool) addCreated(key string, created time.Time) {
+	if p.maxAge > 0 && time.Since(created) > p.maxAge {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.created == nil {
+		p.created = map[string]time.Time{}
+	}
+	p.created[key] = created
+	if _, ok := p.index[key]; !ok {
+		p.index[key] = len(p.keys)
+		p.keys = append(p.keys, key)
+	}
+}
+
+func (p *namePool) remove(key string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	i, ok := p.index[key]
+	if !ok {
+		return
+	}
+	last := p.keys[len(p.keys)-1]
+	p.keys[i] = last
+	p.index[last] = i
+	p.keys = p.keys[:len(p.keys)-1]
+	delete(p.index, key)
+	delete(p.created, key)
+}
+
+func (p *namePool) size() int {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return len(p.keys)
+}
+
+// Pick a random key, returning false if the pool is empty. The keys picked past the max age are evicted, and
+// another one picked instead.
+func (p *namePool) pick(r *util.ThreadSafeRand) (string, bool) {
+	for {
+		p.lock.RLock()
+		if len(p.keys) == 0 {
+			p.lock.RUnlock()
+			return "", false
+		}
+		key := p.keys[r.IntRange(0, len(p.keys)-1)]
+		created, ok := p.created[key]
+		p.lock.RUnlock()
+		if p.maxAge <= 0 || !ok || time.Since(created) <= p.maxAge {
+			return key, true
+		}
+		p.remove(key)
+	}
+}
+
+func getCommand() error {
+	if err := checkQPSPerClient(getConfig.qps, getConfig.numClients); err != nil {
+		return err
+	}
+	resource, subresource := splitSubresource(getConfig.objectType)
+	if err := checkReadableSubresource(resource, subresource); err != nil {
+		return fmt.Errorf("invalid --object-type: %v", err)
+	}
+	if _, err := strconv.ParseUint(getConfig.resourceVersion, 10, 64); getConfig.resourceVersion != "" && err != nil {
+		return fmt.Errorf("invalid --resource-version '%v', expected a number", getConfig.resourceVersion)
+	}
+	if getConfig.nameMaxAge < 0 {
+		return fmt.Errorf("--name-max-age can't be negative")
+	}
+	if getConfig.nameMaxAge > 0 && getConfig.nameSource != nameSourceInformer {
+		return fmt.Errorf("--name-max-age requires --name-source=%v", nameSourceInformer)
+	}
+	if getConfig.resourceVersion != "" && subresource == "log" {
+		return fmt.Errorf("--resource-version isn't supported for the 'log' subresource, which is always read from the kubelet")
+	}
+	if err := checkFileDescriptors(getConfig.numClients); err != nil {
+		return err
+	}
+	clients := client.CreateKubeClients(loadKubeConfig(getCmd), getConfig.numClients)
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	var pool *namePool
+	var err error
+	switch getConfig.nameSource {
+	case nameSourceList:
+		pool, err = listNamePool(ctx, clients[0], getConfig.namespace, resource)
+	case nameSourceInformer:
+		pool, err = informerNamePool(ctx, clients[0], getConfig.namespace, resource)
+	default:
+		err = fmt.Errorf("unsupported --name-source value '%v'", getConfig.nameSource)
+	}
+	if err != nil {
+		return err
+	}
+	if err := preflightNames(ctx, clients[0], resource, pool); err != nil {
+		return err
+	}
+	if err := waitForStart(ctx); err != nil {
+		return err
+	}
+	if getConfig.nameMaxAge > 0 {
+		klog.V(1).Infof("Only getting the objects created in the last %v", getConfig.nameMaxAge)
+	}
+	klog.V(1).Infof("Getting '%v' objects in namespace '%v' from %v out of %v names (from %v) using %v clients and QPS = %v for %v",
+		getConfig.objectType,
+		getConfig.namespace,
+		getReadPath(),
+		pool.size(),
+		getConfig.nameSource,
+		getConfig.numClients,
+		getConfig.qps,
+		getConfig.totalDuration)
+	getObjects(ctx, clients, pool)
+	return nil
+}
+
+// Build a fixed name pool from a single list call.
+func listNamePool(ctx context.Context, client *kubernetes.Clientset, namespace, objectType string) (*namePool, error) {
+	list, err := client.CoreV1().RESTClient().Get().
+		Namespace(namespace).
+		Resource(objectType).
+		Do(ctx).
+		Get()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the object names: %v", err)
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil, err
+	}
+	pool := newNamePool()
+	for _, item := range items {
+		key, err := cache.MetaNamespaceKeyFunc(item)
+		if err != nil {
+			return nil, err
+		}
+		pool.add(key)
+	}
+	return pool, nil
+}
+
+// Build a name pool kept up to date by an informer running until the context is cancelled.
+func informerNamePool(ctx context.Context, client *kubernetes.Clientset, namespace, objectType string) (*namePool, error) {
+	factory := informers.NewSharedInformerFactoryWithOptions(client, 0, informers.WithNamespace(namespace))
+	informer, err := factory.ForResource(corev1.SchemeGroupVersion.WithResource(objectType))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported object type '%v': %v", objectType, err)
+	}
+	pool := newNamePool()
+	pool.maxAge = getConfig.nameMaxAge
+	informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			key, err := cache.MetaNamespaceKeyFunc(obj)
+			if err != nil {
+				return
+			}
+			if accessor, err := meta.Accessor(obj); err == nil {
+				pool.addCreated(key, accessor.GetCreationTimestamp().Time)
+			} else {
+				pool.add(key)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj); err == nil {
+				pool.remove(key)
+			}
+		},
+	})
+	factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.Informer().HasSynced) {
+		return nil, fmt.Errorf("informer for the object names failed to sync")
+	}
+	return pool, nil
+}
+
+// Where the get calls are served from, as implied by their resource version since the apiserver doesn't say.
+func getReadPath() string {
+	if getConfig.resourceVersion == "" {
+		return "etcd (quorum read)"
+	}
+	return "the watch cache"
+}
+
+func getObjects(ctx context.Context, clients []*kubernetes.Clientset, pool *namePool) {
+	start := time.Now()
+	ticker := time.NewTicker(time.Duration(1000000000.0/getConfig.qps) * time.Nanosecond)
+	defer ticker.Stop()
+
+	var totalCount, failedCount atomic.Uint64
+	latencies := util.NewLatencyTracker()
+	defer func() {
+		fc, tc := failedCount.Load(), totalCount.Load()
+		l := latencies.Summary()
+		klog.Infof("%d out of %d requests failed, failure rate: %v%%", fc, tc, float64(fc)/float64(tc)*100)
+		klog.Infof("Get latency (resource version '%v', served from %v): p50 = %v, p90 = %v, p99 = %v", getConfig.resourceVersion, getReadPath(), l.P50, l.P90, l.P99)
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for i := 0; time.Since(start) < getConfig.totalDuration; i++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			key, ok := pool.pick(rng)
+			if !ok {
+				klog.V(2).Info("No object names available, skipping get call")
+				continue
+			}
+			client := clients[i%len(clients)]
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				totalCount.Add(1)
+				if err := getOnce(ctx, client, key, latencies); err != nil {
+					failedCount.Add(1)
+					logRequestError("Error seen with get call: %v", err)
+				}
+			}()
+		}
+	}
+}
+
+func getOnce(ctx context.Context, client *kubernetes.Clientset, key string, latencies *util.LatencyTracker) error {
+	resource, subresource := splitSubresource(getConfig.objectType)
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	requestCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	rc, err := client.CoreV1().RESTClient().Get().
+		Namespace(namespace).
+		Resource(resource).
+		Name(name).
+		SubResource(subresource).
+		VersionedParams(&metav1.GetOptions{ResourceVersion: getConfig.resourceVersion}, scheme.ParameterCodec).
+		Stream(requestCtx)
+	if rc != nil {
+		io.Copy(ioutil.Discard, rc)
+		rc.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	latency := time.Since(start)
+	latencies.Record(latency)
+	klog.V(2).Infof("Get call for %v took: %v", key, latency)
+	return nil
+}
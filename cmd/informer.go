@@ -0,0 +1,161 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	"github.com/rcrozean/kube-stress/pkg/client"
+)
+
+type InformerConfig struct {
+	namespace     string
+	objectType    string
+	numInformers  int
+	resyncPeriod  time.Duration
+	totalDuration time.Duration
+}
+
+var (
+	informerConfig *InformerConfig
+	informerCmd    *cobra.Command
+)
+
+func init() {
+	informerConfig = &InformerConfig{}
+	informerCmd = &cobra.Command{
+		Use:   "informer",
+		Short: "Run shared informers (list+watch+resync) for objects of a given type in the cluster",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := informerCommand(); err != nil {
+				klog.Errorf("Error executing informer command: %v", err)
+				os.Exit(1)
+			}
+		},
+	}
+	rootCmd.AddCommand(informerCmd)
+	informerCmd.Flags().StringVar(&informerConfig.namespace, "namespace", KubeStress, "Namespace to inform on (empty value means all namespaces)")
+	informerCmd.Flags().StringVar(&informerConfig.objectType, "object-type", "configmaps", "Type of objects to inform on (any core/v1 resource, e.g 'pods' and 'configmaps')")
+	informerCmd.Flags().IntVar(&informerConfig.numInformers, "num-informers", 10, "Number of informers to run, each with its own client")
+	informerCmd.Flags().DurationVar(&informerConfig.resyncPeriod, "resync-period", 0, "Resync period of the informers (0 means no resyncs)")
+	informerCmd.Flags().DurationVar(&informerConfig.totalDuration, "total-duration", 5*time.Minute, "Total duration for which to run this command")
+}
+
+// Events handled by a single informer.
+type informerStats struct {
+	syncTime time.Duration
+	adds     atomic.Uint64
+	updates  atomic.Uint64
+	deletes  atomic.Uint64
+	resyncs  atomic.Uint64
+	numItems int
+}
+
+func informerCommand() error {
+	clients := client.CreateKubeClients(loadKubeConfig(informerCmd), informerConfig.numInformers)
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	if err := waitForStart(ctx); err != nil {
+		return err
+	}
+	klog.V(1).Infof("Running %v informers for '%v' objects in namespace '%v' with resync period %v for %v",
+		informerConfig.numInformers,
+		informerConfig.objectType,
+		informerConfig.namespace,
+		informerConfig.resyncPeriod,
+		informerConfig.totalDuration)
+
+	gvr := corev1.SchemeGroupVersion.WithResource(informerConfig.objectType)
+	stats := make([]*informerStats, len(clients))
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i, c := range clients {
+		factory := informers.NewSharedInformerFactoryWithOptions(c, informerConfig.resyncPeriod, informers.WithNamespace(informerConfig.namespace))
+		informer, err := factory.ForResource(gvr)
+		if err != nil {
+			return fmt.Errorf("unsupported object type '%v': %v", informerConfig.objectType, err)
+		}
+		s := &informerStats{}
+		stats[i] = s
+		informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) { s.adds.Add(1) },
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				// Resyncs redeliver the cached object, so its resourceVersion doesn't change.
+				oldMeta, oldErr := meta.Accessor(oldObj)
+				newMeta, newErr := meta.Accessor(newObj)
+				if oldErr == nil && newErr == nil && oldMeta.GetResourceVersion() == newMeta.GetResourceVersion() {
+					s.resyncs.Add(1)
+					return
+				}
+				s.updates.Add(1)
+			},
+			DeleteFunc: func(obj interface{}) { s.deletes.Add(1) },
+		})
+		factory.Start(ctx.Done())
+
+		wg.Add(1)
+		go func(i int, hasSynced cache.InformerSynced, store cache.Store) {
+			defer wg.Done()
+			if !cache.WaitForCacheSync(ctx.Done(), hasSynced) {
+				klog.Errorf("Informer %d failed to sync", i)
+				return
+			}
+			stats[i].syncTime = time.Since(start)
+			stats[i].numItems = len(store.ListKeys())
+			klog.V(2).Infof("Informer %d synced %d objects in %v", i, stats[i].numItems, stats[i].syncTime)
+		}(i, informer.Informer().HasSynced, informer.Informer().GetStore())
+	}
+	wg.Wait()
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(informerConfig.totalDuration - time.Since(start)):
+	}
+	cancel()
+	reportInformerStats(stats, time.Since(start))
+	return nil
+}
+
+func reportInformerStats(stats []*informerStats, elapsed time.Duration) {
+	var events, resyncs, fullResyncs uint64
+	var maxSyncTime time.Duration
+	for i, s := range stats {
+		klog.V(1).Infof("Informer %d: synced in %v, %d adds, %d updates, %d deletes, %d resync notifications",
+			i, s.syncTime, s.adds.Load(), s.updates.Load(), s.deletes.Load(), s.resyncs.Load())
+		events += s.adds.Load() + s.updates.Load() + s.deletes.Load()
+		resyncs += s.resyncs.Load()
+		if s.numItems > 0 {
+			fullResyncs += s.resyncs.Load() / uint64(s.numItems)
+		}
+		if s.syncTime > maxSyncTime {
+			maxSyncTime = s.syncTime
+		}
+	}
+	klog.Infof("Slowest informer took %v to sync", maxSyncTime)
+	klog.Infof("Handled %d events (%.2f events/s) and %d resync notifications (~%d full resyncs) across %d informers",
+		events, float64(events)/elapsed.Seconds(), resyncs, fullResyncs, len(stats))
+}
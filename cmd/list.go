@@ -16,40 +16,255 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"maps"
+	"math"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
-	"os/signal"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
 
 	"github.com/rcrozean/kube-stress/pkg/client"
 	"github.com/rcrozean/kube-stress/pkg/util"
+	"github.com/rcrozean/kube-stress/pkg/version"
 )
 
 type ListConfig struct {
-	namespace         string
-	objectType        string
-	pageSize          int
-	numClients        int
-	qps               float32
-	totalDuration     time.Duration
-	csvOutputFilepath string
+	namespace              string
+	objectType             string
+	fieldSelector          string
+	eventsFor              string
+	labelSelectors         []string
+	contentType            string
+	pageSize               int
+	pageSizeMin            int
+	pageSizeMax            int
+	resourceVersion        string
+	rvMatch                string
+	cached                 bool
+	numClients             int
+	qps                    float32
+	totalDuration          time.Duration
+	requestTimeout         time.Duration
+	timeoutJitter          time.Duration
+	maxResponseBytes       int64
+	maxRetries             int
+	retryBudgetRatio       float64
+	annotatePeriod         time.Duration
+	annotateWindow         time.Duration
+	adaptiveLogging        bool
+	errorLogBurst          int
+	csvOutputFilepath      string
+	jsonlFilepath          string
+	influxOutput           string
+	influxPrecision        string
+	sampleRate             float64
+	maxMemory              string
+	estimator              string
+	manifestFilepath       string
+	summaryFilepath        string
+	ignoreNotFound         bool
+	warmupConnections      bool
+	staggerClientStart     time.Duration
+	listPath               string
+	createNamespace        bool
+	deleteNamespace        bool
+	abortOnFirstError      bool
+	workerModel            string
+	asTable                bool
+	hedgeAfter             time.Duration
+	serializePerClient     bool
+	namespaceWeights       string
+	targetNamespaces       int
+	deleteNamespaces       bool
+	sizeSeries             []int
+	seedSizeSeries         bool
+	seedObjectSize         int
+	drainTimeout           time.Duration
+	reuseListOptions       bool
+	measureDecode          bool
+	strictRoundRobin       bool
+	clientImbalance        float64
+	throughputVerdict      bool
+	clientDelay            time.Duration
+	clientDelayJitter      time.Duration
+	clientDelayPhase       string
+	samplesEndpoint        string
+	samplesBufferSize      int
+	csvColumns             string
+	followContinue         bool
+	restartExpiredContinue bool
+
+	singleConnection       bool
+	retryOn                string
+	summaryConfigMap       string
+	maxClients             int
+	scaleInterval          time.Duration
+	compareProtocols       bool
+	csvBufferSize          int
+	csvBackpressure        string
+	csvAppend              bool
+	scrapeMetrics          bool
+	failureSampleBody      int
+	failureSampleFilepath  string
+	tracePhasesOutput      string
+	tracePhasesSampleRate  float64
+	histogramFilepath      string
+	warmCacheFirst         bool
+	concurrencySweep       bool
+	sweepMaxClients        int
+	sweepTrialDuration     time.Duration
+	selectorSweepKey       string
+	selectorCardinality    int
+	selectorSweepFractions []float64
+
+	adaptiveConcurrency  bool
+	maxConcurrency       int
+	timeseriesFilepath   string
+	timeseriesInterval   time.Duration
+	restartErrors        int
+	restartWindow        time.Duration
+	protobufJSONFallback bool
+	reportEveryN         int
+	plotFilepath         string
+	dispatchBuffer       int
+	dispatchers          int
+	serverTiming         bool
+
+	plotCDF  bool
+	clusters []string
 }
 
+// Supported values for --content-type.
+const (
+	contentTypeJSON     = "json"
+	contentTypeProtobuf = "protobuf"
+)
+
+// Supported values for --list-path.
+const (
+	listPathREST    = "rest"
+	listPathTyped   = "typed"
+	listPathDynamic = "dynamic"
+)
+
+// Supported values for --worker-model.
+const (
+	workerModelShared    = "shared"
+	workerModelPerClient = "per-client"
+)
+
+// Response headers set by API Priority and Fairness, identifying what classified and throttled a request.
+const (
+	flowSchemaUIDHeader    = "X-Kubernetes-PF-FlowSchema-UID"
+	priorityLevelUIDHeader = "X-Kubernetes-PF-PriorityLevel-UID"
+)
+
+// Classes of errors supported by --retry-on.
+var retryClasses = []string{"429", "5xx", "etcd-overload", "conn-refused", "timeout", "eof"}
+
+// Messages of the etcd errors relayed in 5xx responses when the storage layer, rather than the apiserver, is overloaded.
+var etcdOverloadMessages = []string{"etcdserver: too many requests", "etcdserver: request timed out"}
+
+// Returned for list calls whose response body took longer than --drain-timeout to read.
+var errDrainTimeout = errors.New("drain timeout reading the response body")
+
+// Failure of a list followed with --follow-continue whose continue token expired before the last page.
+var errExpiredContinue = errors.New("expired continue token")
+
+// Restarts of a list with --restart-on-expired-continue before giving up on it.
+const maxExpiredContinueRestarts = 3
+
+// Accept header used by kubectl to get server-side printed lists.
+const tableAcceptHeader = "application/json;as=Table;g=meta.k8s.io;v=v1"
+
+const (
+	// Connections are kept alive, so seeing more TLS handshakes per client than this over a run is suspicious.
+	maxExpectedHandshakesPerClient = 3
+	// How long a list call may run past the end of the total duration before it gets cancelled.
+	runEndGracePeriod = 5 * time.Second
+	// Number of retries permitted before the retry budget has accumulated any tokens.
+	retryBudgetReserve = 10
+	// How often suppressed errors are summarized when adaptive error logging is on.
+	errorLogSummaryInterval = 30 * time.Second
+	// Fraction of the requested QPS below which the achieved QPS is considered lagging, for --max-clients.
+	qpsShortfallRatio = 0.9
+	// Number of consecutive lagging --scale-interval periods before adding clients.
+	qpsShortfallPeriods = 2
+)
+
 var (
 	listConfig *ListConfig
 	listCmd    *cobra.Command
-	csvWriter  *util.ThreadSafeCsvWriter
+	csvWriter  util.CsvWriter
+	csvBuffer  *util.BufferedCsvWriter
+	// Sinks getting the rows of the successful list calls, e.g the CSV output.
+	resultSinks []ResultSink
+	// Rows of list_id, status, error, body and run_id written with --failure-sample-filepath.
+	failureBodyWriter *util.ThreadSafeCsvWriter
+	// Rows of per-interval metrics written with --timeseries-output-filepath.
+	timeseriesWriter *util.ThreadSafeCsvWriter
+	// Only created when listing through the dynamic client, indexed like the typed clients.
+	dynamicClients []dynamic.Interface
+	// Only set with --namespace-weights.
+	listNamespaceChoice *util.WeightedChoice
+	// Label selectors of the list calls with --label-selectors.
+	listSelectorChoice *util.WeightedChoice
+	// Only set with --samples-endpoint.
+	sampleBuffer *util.SampleBuffer
+	// Classes of errors selected by --retry-on.
+	retryOn = map[string]bool{}
+	// Columns of the CSV output, in order.
+	csvColumns = defaultListCSVColumns
+	// How the watch cache was confirmed warm before the run with --warm-cache-first.
+	cacheWarmup string
+	// Steps run once the list command is done, whichever way it ends.
+	listCleanups = &cleanups{}
+	// Latencies of the successful calls across all the clusters, only set with --clusters.
+	aggregateLatencies *util.LatencyTracker
+	// Serializes the reports of the runs against several clusters with --clusters.
+	reportLock sync.Mutex
+	// Resource and API group (empty for core) of the listed --object-type.
+	listResource string
+	listGroup    string
+	// Soft budget of the heap size in bytes with --max-memory, 0 for none.
+	listMaxMemory int64
+	// Sender of the list calls, replaceable by a fake returning controlled latencies and errors to drive the
+	// dispatch loop and the stats without a cluster.
+	listRequests listRequester = apiserverListRequester{}
 )
 
 func init() {
@@ -59,47 +274,561 @@ func init() {
 		Short: "List objects of a given type in the cluster",
 		Run: func(cmd *cobra.Command, args []string) {
 			if listConfig.csvOutputFilepath != "" {
-				csvWriter = util.NewThreadSafeCsvWriter(listConfig.csvOutputFilepath)
-				defer csvWriter.Flush()
+				csvBuffer = util.NewBufferedCsvWriter(listConfig.csvOutputFilepath, listConfig.csvBufferSize, listConfig.csvBackpressure, listConfig.csvAppend)
+				resultSinks = append(resultSinks, &csvResultSink{writer: csvBuffer})
+			}
+			if listConfig.jsonlFilepath != "" {
+				sink, err := newJSONResultSink(listConfig.jsonlFilepath)
+				if err != nil {
+					exitOnError(cmd.Name(), fmt.Errorf("failed to create the JSON output: %v", err))
+				}
+				resultSinks = append(resultSinks, sink)
+			}
+			if listConfig.influxOutput != "" {
+				sink, err := newInfluxResultSink(listConfig.influxOutput, listConfig.influxPrecision)
+				if err != nil {
+					exitOnError(cmd.Name(), fmt.Errorf("failed to create the Influx output: %v", err))
+				}
+				resultSinks = append(resultSinks, sink)
+			}
+			for _, sink := range resultSinks {
+				listCleanups.add(cleanupFlushOutputs, "close the result sink", sink.Close)
 			}
-			if err := listCommand(); err != nil {
-				klog.Errorf("Error executing list command: %v", err)
-				os.Exit(1)
+			if listConfig.tracePhasesOutput != "" {
+				writer, err := newPhaseTraceWriter(listConfig.tracePhasesOutput)
+				if err != nil {
+					exitOnError(cmd.Name(), fmt.Errorf("failed to create the phase traces output: %v", err))
+				}
+				phaseTraces = writer
+				listCleanups.add(cleanupFlushOutputs, "close the phase traces", writer.Close)
+			}
+			if listConfig.failureSampleFilepath != "" {
+				failureBodyWriter = util.NewThreadSafeCsvWriter(listConfig.failureSampleFilepath)
+				listCleanups.add(cleanupFlushOutputs, "flush the failure samples", failureBodyWriter.Flush)
 			}
+			if listConfig.timeseriesFilepath != "" {
+				timeseriesWriter = util.NewThreadSafeCsvWriter(listConfig.timeseriesFilepath)
+				timeseriesWriter.Write(timeseriesCSVHeader)
+				listCleanups.add(cleanupFlushOutputs, "flush the time series", timeseriesWriter.Flush)
+			}
+			err := listCommand()
+			listCleanups.run()
+			exitOnError(cmd.Name(), err)
 		},
 	}
 	rootCmd.AddCommand(listCmd)
 	listCmd.Flags().StringVar(&listConfig.namespace, "namespace", KubeStress, "Namespace to list the objects from (empty value means all namespaces)")
-	listCmd.Flags().StringVar(&listConfig.objectType, "object-type", "configmaps", "Type of objects to create (supported values are 'pods' and 'configmaps'")
+	listCmd.Flags().BoolVar(&listConfig.createNamespace, "create-namespace", false, "Create the namespace before listing if it doesn't exist")
+	listCmd.Flags().BoolVar(&listConfig.deleteNamespace, "delete-namespace-on-exit", false, "Delete the namespace and all its contents on exit")
+	listCmd.Flags().IntVar(&listConfig.targetNamespaces, "target-namespace-count", 0, "Spread the list calls uniformly across this many namespaces named '<namespace>-<index>', creating the missing ones labeled with the run ID (0 means only --namespace)")
+	listCmd.Flags().BoolVar(&listConfig.deleteNamespaces, "delete-namespaces-on-exit", false, "Delete the namespaces created for --target-namespace-count or --size-series on exit, along with their contents (the existing ones are kept)")
+	listCmd.Flags().IntSliceVar(&listConfig.sizeSeries, "size-series", nil, "Comma-separated object counts (e.g '100,1000,10000,100000'), spreading the list calls uniformly across namespaces named '<namespace>-size-<count>' holding that many objects, and reporting the latency by collection size")
+	listCmd.Flags().BoolVar(&listConfig.seedSizeSeries, "seed-size-series", false, "Create the configmaps missing from the --size-series namespaces (and the missing namespaces) before the run")
+	listCmd.Flags().IntVar(&listConfig.seedObjectSize, "seed-object-size-bytes", 1000, "Size of each configmap created by --seed-size-series")
+	listCmd.Flags().StringVar(&listConfig.namespaceWeights, "namespace-weights", "", "Pick the namespace of each list call with these weights, e.g 'ns1=80,ns2=15,ns3=5' (replaces --namespace)")
+	listCmd.Flags().StringVar(&listConfig.objectType, "object-type", "configmaps", "Type of objects to list, any core/v1 resource or a resource of a supported group as '<resource>.<group>' (e.g 'events.events.k8s.io')")
+	listCmd.Flags().StringVar(&listConfig.fieldSelector, "field-selector", "", "Field selector of the list calls, e.g 'status.phase=Running'")
+	listCmd.Flags().StringVar(&listConfig.eventsFor, "events-for", "", "List the events of the object '[<namespace>/]<name>', through the involvedObject (or regarding) field selector")
+	listCmd.Flags().StringArrayVar(&listConfig.labelSelectors, "label-selectors", nil, "Label selector picked for each list call, repeated to rotate through several selectors, optionally weighted as '<selector>:<weight>' (e.g 'app=web:3')")
+	listCmd.Flags().BoolVar(&listConfig.protobufJSONFallback, "protobuf-accept-json-fallback", true, "With --content-type=protobuf, accept JSON responses for the resources the server can't serve as protobuf (when false, the run aborts on the first one)")
+	listCmd.Flags().StringVar(&listConfig.contentType, "content-type", contentTypeJSON, "Content type to request the lists in: 'json' or 'protobuf' (the served content type is reported, as not all resources support protobuf)")
 	listCmd.Flags().IntVar(&listConfig.pageSize, "page-size", 0, "Number of objects to list in a single page, i.e `limit` param (0 means no pagination)")
+	listCmd.Flags().IntVar(&listConfig.pageSizeMin, "page-size-min", 0, "Lower bound of the random page size picked for each list call (only used with --page-size-max)")
+	listCmd.Flags().IntVar(&listConfig.pageSizeMax, "page-size-max", 0, "Upper bound of the random page size picked for each list call (0 means use --page-size for every call)")
+	listCmd.Flags().BoolVar(&listConfig.followContinue, "follow-continue", false, "Follow the continue tokens to list all the pages, writing a CSV row per page besides the one for the whole list (only for --list-path=rest)")
+	listCmd.Flags().BoolVar(&listConfig.restartExpiredContinue, "restart-on-expired-continue", false, "With --follow-continue, restart a list from its first page when its continue token expired (410 after an etcd compaction), up to "+fmt.Sprint(maxExpiredContinueRestarts)+" times, instead of failing it")
+	listCmd.Flags().StringVar(&listConfig.resourceVersion, "resource-version", "", "ResourceVersion to set on the list calls (empty means the most recent, i.e a quorum read)")
+	// With a page size, the first page is served at the requested resourceVersion and the following
+	// pages share its snapshot, so 'Exact' makes every page of a paginated list read from etcd.
+	listCmd.Flags().StringVar(&listConfig.rvMatch, "resource-version-match", "", "ResourceVersionMatch to set on the list calls ('NotOlderThan' or 'Exact', which requires a non-zero --resource-version)")
+	listCmd.Flags().BoolVar(&listConfig.cached, "cached", false, "Serve the list calls from the watch cache (resourceVersion=0) instead of doing quorum reads (mutually exclusive with the resource version flags)")
+	listCmd.Flags().StringVar(&listConfig.listPath, "list-path", listPathREST, "Client used for the list calls: 'rest' (raw REST client, response is only drained), 'typed' (typed clientset, only for pods and configmaps) or 'dynamic' (dynamic client)")
+	listCmd.Flags().BoolVar(&listConfig.asTable, "as-table", false, "Ask for server-side printed Tables (like 'kubectl get') instead of plain lists (only for --list-path=rest)")
+	listCmd.Flags().StringSliceVar(&listConfig.clusters, "clusters", nil, "Comma-separated kubeconfig contexts (of --kubeconfig) or kubeconfig file paths of clusters to list from simultaneously, each with its own clients, reporting per-cluster and aggregate results")
 	listCmd.Flags().IntVar(&listConfig.numClients, "num-clients", 10, "Number of clients to use for spreading the list calls")
+	listCmd.Flags().IntVar(&listConfig.maxClients, "max-clients", 0, "Add clients during the run, up to this many, while the achieved QPS persistently lags the requested one (0 means a fixed --num-clients)")
+	listCmd.Flags().DurationVar(&listConfig.scaleInterval, "scale-interval", 10*time.Second, "Interval over which the achieved QPS is compared to the requested one for --max-clients")
+	listCmd.Flags().BoolVar(&listConfig.adaptiveConcurrency, "adaptive-concurrency", false, "Instead of pacing at --qps, keep as many list calls in flight as an adaptive limiter allows, starting at --num-clients and growing while the latency stays flat")
+	listCmd.Flags().IntVar(&listConfig.maxConcurrency, "max-concurrency", 1000, "Upper bound of the in-flight list calls with --adaptive-concurrency")
+	listCmd.Flags().BoolVar(&listConfig.concurrencySweep, "concurrency-sweep", false, "Run short trials doubling the client count from --num-clients until the throughput plateaus or the latency degrades, and report the knee point")
+	listCmd.Flags().IntVar(&listConfig.sweepMaxClients, "sweep-max-clients", 256, "Largest client count tried by --concurrency-sweep")
+	listCmd.Flags().DurationVar(&listConfig.sweepTrialDuration, "sweep-trial-duration", 30*time.Second, "Duration of each --concurrency-sweep or --selector-cardinality-sweep trial")
+	listCmd.Flags().StringVar(&listConfig.selectorSweepKey, "selector-cardinality-sweep", "", "Label key whose values are 'value-0' to 'value-<N-1>' evenly spread over the objects (as set by create's --payload-label-keys), running a trial per --selector-sweep-fractions with a selector matching that fraction of them")
+	listCmd.Flags().IntVar(&listConfig.selectorCardinality, "selector-cardinality", 10, "Number of distinct values N of the --selector-cardinality-sweep label")
+	listCmd.Flags().Float64SliceVar(&listConfig.selectorSweepFractions, "selector-sweep-fractions", []float64{0.01, 0.1, 0.5, 1}, "Fractions of the objects matched by the selectors of the --selector-cardinality-sweep trials, rounded to a whole number of label values")
+	listCmd.Flags().BoolVar(&listConfig.compareProtocols, "compare-protocols", false, "Run the workload over HTTP/2 then for as long over HTTP/1.1, and print a comparison of both runs")
+	listCmd.Flags().BoolVar(&listConfig.scrapeMetrics, "scrape-apiserver-metrics", false, "Scrape the apiserver /metrics before and after the run, and record the change of the request and etcd series in the summary")
+	listCmd.Flags().IntVar(&listConfig.failureSampleBody, "failure-sample-body", 0, "Record the status and response body of the first N failed list calls")
+	listCmd.Flags().StringVar(&listConfig.tracePhasesOutput, "trace-phases-output", "", "Path to a JSON file getting the client-side phases (rate limiter wait, dial, TLS handshake, send, time to first byte, body drain) of the requests of a sample of the list calls, as spans in the Chrome trace event format for trace viewers and flamegraphs")
+	listCmd.Flags().Float64Var(&listConfig.tracePhasesSampleRate, "trace-phases-sample-rate", 0.01, "Fraction of the list calls, picked at random (see --seed), whose phases get written to --trace-phases-output")
+	listCmd.Flags().StringVar(&listConfig.failureSampleFilepath, "failure-sample-filepath", "", "Path to a CSV file for the failed responses recorded with --failure-sample-body (logged when empty)")
+	listCmd.Flags().IntVar(&listConfig.restartErrors, "restart-detection-errors", 10, "Number of connection-level failures (refused connections, EOFs) within --restart-detection-window reported as a possible apiserver restart (0 disables the detection)")
+	listCmd.Flags().DurationVar(&listConfig.restartWindow, "restart-detection-window", 5*time.Second, "Window of the connection-level failures counted by --restart-detection-errors")
+	listCmd.Flags().IntVar(&listConfig.reportEveryN, "report-every-n-requests", 0, "Log a progress line (and end the --timeseries-output-filepath intervals) every N completed list calls instead of every --timeseries-interval")
+	listCmd.Flags().StringVar(&listConfig.timeseriesFilepath, "timeseries-output-filepath", "", "Path to an output CSV file getting a row of metrics (requests, failures, p50, p99, achieved QPS, in flight) every --timeseries-interval")
+	listCmd.Flags().DurationVar(&listConfig.timeseriesInterval, "timeseries-interval", 10*time.Second, "Interval covered by each row of --timeseries-output-filepath")
+	listCmd.Flags().StringVar(&listConfig.plotFilepath, "plot-output-filepath", "", "Path to an output SVG file plotting the latency distribution of the successful list calls")
+	listCmd.Flags().BoolVar(&listConfig.plotCDF, "plot-cdf", false, "Overlay the CDF of the latencies on the --plot-output-filepath plot")
+	listCmd.Flags().BoolVar(&listConfig.serverTiming, "measure-apiserver-queue-wait", false, "Break the latency of the successful list calls down by the stages (e.g APF queue wait, authn, authz, etcd, serialization) reported in the Server-Timing response headers, when the apiserver or a proxy in front of it emits them")
+	listCmd.Flags().StringVar(&listConfig.histogramFilepath, "histogram-output-filepath", "", "Path to the output HdrHistogram log of the latencies of the successful list calls (in microseconds), mergeable across runs")
+	listCmd.Flags().BoolVar(&listConfig.warmCacheFirst, "warm-cache-first", false, "Before the run, open a watch and wait for the watch cache to be confirmed in sync, so cached lists don't hit a cold cache")
+	listCmd.Flags().StringVar(&listConfig.workerModel, "worker-model", workerModelShared, "How list calls are issued: 'shared' (a new goroutine per call, clients used round-robin) or 'per-client' (one worker per client, pulling calls from a shared queue)")
+	listCmd.Flags().IntVar(&listConfig.dispatchBuffer, "dispatch-buffer", 0, "With the shared worker model, queue the ticks in a buffer of this depth drained by a fixed pool of --dispatchers goroutines instead of spawning the calls from the ticker (0 to disable)")
+	listCmd.Flags().IntVar(&listConfig.dispatchers, "dispatchers", 4, "Number of goroutines draining the --dispatch-buffer")
+	listCmd.Flags().BoolVar(&listConfig.strictRoundRobin, "strict-round-robin", false, "Hand the calls to the clients strictly in turn, advancing only on dispatched calls (by default the turn follows the iterations of the dispatch loop, which other events like new --timeseries-output-filepath rows advance too); requires the shared worker model")
+	listCmd.Flags().Float64Var(&listConfig.clientImbalance, "client-imbalance-threshold", 0.1, "Flag the run with a client-imbalance event when a client made more than this fraction more or fewer calls than the clients' mean (not checked with --max-clients, whose added clients start late)")
+	listCmd.Flags().BoolVar(&listConfig.throughputVerdict, "throughput-verdict", false, "Trace the client-side waits of every request and, at the end of the run, correlate them with the retries, 429s and server errors into a verdict of what limited the throughput: the client QPS, the client connection pool, server APF or the server capacity")
+	listCmd.Flags().BoolVar(&listConfig.serializePerClient, "serialize-per-client", false, "Never have two list calls in flight on the same client, to measure single-stream round-trip latency (calls wait for the previous one of their client)")
 	listCmd.Flags().Float32Var(&listConfig.qps, "qps", 2.0, "QPS to generate for the list calls")
 	listCmd.Flags().DurationVar(&listConfig.totalDuration, "total-duration", 5*time.Minute, "Total duration for which to run this command")
+	listCmd.Flags().DurationVar(&listConfig.requestTimeout, "request-timeout", 60*time.Second, "Timeout for each list call (capped so no call outlives the total duration by more than a short grace period)")
+	listCmd.Flags().DurationVar(&listConfig.timeoutJitter, "timeout-jitter", 0, "Random jitter added to or subtracted from the timeout of each list call")
+	listCmd.Flags().DurationVar(&listConfig.clientDelay, "client-delay", 0, "Artificial delay of every list call on the client side, to model slow clients (excluded from the reported latencies)")
+	listCmd.Flags().DurationVar(&listConfig.clientDelayJitter, "client-delay-jitter", 0, "Randomize each --client-delay by up to this much either way")
+	listCmd.Flags().StringVar(&listConfig.clientDelayPhase, "client-delay-phase", clientDelaySend, "When the --client-delay happens: 'send' (before sending the call, occupying the client) or 'drain' (after the response headers, keeping the call in flight on the server; requires --list-path=rest)")
+	listCmd.Flags().BoolVar(&listConfig.reuseListOptions, "reuse-list-options", false, "Encode the query parameters of each distinct set of list options once and reuse them, rather than running the options through the parameter codec on every call, which costs client CPU at high QPS (the pages after the first with --follow-continue are still encoded); applies to --list-path=rest")
+	listCmd.Flags().BoolVar(&listConfig.measureDecode, "measure-decode", false, "Decode every list response into typed objects with the codec of its content type (JSON or protobuf) and record the decode time and object count, excluded from the latencies which are then the network time; requires --list-path=rest")
+	listCmd.Flags().DurationVar(&listConfig.drainTimeout, "drain-timeout", 0, "Abort reading a list response body still streaming after this long, counting it as a drain timeout (0 means only bounded by --request-timeout); applies to --list-path=rest")
+	listCmd.Flags().Int64Var(&listConfig.maxResponseBytes, "max-response-bytes", 0, "Stop reading a list response once this many bytes were read, marking it as truncated (0 means no limit)")
+	listCmd.Flags().DurationVar(&listConfig.annotatePeriod, "annotate-period", 0, "Period of a recurring window (e.g matching the etcd compaction interval) whose samples get annotated in the CSV and summary (0 means disabled)")
+	listCmd.Flags().DurationVar(&listConfig.annotateWindow, "annotate-window", 30*time.Second, "Length of the annotated window at the start of every --annotate-period")
+	listCmd.Flags().DurationVar(&listConfig.staggerClientStart, "stagger-client-start", 0, "Spread the first calls of the --num-clients clients evenly over this window, each client joining the rotation in turn (the QPS stays the same), instead of all of them starting at once")
+	listCmd.Flags().BoolVar(&listConfig.warmupConnections, "warmup-connections", false, "Establish a connection for each client (using a cheap '/version' call) before starting the timed list calls, reporting the connection setup times and failures")
+	listCmd.Flags().BoolVar(&listConfig.singleConnection, "single-connection", false, "Make all the clients share a single transport limited to one connection, multiplexing all the list calls over it (to study head-of-line blocking)")
+	listCmd.Flags().IntVar(&listConfig.maxRetries, "max-retries", 0, "Maximum number of times a list call failing with a retriable error (429, 5xx, connection errors) is retried")
+	listCmd.Flags().StringVar(&listConfig.retryOn, "retry-on", "429,5xx,conn-refused,eof", "Comma-separated classes of errors to retry: '429', '5xx' (including 'etcd-overload'), 'etcd-overload' (5xx relaying an overloaded etcd), 'conn-refused', 'timeout' (network timeouts, not --request-timeout) and 'eof' (connections closed or reset)")
+	listCmd.Flags().Float64Var(&listConfig.retryBudgetRatio, "retry-budget-ratio", 0.1, "Maximum ratio of retries to recent list calls, retries beyond it are suppressed to avoid amplifying load")
+	listCmd.Flags().DurationVar(&listConfig.hedgeAfter, "hedge-after", 0, "Send a duplicate of a list call on another client if it hasn't returned after this long, the first response winning (0 means disabled)")
+	listCmd.Flags().BoolVar(&listConfig.ignoreNotFound, "ignore-not-found", false, "Count 'not found' responses separately instead of as failures")
+	listCmd.Flags().BoolVar(&listConfig.adaptiveLogging, "verbosity-adaptive", false, "Only log the first few occurrences of each distinct error, followed by periodic summaries")
+	listCmd.Flags().IntVar(&listConfig.errorLogBurst, "error-log-burst", 10, "Number of occurrences of each distinct error to log before summarizing (only used with --verbosity-adaptive)")
+	listCmd.Flags().BoolVar(&listConfig.abortOnFirstError, "abort-on-first-error", false, "Stop the run at the first failed list call, dumping its request, response headers and error (useful for debugging flag combinations)")
 	listCmd.Flags().StringVar(&listConfig.csvOutputFilepath, "csv-output-filepath", "", "Path to the output CSV file where latency values will be written")
+	listCmd.Flags().Float64Var(&listConfig.sampleRate, "sample-rate", 1.0, "Fraction of the successful list calls, picked at random (see --seed), written to the CSV and JSON outputs (the summaries and histograms still cover all the calls)")
+	listCmd.Flags().StringVar(&listConfig.jsonlFilepath, "jsonl-output-filepath", "", "Path to an output file getting the --csv-columns of each successful list call as a JSON object per line, alongside or instead of the CSV output")
+	listCmd.Flags().StringVar(&listConfig.estimator, "estimator", "hdr", "Percentile estimator of the latencies once --max-memory stops keeping all the samples: 'hdr' (HdrHistogram up to 1h, accurate to 3 significant digits) or 'tdigest' (t-digest, adapting to any range of latencies)")
+	listCmd.Flags().StringVar(&listConfig.maxMemory, "max-memory", "", "Soft budget of the heap size (e.g '2Gi'), past "+fmt.Sprint(memoryDowngradeFraction*100)+"% of which the latencies are kept as --estimator estimates rather than all the samples and fewer rows are sampled to the outputs, so long runs complete instead of running out of memory")
+	listCmd.Flags().StringVar(&listConfig.influxOutput, "influx-output", "", "File path, or HTTP(S) URL of an InfluxDB write endpoint, getting a '"+influxMeasurement+"' point in line protocol for each successful list call (tagged by result, resource and namespace, with latency_ms and bytes fields)")
+	listCmd.Flags().StringVar(&listConfig.influxPrecision, "influx-precision", "ns", "Precision of the timestamps of --influx-output ('ns', 'us', 'ms' or 's')")
+	listCmd.Flags().IntVar(&listConfig.csvBufferSize, "csv-buffer-size", 10000, "Number of CSV rows buffered while waiting to be written to the output file")
+	listCmd.Flags().BoolVar(&listConfig.csvAppend, "csv-append", false, "Append the rows to --csv-output-filepath instead of overwriting it, to accumulate runs into one file (the header of --csv-columns is only written to an empty file)")
+	listCmd.Flags().StringVar(&listConfig.csvBackpressure, "csv-backpressure", util.CsvBackpressureBlock, "What to do with CSV rows while the buffer is full: 'block' the list call, 'drop' the row or 'sample' the rows down once the buffer is half full")
+	listCmd.Flags().StringVar(&listConfig.csvColumns, "csv-columns", "", "Comma-separated, ordered list of the CSV columns to write, preceded by a header row (defaults to 'latency,page_size,truncated,annotated,run_id' without a header)")
+	listCmd.Flags().StringVar(&listConfig.summaryFilepath, "summary-output-filepath", "", "Path to the output JSON file where the run summary will be written")
+	listCmd.Flags().StringVar(&listConfig.summaryConfigMap, "summary-configmap", "", "ConfigMap ('<namespace>/<name>') to write the JSON run summary into at the end of the run, created if needed")
+	listCmd.Flags().StringVar(&listConfig.samplesEndpoint, "samples-endpoint", "", "Address (e.g ':8080') to serve the latency samples collected since the previous scrape on, at '/samples' (empty means disabled)")
+	listCmd.Flags().IntVar(&listConfig.samplesBufferSize, "samples-buffer-size", 10000, "Number of samples kept for the samples endpoint between two scrapes, older ones being overwritten")
+	listCmd.Flags().StringVar(&listConfig.manifestFilepath, "manifest-output-filepath", "", "Path to the output JSON file where the run manifest (effective config, server, identity, version) will be written")
 }
 
 func listCommand() error {
-	clients := client.CreateKubeClients(client.GetKubeConfig(kubeconfig), listConfig.numClients)
-
-	// Setup signal handling for the process.
-	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
-	ctx, cancel := context.WithCancel(context.Background())
-	var once sync.Once
-	defer once.Do(cancel)
-	go func() {
-		for {
-			select {
-			case sig := <-sigs:
-				klog.V(1).Infof("Received a stop signal: %v", sig)
-				once.Do(cancel)
-			case <-ctx.Done():
-				klog.V(1).Info("Cancelled context and exiting program")
-				return
+	if err := checkQPSPerClient(listConfig.qps, listConfig.numClients); err != nil {
+		return err
+	}
+	if listConfig.timeoutJitter >= listConfig.requestTimeout {
+		return fmt.Errorf("--timeout-jitter must be smaller than --request-timeout")
+	}
+	if listConfig.pageSizeMax > 0 && (listConfig.pageSizeMin < 0 || listConfig.pageSizeMin > listConfig.pageSizeMax) {
+		return fmt.Errorf("invalid page size range [%v, %v]", listConfig.pageSizeMin, listConfig.pageSizeMax)
+	}
+	switch listConfig.listPath {
+	case listPathREST, listPathDynamic:
+	case listPathTyped:
+		if listConfig.objectType != "pods" && listConfig.objectType != "configmaps" {
+			return fmt.Errorf("--list-path=typed only supports 'pods' and 'configmaps' object types")
+		}
+	default:
+		return fmt.Errorf("unsupported --list-path value '%v'", listConfig.listPath)
+	}
+	if resource, subresource := splitSubresource(listConfig.objectType); subresource != "" {
+		return fmt.Errorf("subresources can't be listed, the apiserver only serves them for single objects (use the get command with --object-type=%v/%v)", resource, subresource)
+	}
+	listResource, listGroup, _ = strings.Cut(listConfig.objectType, ".")
+	if _, ok := objectGroups[listGroup]; listGroup != "" && !ok {
+		return fmt.Errorf("unsupported API group '%v' in --object-type", listGroup)
+	}
+	if listConfig.eventsFor != "" {
+		if listResource != "events" {
+			return fmt.Errorf("--events-for requires --object-type=events or --object-type=events.events.k8s.io")
+		}
+		selector, err := eventsForSelector(listConfig.eventsFor)
+		if err != nil {
+			return fmt.Errorf("invalid --events-for: %v", err)
+		}
+		if listConfig.fieldSelector != "" {
+			selector += "," + listConfig.fieldSelector
+		}
+		listConfig.fieldSelector = selector
+	}
+	if _, err := fields.ParseSelector(listConfig.fieldSelector); err != nil {
+		return fmt.Errorf("invalid --field-selector: %v", err)
+	}
+	if len(listConfig.labelSelectors) > 0 {
+		var err error
+		if listSelectorChoice, err = parseLabelSelectors(listConfig.labelSelectors); err != nil {
+			return fmt.Errorf("invalid --label-selectors: %v", err)
+		}
+	}
+	switch listConfig.contentType {
+	case contentTypeJSON:
+		if !listConfig.protobufJSONFallback {
+			return fmt.Errorf("--protobuf-accept-json-fallback=false requires --content-type=protobuf")
+		}
+	case contentTypeProtobuf:
+		if listConfig.listPath == listPathDynamic || listConfig.asTable || listConfig.followContinue {
+			return fmt.Errorf("--content-type=protobuf can't be used with --list-path=dynamic, --as-table or --follow-continue")
+		}
+	default:
+		return fmt.Errorf("unsupported --content-type value '%v'", listConfig.contentType)
+	}
+	if listConfig.asTable && (listConfig.listPath != listPathREST || listConfig.maxResponseBytes > 0) {
+		return fmt.Errorf("--as-table requires --list-path=rest and can't be used with --max-response-bytes")
+	}
+	if listConfig.followContinue {
+		if listConfig.listPath != listPathREST || listConfig.asTable || listConfig.maxResponseBytes > 0 {
+			return fmt.Errorf("--follow-continue requires --list-path=rest and can't be used with --as-table or --max-response-bytes")
+		}
+		if listConfig.pageSize == 0 && listConfig.pageSizeMax == 0 {
+			return fmt.Errorf("--follow-continue requires a page size")
+		}
+		csvColumns = append(append([]string{}, defaultListCSVColumns...), pageCSVColumns...)
+	}
+	if listConfig.measureDecode {
+		if listConfig.listPath != listPathREST || listConfig.asTable || listConfig.followContinue || listConfig.maxResponseBytes > 0 {
+			return fmt.Errorf("--measure-decode requires --list-path=rest and can't be used with --as-table, --follow-continue or --max-response-bytes")
+		}
+		csvColumns = append(append([]string{}, defaultListCSVColumns...), decodeCSVColumns...)
+	}
+	if listConfig.staggerClientStart < 0 {
+		return fmt.Errorf("--stagger-client-start can't be negative")
+	}
+	if listConfig.clientDelay < 0 || listConfig.clientDelayJitter < 0 {
+		return fmt.Errorf("--client-delay and --client-delay-jitter can't be negative")
+	}
+	switch listConfig.clientDelayPhase {
+	case clientDelaySend:
+	case clientDelayDrain:
+		if listConfig.listPath != listPathREST {
+			return fmt.Errorf("--client-delay-phase=%v requires --list-path=rest", clientDelayDrain)
+		}
+	default:
+		return fmt.Errorf("unsupported --client-delay-phase value '%v'", listConfig.clientDelayPhase)
+	}
+	if listConfig.sampleRate <= 0 || listConfig.sampleRate > 1 {
+		return fmt.Errorf("--sample-rate must be within (0, 1]")
+	}
+	if listConfig.tracePhasesSampleRate <= 0 || listConfig.tracePhasesSampleRate > 1 {
+		return fmt.Errorf("--trace-phases-sample-rate must be within (0, 1]")
+	}
+	var err error
+	if _, ok := percentileEstimators[listConfig.estimator]; !ok {
+		return fmt.Errorf("unsupported --estimator value '%v' (supported values are 'hdr' and 'tdigest')", listConfig.estimator)
+	}
+	if listMaxMemory, err = parseMaxMemory(listConfig.maxMemory); err != nil {
+		return err
+	}
+	if listConfig.restartExpiredContinue && !listConfig.followContinue {
+		return fmt.Errorf("--restart-on-expired-continue requires --follow-continue")
+	}
+	if listConfig.csvColumns != "" {
+		columns, err := parseCSVColumns(listConfig.csvColumns)
+		if err != nil {
+			return fmt.Errorf("invalid --csv-columns: %v", err)
+		}
+		csvColumns = columns
+		for _, column := range columns {
+			if strings.HasPrefix(column, "server_timing") && !listConfig.serverTiming {
+				return fmt.Errorf("the '%v' CSV column requires --measure-apiserver-queue-wait", column)
 			}
 		}
-	}()
+		// An appended file already starts with the header.
+		if csvBuffer != nil && !csvBuffer.Appended() {
+			csvBuffer.Write(csvColumns)
+		}
+	}
+	if listConfig.summaryConfigMap != "" {
+		if namespace, _, err := cache.SplitMetaNamespaceKey(listConfig.summaryConfigMap); err != nil || namespace == "" {
+			return fmt.Errorf("--summary-configmap must be of the form '<namespace>/<name>'")
+		}
+	}
+	for _, class := range strings.Split(listConfig.retryOn, ",") {
+		if class == "" {
+			continue
+		}
+		if !slices.Contains(retryClasses, class) {
+			return fmt.Errorf("unsupported --retry-on class '%v' (supported classes are %v)", class, strings.Join(retryClasses, ", "))
+		}
+		retryOn[class] = true
+		// Overloaded etcds were retried as any 5xx before having their own class.
+		if class == "5xx" {
+			retryOn["etcd-overload"] = true
+		}
+	}
+	if listConfig.samplesEndpoint != "" && listConfig.samplesBufferSize < 1 {
+		return fmt.Errorf("--samples-buffer-size must be at least 1")
+	}
+	if listConfig.serializePerClient && listConfig.hedgeAfter > 0 {
+		return fmt.Errorf("--serialize-per-client can't be used with --hedge-after")
+	}
+	if listConfig.compareProtocols && (listConfig.singleConnection || len(insecureHosts) > 0 || len(resolveSpecs) > 0 || listConfig.summaryFilepath != "" || listConfig.summaryConfigMap != "" || listConfig.histogramFilepath != "") {
+		return fmt.Errorf("--compare-protocols can't be used with --single-connection, --insecure-hosts, --resolve, --summary-output-filepath, --summary-configmap or --histogram-output-filepath")
+	}
+	if listConfig.adaptiveConcurrency {
+		if listConfig.workerModel != workerModelShared || listConfig.serializePerClient || listConfig.maxClients > 0 || listConfig.concurrencySweep {
+			return fmt.Errorf("--adaptive-concurrency requires the shared worker model and can't be used with --serialize-per-client, --max-clients or --concurrency-sweep")
+		}
+		if listConfig.maxConcurrency < listConfig.numClients {
+			return fmt.Errorf("--max-concurrency must be at least --num-clients")
+		}
+	}
+	if listConfig.strictRoundRobin && listConfig.workerModel != workerModelShared {
+		return fmt.Errorf("--strict-round-robin requires the shared worker model")
+	}
+	if listConfig.clientImbalance < 0 {
+		return fmt.Errorf("--client-imbalance-threshold can't be negative")
+	}
+	if listConfig.dispatchBuffer < 0 {
+		return fmt.Errorf("--dispatch-buffer can't be negative")
+	}
+	if listConfig.dispatchBuffer > 0 {
+		if listConfig.workerModel != workerModelShared || listConfig.adaptiveConcurrency {
+			return fmt.Errorf("--dispatch-buffer requires the shared worker model and can't be used with --adaptive-concurrency")
+		}
+		if listConfig.dispatchers < 1 {
+			return fmt.Errorf("--dispatchers must be at least 1")
+		}
+	}
+	if len(listConfig.clusters) > 0 {
+		if listConfig.compareProtocols || listConfig.concurrencySweep || listConfig.warmCacheFirst || listConfig.listPath == listPathDynamic {
+			return fmt.Errorf("--clusters can't be used with --compare-protocols, --concurrency-sweep, --warm-cache-first or --list-path=dynamic")
+		}
+		if listCmd.Flags().Changed("kubeconfig-data") {
+			return fmt.Errorf("--clusters can't be used with --kubeconfig-data")
+		}
+		if listConfig.csvColumns == "" {
+			csvColumns = append(append([]string{}, csvColumns...), "cluster")
+		}
+	}
+	if listConfig.serverTiming && listConfig.csvColumns == "" {
+		csvColumns = append(append([]string{}, csvColumns...), "server_timing")
+	}
+	if listConfig.concurrencySweep {
+		if listConfig.compareProtocols || listConfig.maxClients > 0 || listConfig.summaryFilepath != "" || listConfig.summaryConfigMap != "" || listConfig.histogramFilepath != "" {
+			return fmt.Errorf("--concurrency-sweep can't be used with --compare-protocols, --max-clients, --summary-output-filepath, --summary-configmap or --histogram-output-filepath")
+		}
+		if listConfig.sweepMaxClients < listConfig.numClients {
+			return fmt.Errorf("--sweep-max-clients must be at least --num-clients")
+		}
+		if listConfig.sweepTrialDuration <= 0 {
+			return fmt.Errorf("--sweep-trial-duration must be positive")
+		}
+	}
+	if listConfig.selectorSweepKey != "" {
+		if listConfig.concurrencySweep || listConfig.compareProtocols || len(listConfig.labelSelectors) > 0 || len(listConfig.clusters) > 0 || listConfig.summaryFilepath != "" || listConfig.summaryConfigMap != "" || listConfig.histogramFilepath != "" {
+			return fmt.Errorf("--selector-cardinality-sweep can't be used with --concurrency-sweep, --compare-protocols, --label-selectors, --clusters, --summary-output-filepath, --summary-configmap or --histogram-output-filepath")
+		}
+		if listConfig.selectorCardinality < 1 {
+			return fmt.Errorf("--selector-cardinality must be at least 1")
+		}
+		if len(listConfig.selectorSweepFractions) == 0 {
+			return fmt.Errorf("--selector-sweep-fractions can't be empty")
+		}
+		for _, fraction := range listConfig.selectorSweepFractions {
+			if fraction <= 0 || fraction > 1 {
+				return fmt.Errorf("--selector-sweep-fractions must be within (0, 1]")
+			}
+		}
+		if listConfig.sweepTrialDuration <= 0 {
+			return fmt.Errorf("--sweep-trial-duration must be positive")
+		}
+		if _, err := selectorSweepSelector(1); err != nil {
+			return fmt.Errorf("invalid --selector-cardinality-sweep: %v", err)
+		}
+	}
+	if listConfig.restartErrors > 0 && listConfig.restartWindow <= 0 {
+		return fmt.Errorf("--restart-detection-window must be positive")
+	}
+	if listConfig.reportEveryN < 0 {
+		return fmt.Errorf("--report-every-n-requests can't be negative")
+	}
+	if listConfig.reportEveryN > 0 && listCmd.Flags().Changed("timeseries-interval") {
+		return fmt.Errorf("--report-every-n-requests and --timeseries-interval are mutually exclusive")
+	}
+	if listConfig.timeseriesFilepath != "" && listConfig.timeseriesInterval <= 0 {
+		return fmt.Errorf("--timeseries-interval must be positive")
+	}
+	if listConfig.csvOutputFilepath != "" {
+		if listConfig.csvBufferSize < 1 {
+			return fmt.Errorf("--csv-buffer-size must be at least 1")
+		}
+		switch listConfig.csvBackpressure {
+		case util.CsvBackpressureBlock, util.CsvBackpressureDrop, util.CsvBackpressureSample:
+		default:
+			return fmt.Errorf("unsupported --csv-backpressure value '%v'", listConfig.csvBackpressure)
+		}
+	}
+	if listConfig.workerModel != workerModelShared && listConfig.workerModel != workerModelPerClient {
+		return fmt.Errorf("unsupported --worker-model value '%v'", listConfig.workerModel)
+	}
+	if listCmd.Flags().Changed("cached") {
+		if listCmd.Flags().Changed("resource-version") || listCmd.Flags().Changed("resource-version-match") {
+			return fmt.Errorf("--cached is mutually exclusive with --resource-version and --resource-version-match")
+		}
+		if listConfig.cached {
+			listConfig.resourceVersion = "0"
+		}
+	}
+	switch metav1.ResourceVersionMatch(listConfig.rvMatch) {
+	case "":
+	case metav1.ResourceVersionMatchExact:
+		if listConfig.resourceVersion == "" || listConfig.resourceVersion == "0" {
+			return fmt.Errorf("--resource-version-match=Exact requires a non-empty, non-zero --resource-version")
+		}
+	case metav1.ResourceVersionMatchNotOlderThan:
+		if listConfig.resourceVersion == "" {
+			return fmt.Errorf("--resource-version-match=NotOlderThan requires a non-empty --resource-version")
+		}
+	default:
+		return fmt.Errorf("unsupported --resource-version-match value '%v'", listConfig.rvMatch)
+	}
+	namespaces := []string{listConfig.namespace}
+	if listConfig.namespaceWeights != "" {
+		if listCmd.Flags().Changed("namespace") {
+			return fmt.Errorf("--namespace-weights and --namespace are mutually exclusive")
+		}
+		var err error
+		if listNamespaceChoice, err = util.ParseWeightedChoice(listConfig.namespaceWeights); err != nil {
+			return fmt.Errorf("invalid --namespace-weights: %v", err)
+		}
+		namespaces = listNamespaceChoice.Names()
+	}
+	if listConfig.targetNamespaces < 0 {
+		return fmt.Errorf("--target-namespace-count can't be negative")
+	}
+	if listConfig.deleteNamespaces && listConfig.targetNamespaces == 0 && len(listConfig.sizeSeries) == 0 {
+		return fmt.Errorf("--delete-namespaces-on-exit requires --target-namespace-count or --size-series")
+	}
+	if listConfig.seedSizeSeries && len(listConfig.sizeSeries) == 0 {
+		return fmt.Errorf("--seed-size-series requires --size-series")
+	}
+	if listConfig.seedSizeSeries && (listResource != "configmaps" || listGroup != "") {
+		return fmt.Errorf("--seed-size-series only creates configmaps, it requires --object-type=configmaps")
+	}
+	if len(listConfig.sizeSeries) > 0 {
+		if listConfig.targetNamespaces > 0 || len(listConfig.clusters) > 0 {
+			return fmt.Errorf("--size-series excludes --target-namespace-count and --clusters")
+		}
+		seen := map[int]bool{}
+		for _, size := range listConfig.sizeSeries {
+			if size < 0 || seen[size] {
+				return fmt.Errorf("--size-series must hold distinct, non-negative object counts")
+			}
+			seen[size] = true
+		}
+		if listConfig.seedSizeSeries {
+			if err := checkDestructive(destructiveCreate, math.Inf(1), sizeSeriesNamespaces(listConfig.namespace, listConfig.sizeSeries)...); err != nil {
+				return err
+			}
+		}
+	}
+	if listConfig.targetNamespaces > 0 || len(listConfig.sizeSeries) > 0 {
+		if listConfig.namespaceWeights != "" || listConfig.namespace == "" {
+			return fmt.Errorf("--target-namespace-count and --size-series require a --namespace to name the namespaces after, and exclude --namespace-weights")
+		}
+		if listConfig.targetNamespaces > 0 {
+			namespaces = indexedNamespaces(listConfig.namespace, listConfig.targetNamespaces)
+		} else {
+			namespaces = sizeSeriesNamespaces(listConfig.namespace, listConfig.sizeSeries)
+		}
+		weights := make([]string, len(namespaces))
+		for i, namespace := range namespaces {
+			weights[i] = namespace + "=1"
+		}
+		var err error
+		if listNamespaceChoice, err = util.ParseWeightedChoice(strings.Join(weights, ",")); err != nil {
+			return err
+		}
+		if listConfig.deleteNamespaces {
+			if err := checkDestructive(destructiveDeleteNamespace, 0, namespaces...); err != nil {
+				return err
+			}
+		}
+	}
+	if listConfig.deleteNamespace {
+		// Listing from all namespaces doesn't delete any.
+		if err := checkDestructive(destructiveDeleteNamespace, 0, slices.DeleteFunc(slices.Clone(namespaces), func(ns string) bool { return ns == "" })...); err != nil {
+			return err
+		}
+	}
+	// Configs are prepared for all the clients which might get added, but only --num-clients are created upfront.
+	numConfigs := max(listConfig.numClients, listConfig.maxClients)
+	if listConfig.concurrencySweep {
+		numConfigs = listConfig.sweepMaxClients
+	}
+	if err := checkFileDescriptors(numConfigs * max(len(listConfig.clusters), 1)); err != nil {
+		return err
+	}
+	var clusters []*listCluster
+	if len(listConfig.clusters) == 0 {
+		cluster, err := prepareListCluster("", loadKubeConfig(listCmd), numConfigs, namespaces)
+		if err != nil {
+			return err
+		}
+		clusters = append(clusters, cluster)
+	}
+	for _, spec := range listConfig.clusters {
+		name, config, err := clusterKubeConfig(spec)
+		if err != nil {
+			return fmt.Errorf("failed to load the kubeconfig of cluster '%v': %v", spec, err)
+		}
+		cluster, err := prepareListCluster(name, applyClientSettings(listCmd, config), numConfigs, namespaces)
+		if err != nil {
+			return fmt.Errorf("cluster '%v': %v", name, err)
+		}
+		clusters = append(clusters, cluster)
+	}
+	if listConfig.manifestFilepath != "" {
+		if err := writeManifest(listConfig.manifestFilepath, listCmd, clusters[0].config); err != nil {
+			return fmt.Errorf("failed to write run manifest: %v", err)
+		}
+	}
+	config, clients, configs, connStats := clusters[0].config, clusters[0].clients, clusters[0].configs, clusters[0].connStats
+	if listConfig.warmCacheFirst {
+		if listConfig.resourceVersion == "" {
+			klog.Warningf("--warm-cache-first is meant for cache-served lists, but without --cached or --resource-version the lists are served from etcd")
+		}
+		start := clk.Now()
+		how, stop, err := warmWatchCache(context.Background(), listRESTClient(clients[0]), namespaces[0], listResource)
+		if err != nil {
+			return fmt.Errorf("failed to warm up the watch cache: %v", err)
+		}
+		listCleanups.add(cleanupStopServers, "stop the warming watch", stop)
+		cacheWarmup = how
+		if how == cacheWarmUnconfirmed {
+			klog.Warningf("The watch cache couldn't be confirmed warm within %v, the first cached reads might be skewed", cacheWarmTimeout)
+		} else {
+			klog.Infof("Watch cache confirmed warm (by a %v) after %v", how, clk.Since(start))
+		}
+	}
+	if listConfig.samplesEndpoint != "" {
+		sampleBuffer = util.NewSampleBuffer(listConfig.samplesBufferSize)
+		mux := http.NewServeMux()
+		mux.Handle("/samples", sampleBuffer)
+		server := &http.Server{Addr: listConfig.samplesEndpoint, Handler: mux}
+		go func() {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				klog.Errorf("Failed to serve the samples endpoint: %v", err)
+			}
+		}()
+		listCleanups.add(cleanupStopServers, "stop the samples endpoint", func() { server.Close() })
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
 
+	if err := waitForStart(ctx); err != nil {
+		return err
+	}
 	klog.V(1).Infof("Listing '%v' objects in namespace '%v' (page size = %v) using %v clients and QPS = %v for %v",
 		listConfig.objectType,
 		listConfig.namespace,
@@ -107,74 +836,1952 @@ func listCommand() error {
 		listConfig.numClients,
 		listConfig.qps,
 		listConfig.totalDuration)
-	listObjects(ctx, clients)
+	if listConfig.compareProtocols {
+		return compareProtocols(ctx, config, clients, configs, connStats)
+	}
+	if listConfig.concurrencySweep {
+		return concurrencySweep(ctx, configs, connStats)
+	}
+	if listConfig.selectorSweepKey != "" {
+		return selectorCardinalitySweep(ctx, clients, configs, connStats)
+	}
+	if len(clusters) > 1 {
+		return listClusters(ctx, clusters)
+	}
+	if _, reason := listObjects(ctx, "", clients, configs, connStats); reason != "" {
+		return &runStoppedError{reason: reason}
+	}
 	return nil
 }
 
-func listObjects(ctx context.Context, clients []*kubernetes.Clientset) {
-	start := time.Now()
-	ticker := time.NewTicker(time.Duration(1000000000.0/listConfig.qps) * time.Nanosecond)
-	defer ticker.Stop()
+// Run the workload over HTTP/2 with the given clients, then for as long over HTTP/1.1 with new ones, and print how both fared.
+func compareProtocols(ctx context.Context, config *restclient.Config, clients []*kubernetes.Clientset, configs []*restclient.Config, connStats []*client.ConnectionStats) error {
+	klog.Infof("Running the list workload over HTTP/2 for %v", listConfig.totalDuration)
+	h2, reason := listObjects(ctx, "", clients, configs, connStats)
+	if reason != "" {
+		return &runStoppedError{reason: reason}
+	}
 
-	var totalCount atomic.Uint64
-	var failedCount atomic.Uint64
-	defer func() {
-		fc := failedCount.Load()
-		tc := totalCount.Load()
-		klog.Infof("%d out of %d requests failed, failure rate: %v%%", fc, tc, float64(fc)/float64(tc)*100)
-	}()
+	h1Config := restclient.CopyConfig(config)
+	// Not offering h2 through ALPN makes the server fall back to HTTP/1.1.
+	h1Config.NextProtos = []string{"http/1.1"}
+	configs, connStats = client.TracedConfigs(h1Config, len(configs))
+	clients = client.CreateKubeClientsForConfigs(configs[:listConfig.numClients])
+	if listConfig.listPath == listPathDynamic {
+		dynamicClients = client.CreateDynamicClientsForConfigs(configs)
+	}
+	if listConfig.warmupConnections {
+		warmupConnections(clients)
+	}
+	klog.Infof("Running the list workload over HTTP/1.1 for %v", listConfig.totalDuration)
+	h1, reason := listObjects(ctx, "", clients, configs, connStats)
+	if reason != "" {
+		return &runStoppedError{reason: reason}
+	}
 
-	var wg sync.WaitGroup
-	for i := 0; time.Since(start) < listConfig.totalDuration; i++ {
-		select {
-		case <-ctx.Done():
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "METRIC\tHTTP/2\tHTTP/1.1\tCHANGE")
+	for _, m := range summaryMetrics(h2, h1) {
+		fmt.Fprintf(w, "%v\t%.4g\t%.4g\t%+.2f%%\n", m.name, m.baseline, m.candidate, percentChange(m.baseline, m.candidate))
+	}
+	return w.Flush()
+}
 
-			return
-		case <-ticker.C:
-			client := clients[i%len(clients)]
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				if err := listOnce(ctx, client, &totalCount, &failedCount); err != nil {
-					klog.Errorf("Error seen with list call: %v", err)
-				}
-			}()
+// A trial stops the sweep if it raises the throughput over the best one by less than this fraction.
+const sweepPlateauGain = 0.05
+
+// A trial stops the sweep if its p99 is over this many times the first trial's.
+const sweepLatencyDegradation = 2
+
+// Run trials of the workload doubling the client count each time, until the throughput plateaus or the latency
+// degrades, then print all the trials and the knee point: the trial with the highest throughput before that.
+func concurrencySweep(ctx context.Context, configs []*restclient.Config, connStats []*client.ConnectionStats) error {
+	listConfig.totalDuration = listConfig.sweepTrialDuration
+	type trial struct {
+		clients int
+		summary *RunSummary
+	}
+	var trials []trial
+	knee := 0
+	for n := listConfig.numClients; n <= listConfig.sweepMaxClients; n *= 2 {
+		clients := client.CreateKubeClientsForConfigs(configs[:n])
+		if listConfig.warmupConnections {
+			warmupConnections(clients)
+		}
+		klog.Infof("Running the list workload with %d clients for %v", n, listConfig.totalDuration)
+		// Extra configs would make the trial add clients as for --max-clients.
+		summary, reason := listObjects(ctx, "", clients, configs[:n], connStats[:n])
+		if reason != "" {
+			return &runStoppedError{reason: reason}
+		}
+		trials = append(trials, trial{n, summary})
+		if len(trials) == 1 {
+			continue
+		}
+		if summary.Latency.P99 > sweepLatencyDegradation*trials[0].summary.Latency.P99 {
+			klog.Infof("Stopping the sweep, the p99 latency degraded to %v", formatLatency(summary.Latency.P99))
+			break
+		}
+		best := trials[knee].summary.AchievedQPS
+		if summary.AchievedQPS > best {
+			knee = len(trials) - 1
+		}
+		if summary.AchievedQPS < best*(1+sweepPlateauGain) {
+			klog.Infof("Stopping the sweep, the throughput plateaued at %.4g QPS", best)
+			break
 		}
 	}
 
-	wg.Wait()
-	klog.V(1).Infof("Finished listing objects for a duration of %v", listConfig.totalDuration)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CLIENTS\tACHIEVED-QPS\tP50\tP99\tFAILURE-RATE\t")
+	for i, t := range trials {
+		mark := ""
+		if i == knee {
+			mark = "<- knee"
+		}
+		fmt.Fprintf(w, "%d\t%.4g\t%v\t%v\t%.4g\t%v\n", t.clients, t.summary.AchievedQPS, formatLatency(t.summary.Latency.P50), formatLatency(t.summary.Latency.P99), t.summary.FailureRate, mark)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	klog.Infof("Peak throughput of %.4g QPS reached with %d clients", trials[knee].summary.AchievedQPS, trials[knee].clients)
+	return nil
 }
 
-func listOnce(ctx context.Context, client *kubernetes.Clientset, totalCount, failedCount *atomic.Uint64) error {
-	requestCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
-	defer cancel()
-	totalCount.Add(1)
-
-	start := time.Now()
-	rc, err := client.CoreV1().RESTClient().Get().
-		Namespace(listConfig.namespace).
-		Resource(listConfig.objectType).
-		VersionedParams(&metav1.ListOptions{Limit: int64(listConfig.pageSize)}, scheme.ParameterCodec).
-		Stream(requestCtx)
-	if rc != nil {
-		// Drain response.body to enable TCP connection reuse.
-		// Ref: https://github.com/google/go-github/pull/317)
-		io.Copy(ioutil.Discard, rc)
-		if rc.Close() != nil {
-			klog.Errorf("Failed to close the response: %v", err)
+// Build the --selector-cardinality-sweep selector matching the first k values of the label.
+func selectorSweepSelector(k int) (string, error) {
+	values := make([]string, k)
+	for i := range values {
+		values[i] = fmt.Sprintf("value-%d", i)
+	}
+	selector := fmt.Sprintf("%v in (%v)", listConfig.selectorSweepKey, strings.Join(values, ","))
+	if _, err := labels.Parse(selector); err != nil {
+		return "", err
+	}
+	return selector, nil
+}
+
+// Run a trial of the workload for each of the --selector-sweep-fractions, with a selector matching that fraction
+// of the objects through the label of --selector-cardinality-sweep, then print the latencies by fraction.
+func selectorCardinalitySweep(ctx context.Context, clients []*kubernetes.Clientset, configs []*restclient.Config, connStats []*client.ConnectionStats) error {
+	listConfig.totalDuration = listConfig.sweepTrialDuration
+	type trial struct {
+		values  int
+		summary *RunSummary
+	}
+	var trials []trial
+	for _, fraction := range listConfig.selectorSweepFractions {
+		k := min(max(int(math.Round(fraction*float64(listConfig.selectorCardinality))), 1), listConfig.selectorCardinality)
+		if slices.ContainsFunc(trials, func(t trial) bool { return t.values == k }) {
+			klog.Infof("Skipping the fraction %v, rounded to the %d values of an earlier trial", fraction, k)
+			continue
 		}
+		selector, err := selectorSweepSelector(k)
+		if err != nil {
+			return err
+		}
+		listSelectorChoice = util.NewWeightedChoice([]string{selector}, []float64{1})
+		klog.Infof("Running the list workload matching %d out of %d label values for %v", k, listConfig.selectorCardinality, listConfig.totalDuration)
+		summary, reason := listObjects(ctx, "", clients, configs, connStats)
+		if reason != "" {
+			return &runStoppedError{reason: reason}
+		}
+		trials = append(trials, trial{k, summary})
 	}
-	if err != nil {
-		failedCount.Add(1)
-		return err
+	slices.SortFunc(trials, func(a, b trial) int { return a.values - b.values })
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MATCHED-FRACTION\tVALUES\tACHIEVED-QPS\tP50\tP99\tFAILURE-RATE")
+	for _, t := range trials {
+		fmt.Fprintf(w, "%.4g\t%d\t%.4g\t%v\t%v\t%.4g\n", float64(t.values)/float64(listConfig.selectorCardinality), t.values, t.summary.AchievedQPS, formatLatency(t.summary.Latency.P50), formatLatency(t.summary.Latency.P99), t.summary.FailureRate)
+	}
+	return w.Flush()
+}
+
+// Clients of a cluster the list calls are sent to, set up and checked before the run.
+type listCluster struct {
+	// Only set with --clusters.
+	name string
+	// Config the clients are created from, before --single-connection.
+	config    *restclient.Config
+	configs   []*restclient.Config
+	connStats []*client.ConnectionStats
+	clients   []*kubernetes.Clientset
+}
+
+// Load a --clusters entry, either the path of a kubeconfig file (using its current context) or the name of
+// a context of the --kubeconfig file. The cluster is named after the file or the context.
+func clusterKubeConfig(spec string) (string, *restclient.Config, error) {
+	if info, err := os.Stat(spec); err == nil && !info.IsDir() {
+		config, err := client.GetKubeConfigForContext(spec, "")
+		return strings.TrimSuffix(filepath.Base(spec), filepath.Ext(spec)), config, err
+	}
+	config, err := client.GetKubeConfigForContext(kubeconfig, spec)
+	return spec, config, err
+}
+
+// Create the clients of a cluster, then create the namespaces and check the objects to list as configured.
+func prepareListCluster(name string, config *restclient.Config, numConfigs int, namespaces []string) (*listCluster, error) {
+	if listConfig.contentType == contentTypeProtobuf {
+		// JSON stays acceptable, for the resources the server can't serve as protobuf, so that an unsupported
+		// resource is detected on the response rather than failing with a 406.
+		config.AcceptContentTypes = runtime.ContentTypeProtobuf + "," + runtime.ContentTypeJSON
+		config.ContentType = runtime.ContentTypeProtobuf
+	}
+	cluster := &listCluster{name: name, config: config}
+	if listConfig.singleConnection {
+		var err error
+		if config, err = client.WithSharedTransport(config, client.TransportOptions{MaxConnsPerHost: 1}); err != nil {
+			return nil, fmt.Errorf("failed to build the shared transport: %v", err)
+		}
+	}
+	cluster.configs, cluster.connStats = client.TracedConfigs(config, numConfigs)
+	cluster.clients = client.CreateKubeClientsForConfigs(cluster.configs[:listConfig.numClients])
+	if listConfig.listPath == listPathDynamic {
+		dynamicClients = client.CreateDynamicClientsForConfigs(cluster.configs)
+	}
+	first := cluster.clients[0]
+	if listConfig.targetNamespaces > 0 || listConfig.seedSizeSeries {
+		if err := reconcileTargetNamespaces(first, namespaces); err != nil {
+			return nil, err
+		}
+	}
+	if len(listConfig.sizeSeries) > 0 {
+		if err := prepareSizeSeries(context.Background(), cluster.clients); err != nil {
+			return nil, err
+		}
 	}
+	for _, namespace := range namespaces {
+		if listConfig.createNamespace {
+			if err := ensureNamespace(context.Background(), first, namespace); err != nil {
+				return nil, fmt.Errorf("failed to create namespace: %v", err)
+			}
+		}
+		if listConfig.deleteNamespace && namespace != "" {
+			listCleanups.add(cleanupTeardown, "delete namespace "+namespace, func() {
+				deleteNamespace(context.Background(), first, namespace)
+			})
+		}
+	}
+	if listConfig.warmupConnections {
+		warmupConnections(cluster.clients)
+	}
+	for _, namespace := range namespaces {
+		if err := preflightObjects(context.Background(), listRESTClient(first), namespace, listResource, listConfig.fieldSelector); err != nil {
+			return nil, err
+		}
+	}
+	return cluster, nil
+}
 
-	latency := time.Since(start)
-	if csvWriter != nil {
-		csvWriter.Write([]string{fmt.Sprintf("%v", latency)})
+// Create the missing --target-namespace-count (or seeded --size-series) namespaces, registering the deletion of
+// the created ones with --delete-namespaces-on-exit.
+func reconcileTargetNamespaces(kubeClient *kubernetes.Clientset, namespaces []string) error {
+	var created []string
+	for _, namespace := range namespaces {
+		ok, err := createNamespace(context.Background(), kubeClient, namespace)
+		if err != nil {
+			return fmt.Errorf("failed to create namespace: %v", err)
+		}
+		if !ok {
+			continue
+		}
+		created = append(created, namespace)
+		if listConfig.deleteNamespaces {
+			listCleanups.add(cleanupTeardown, "delete namespace "+namespace, func() {
+				deleteNamespace(context.Background(), kubeClient, namespace)
+			})
+		}
+	}
+	klog.Infof("Spreading the list calls across %d namespaces, %d of which were created", len(namespaces), len(created))
+	return nil
+}
+
+// Run the list calls against all the clusters at once, then report the aggregate of their runs.
+func listClusters(ctx context.Context, clusters []*listCluster) error {
+	aggregateLatencies = util.NewLatencyTracker()
+	summaries := make([]*RunSummary, len(clusters))
+	reasons := make([]string, len(clusters))
+	var wg sync.WaitGroup
+	for i, c := range clusters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			summaries[i], reasons[i] = listObjects(ctx, c.name, c.clients, c.configs, c.connStats)
+		}()
 	}
+	wg.Wait()
 
-	klog.V(2).Infof("List call took: %v", latency)
+	aggregate := &RunSummary{
+		Command:     listCmd.Name(),
+		RunID:       runID,
+		Version:     version.Get(),
+		LatencyUnit: latencyUnit,
+		WorkerModel: listConfig.workerModel,
+		Completed:   true,
+		Latency:     aggregateLatencies.Summary(),
+	}
+	for i, s := range summaries {
+		if s == nil {
+			continue
+		}
+		if aggregate.StartTime.IsZero() || s.StartTime.Before(aggregate.StartTime) {
+			aggregate.StartTime = s.StartTime
+		}
+		aggregate.Duration = max(aggregate.Duration, s.Duration)
+		aggregate.TotalRequests += s.TotalRequests
+		aggregate.FailedRequests += s.FailedRequests
+		aggregate.NotFoundRequests += s.NotFoundRequests
+		aggregate.AchievedQPS += s.AchievedQPS
+		aggregate.NumClients += s.NumClients
+		aggregate.TLSHandshakes += s.TLSHandshakes
+		aggregate.CompressedResponses += s.CompressedResponses
+		aggregate.Events = append(aggregate.Events, s.Events...)
+		if reasons[i] != "" {
+			aggregate.Completed, aggregate.StopReason = false, reasons[i]
+		}
+	}
+	if aggregate.TotalRequests > 0 {
+		aggregate.FailureRate = float64(aggregate.FailedRequests) / float64(aggregate.TotalRequests)
+	}
+	l := aggregate.Latency
+	klog.Infof("Across the %d clusters: %d out of %d requests failed, %.2f QPS achieved, p50 = %v, p90 = %v, p99 = %v",
+		len(clusters), aggregate.FailedRequests, aggregate.TotalRequests, aggregate.AchievedQPS, l.P50, l.P90, l.P99)
+	if listConfig.summaryFilepath != "" {
+		if err := writeSummary(listConfig.summaryFilepath, aggregate); err != nil {
+			klog.Errorf("Failed to write run summary: %v", err)
+		}
+	}
+	if aggregate.StopReason != "" {
+		return &runStoppedError{reason: aggregate.StopReason}
+	}
 	return nil
 }
+
+// Path of the output of a single cluster with --clusters, the cluster name being added before the extension.
+func clusterFilepath(path, cluster string) string {
+	if cluster == "" {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + cluster + ext
+}
+
+// Connection setup times and failures of the clients of a run with --warmup-connections.
+type connectionWarmup struct {
+	latency  util.LatencySummary
+	failures uint64
+}
+
+// Warmups of the runs by their first client, the clients of the trials and clusters all being distinct.
+var connectionWarmups struct {
+	sync.Mutex
+	byClient map[*kubernetes.Clientset]*connectionWarmup
+}
+
+// Open a connection for every client so connection setup doesn't show up in the measured latencies, measuring the
+// time each client spent dialing and in the TLS handshake.
+func warmupConnections(clients []*kubernetes.Clientset) {
+	start := clk.Now()
+	latencies := util.NewLatencyTracker()
+	var failures atomic.Uint64
+	var wg sync.WaitGroup
+	for i, c := range clients {
+		wg.Add(1)
+		go func(i int, c *kubernetes.Clientset) {
+			defer wg.Done()
+			ctx, timing := client.WithConnectTiming(context.Background())
+			if err := c.Discovery().RESTClient().Get().AbsPath("/version").Do(ctx).Error(); err != nil {
+				klog.Warningf("Failed to warm up connection for client %d: %v", i, err)
+				failures.Add(1)
+				return
+			}
+			// Clients sharing a transport may get the connection another one opened.
+			if !timing.Reused {
+				latencies.Record(timing.Total())
+			}
+		}(i, c)
+	}
+	wg.Wait()
+	warmup := &connectionWarmup{latency: latencies.Summary(), failures: failures.Load()}
+	klog.V(1).Infof("Warmed up connections for %d clients in %v", len(clients), clk.Since(start))
+	klog.Infof("Connection setup (dial and TLS handshake) of %d new connections: p50 %v, p90 %v, p99 %v, max %v, %d clients failed to connect",
+		warmup.latency.Count, warmup.latency.P50, warmup.latency.P90, warmup.latency.P99, warmup.latency.Max, warmup.failures)
+	connectionWarmups.Lock()
+	defer connectionWarmups.Unlock()
+	if connectionWarmups.byClient == nil {
+		connectionWarmups.byClient = map[*kubernetes.Clientset]*connectionWarmup{}
+	}
+	connectionWarmups.byClient[clients[0]] = warmup
+}
+
+// Return the warmup of the run whose first client is given, nil without --warmup-connections.
+func connectionWarmupOf(first *kubernetes.Clientset) *connectionWarmup {
+	connectionWarmups.Lock()
+	defer connectionWarmups.Unlock()
+	return connectionWarmups.byClient[first]
+}
+
+// Offset from the start of the run of the first call of a client with --stagger-client-start, the clients added
+// by --max-clients starting after the window.
+func staggerOffset(clientIndex int) time.Duration {
+	return listConfig.staggerClientStart * time.Duration(clientIndex) / time.Duration(listConfig.numClients)
+}
+
+// Number of the clients which started taking calls by the elapsed time, the first one always having started.
+func startedClients(elapsed time.Duration, numClients int) int {
+	if listConfig.staggerClientStart <= 0 || elapsed >= listConfig.staggerClientStart {
+		return numClients
+	}
+	return min(int(elapsed*time.Duration(listConfig.numClients)/listConfig.staggerClientStart)+1, numClients)
+}
+
+// A tick queued in the --dispatch-buffer, with the clients as they were when it fired.
+type dispatchItem struct {
+	clientIndex int
+	clients     []*kubernetes.Clientset
+}
+
+// Run the list calls, returning the run summary and why the run stopped early (empty if it ran for the total duration).
+// Clients beyond the initial ones get created from the remaining configs with --max-clients. The cluster is only
+// named with --clusters.
+func listObjects(ctx context.Context, cluster string, clients []*kubernetes.Clientset, configs []*restclient.Config, connStats []*client.ConnectionStats) (summary *RunSummary, reason string) {
+	var metricsBefore map[string]float64
+	if listConfig.scrapeMetrics {
+		var err error
+		if metricsBefore, err = scrapeAPIServerMetrics(ctx, clients[0]); err != nil {
+			klog.Warningf("Failed to scrape the apiserver metrics before the run: %v", err)
+		}
+	}
+	start := clk.Now()
+	runEnd := start.Add(listConfig.totalDuration)
+	ticker := clk.NewTicker(time.Duration(1000000000.0/listConfig.qps) * time.Nanosecond)
+	defer ticker.Stop()
+	var scaleC <-chan time.Time
+	if len(configs) > len(clients) {
+		scaleTicker := clk.NewTicker(listConfig.scaleInterval)
+		defer scaleTicker.Stop()
+		scaleC = scaleTicker.C()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stats := newListStats(len(configs))
+	stats.cluster = cluster
+	stats.abort = cancel
+	stats.metricsBefore = metricsBefore
+	defer func() {
+		summary = reportListStats(start, stats, connStats[:len(clients)], clients[0])
+	}()
+	if listMaxMemory > 0 {
+		go watchMemory(ctx, listMaxMemory, stats)
+	}
+
+	logError := func(msg string, err error) { logRequestError("%v: %v", msg, err) }
+	if quiet {
+		logError = func(string, error) {}
+	} else if listConfig.adaptiveLogging {
+		sampler := util.NewErrorLogSampler(listConfig.errorLogBurst, errorLogSummaryInterval)
+		defer sampler.Flush()
+		logError = sampler.LogError
+	}
+
+	var wg sync.WaitGroup
+	// With per-client workers, each tick queues a call for whichever worker is free next.
+	work := make(chan struct{}, len(configs))
+	// Workers only see the clients existing when they start, the others are only used for hedging anyway.
+	startWorker := func(clientIndex int, clients []*kubernetes.Clientset) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if wait := start.Add(staggerOffset(clientIndex)).Sub(clk.Now()); wait > 0 {
+				select {
+				case <-ctx.Done():
+					return
+				case <-clk.After(wait):
+				}
+			}
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case _, ok := <-work:
+					if !ok {
+						return
+					}
+					if err := listOnce(ctx, clients, clientIndex, runEnd, stats); err != nil {
+						logError("Error seen with list call", err)
+					}
+				}
+			}
+		}()
+	}
+	if listConfig.workerModel == workerModelPerClient {
+		for i := range clients {
+			startWorker(i, clients)
+		}
+	}
+	issue := func(clientIndex int, clients []*kubernetes.Clientset) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Per-client workers are already sequential, so this is only needed with the shared model.
+			if listConfig.serializePerClient {
+				stats.clientLocks[clientIndex].Lock()
+				defer stats.clientLocks[clientIndex].Unlock()
+			}
+			if err := listOnce(ctx, clients, clientIndex, runEnd, stats); err != nil {
+				logError("Error seen with list call", err)
+			}
+		}()
+	}
+	// With --dispatch-buffer, the ticker only queues the calls and the dispatchers spawn them.
+	var dispatch chan dispatchItem
+	if listConfig.dispatchBuffer > 0 {
+		dispatch = make(chan dispatchItem, listConfig.dispatchBuffer)
+		for range listConfig.dispatchers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for item := range dispatch {
+					if ctx.Err() == nil {
+						issue(item.clientIndex, item.clients)
+					}
+				}
+			}()
+		}
+	}
+	tickC := ticker.C()
+	var slots chan struct{}
+	if listConfig.adaptiveConcurrency {
+		// Calls get dispatched whenever the limiter has a free slot rather than on ticks.
+		tickC = nil
+		stats.limiter = util.NewAdaptiveLimiter(listConfig.numClients, listConfig.maxConcurrency)
+		slots = make(chan struct{})
+		go func() {
+			for stats.limiter.Acquire(ctx) {
+				select {
+				case slots <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	var timeseriesC <-chan time.Time
+	if timeseriesWriter != nil || listConfig.reportEveryN > 0 {
+		stats.intervalLatencies = util.NewLatencyTracker()
+		stats.interval = &progressInterval{start: start}
+	}
+	// Intervals end every N requests instead with --report-every-n-requests.
+	if timeseriesWriter != nil && listConfig.reportEveryN == 0 {
+		timeseriesTicker := clk.NewTicker(listConfig.timeseriesInterval)
+		defer timeseriesTicker.Stop()
+		timeseriesC = timeseriesTicker.C()
+	}
+	var lastCompleted uint64
+	shortfalls := 0
+	// Calls handed to the clients so far, whose turn only advances with them with --strict-round-robin.
+	dispatched := 0
+	clientTurn := func(i int) int {
+		if listConfig.strictRoundRobin {
+			i = dispatched
+		}
+		return i % startedClients(clk.Since(start), len(clients))
+	}
+	for i := 0; clk.Since(start) < listConfig.totalDuration; i++ {
+		select {
+		case <-ctx.Done():
+			stats.stopReason = stopReasonSignal
+			if stats.aborted.Load() {
+				stats.stopReason = stats.abortReason
+			}
+			return nil, stats.stopReason
+		case <-scaleC:
+			completed := stats.completed.Load()
+			achieved := float64(completed-lastCompleted) / listConfig.scaleInterval.Seconds()
+			lastCompleted = completed
+			if achieved >= qpsShortfallRatio*float64(listConfig.qps) {
+				shortfalls = 0
+				continue
+			}
+			if shortfalls++; shortfalls < qpsShortfallPeriods {
+				continue
+			}
+			shortfalls = 0
+			// Double the clients, up to the configs prepared for --max-clients.
+			added := client.CreateKubeClientsForConfigs(configs[len(clients):min(2*len(clients), len(configs))])
+			clients = append(clients, added...)
+			if listConfig.workerModel == workerModelPerClient {
+				for i := len(clients) - len(added); i < len(clients); i++ {
+					startWorker(i, clients)
+				}
+			}
+			klog.Infof("Achieved %.2f QPS out of %v requested, scaled up to %d clients", achieved, listConfig.qps, len(clients))
+			if len(clients) == len(configs) {
+				scaleC = nil
+			}
+		case now := <-timeseriesC:
+			timeseriesWriter.Write(stats.interval.next(now, stats.completed.Load(), stats))
+		case <-slots:
+			clientIndex := clientTurn(i)
+			dispatched++
+			clients := clients
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				callStart := clk.Now()
+				err := listOnce(ctx, clients, clientIndex, runEnd, stats)
+				stats.limiter.Release(clk.Since(callStart), err == nil)
+				if err != nil {
+					logError("Error seen with list call", err)
+				}
+			}()
+		case <-tickC:
+			if listConfig.workerModel == workerModelPerClient {
+				select {
+				case work <- struct{}{}:
+				default:
+					// All workers are busy and the queue is full.
+					stats.dropped.Add(1)
+				}
+				continue
+			}
+			if dispatch != nil {
+				select {
+				case dispatch <- dispatchItem{clientIndex: clientTurn(i), clients: clients}:
+					dispatched++
+					stats.dispatchPeak = max(stats.dispatchPeak, len(dispatch))
+				default:
+					// The dispatchers fell behind by more than the whole buffer.
+					stats.dropped.Add(1)
+				}
+				continue
+			}
+			issue(clientTurn(i), clients)
+			dispatched++
+		}
+	}
+
+	close(work)
+	if dispatch != nil {
+		close(dispatch)
+	}
+	wg.Wait()
+	if timeseriesWriter != nil {
+		// The last interval is cut short by the end of the run.
+		timeseriesWriter.Write(stats.interval.next(clk.Now(), stats.completed.Load(), stats))
+	}
+	klog.V(1).Infof("Finished listing objects for a duration of %v with %d clients", listConfig.totalDuration, len(clients))
+	return nil, ""
+}
+
+// Columns of the --timeseries-output-filepath rows.
+var timeseriesCSVHeader = []string{"interval_start", "requests_in_interval", "failures", "p50", "p99", "achieved_qps", "inflight"}
+
+// Start and counters at the start of the current progress interval, which ends every --timeseries-interval
+// or every --report-every-n-requests.
+type progressInterval struct {
+	lock      sync.Mutex
+	start     time.Time
+	completed uint64
+	failed    uint64
+}
+
+// Return the --timeseries-output-filepath row of the interval ending now with the given number of completed
+// calls, and start the next one.
+func (t *progressInterval) next(now time.Time, completed uint64, stats *listStats) []string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	failed := stats.failed.Load()
+	l := stats.intervalLatencies.SummaryAndReset()
+	row := []string{
+		t.start.Format(time.RFC3339Nano),
+		fmt.Sprintf("%v", completed-t.completed),
+		fmt.Sprintf("%v", failed-t.failed),
+		formatLatency(l.P50),
+		formatLatency(l.P99),
+		fmt.Sprintf("%.2f", float64(l.Count)/now.Sub(t.start).Seconds()),
+		fmt.Sprintf("%v", stats.inFlight.Load()),
+	}
+	t.start, t.completed, t.failed = now, completed, failed
+	return row
+}
+
+// Count a completed call, reporting the progress every --report-every-n-requests.
+func (s *listStats) complete() {
+	n := s.completed.Add(1)
+	if listConfig.reportEveryN == 0 || n%uint64(listConfig.reportEveryN) != 0 {
+		return
+	}
+	row := s.interval.next(clk.Now(), n, s)
+	klog.Infof("Progress: %d calls completed, in the last %v: %v failed, p50 = %v%v, p99 = %v%v, %v QPS, %v in flight",
+		n, listConfig.reportEveryN, row[2], row[3], latencyUnit, row[4], latencyUnit, row[5], row[6])
+	if timeseriesWriter != nil {
+		timeseriesWriter.Write(row)
+	}
+}
+
+// Counters and latencies aggregated over all the list calls of a run.
+type listStats struct {
+	total     atomic.Uint64
+	failed    atomic.Uint64
+	notFound  atomic.Uint64
+	truncated atomic.Uint64
+	// Calls which returned, successfully or not.
+	completed atomic.Uint64
+	// Calls currently in flight, i.e concurrent streams with --single-connection, and the maximum seen.
+	inFlight    atomic.Int64
+	maxInFlight atomic.Int64
+	// Failed calls whose response body exceeded --drain-timeout.
+	drainTimeouts atomic.Uint64
+	// Successful responses whose body was shorter than their Content-Length.
+	lengthMismatches atomic.Uint64
+	// Lists failed by an expired continue token, and the restarts of lists with --restart-on-expired-continue.
+	expiredContinues atomic.Uint64
+	continueRestarts atomic.Uint64
+	// Successful responses that were compressed on the wire.
+	compressed atomic.Uint64
+	// Retries performed and retries suppressed by the retry budget.
+	retries           atomic.Uint64
+	retriesSuppressed atomic.Uint64
+	// Retries performed by --retry-on class, keyed by all the classes.
+	retriesByClass map[string]*atomic.Uint64
+	retryBudget    *util.RetryBudget
+	// Detector of the bursts of connection-level failures, and the events recorded for the summary.
+	restartDetector *util.BurstDetector
+	eventsLock      sync.Mutex
+	events          []RunEvent
+	// Name of the cluster listed from, only set with --clusters.
+	cluster string
+	// Limit of the calls in flight with --adaptive-concurrency.
+	limiter *util.AdaptiveLimiter
+	// Calls not issued because all the per-client workers were busy or the --dispatch-buffer was full.
+	dropped atomic.Uint64
+	// Highest number of ticks waiting in the --dispatch-buffer, only updated by the ticker loop.
+	dispatchPeak int
+	// Duplicate requests sent by --hedge-after, and how many of them responded first.
+	hedged    atomic.Uint64
+	hedgeWins atomic.Uint64
+	// Number of 429s by the APF flow schema and priority level which throttled them.
+	throttledLock sync.Mutex
+	throttledBy   map[string]uint64
+	// Attempts rejected with a 429 (with or without the APF headers), calls failed by a 5xx or a timeout, and
+	// the ones of these relaying an overloaded etcd.
+	throttled     atomic.Uint64
+	overloaded    atomic.Uint64
+	etcdOverloads atomic.Uint64
+	// Client-side waits of the requests with --throughput-verdict.
+	waits throughputSignals
+	// Decode times and objects of the responses with --measure-decode.
+	decodeLatencies *util.LatencyTracker
+	decodedObjects  atomic.Uint64
+	// Rows of all the tables returned with --as-table.
+	tableRows atomic.Uint64
+	latencies *util.LatencyTracker
+	// Latencies of the calls since the last --timeseries-output-filepath row.
+	intervalLatencies *util.LatencyTracker
+	interval          *progressInterval
+	// Latencies of the calls made by each client, indexed like the clients.
+	clientLatencies []*util.LatencyTracker
+	// Start time (in unix nanoseconds) of the first call of each client, indexed like the clients.
+	clientFirstCalls []atomic.Int64
+	// Calls handed to each client, failed or not, indexed like the clients.
+	clientRequests []atomic.Uint64
+	// Calls and latencies by namespace, keyed by all the namespaces listed from (not modified during the run).
+	namespaceRequests  map[string]*atomic.Uint64
+	namespaceLatencies map[string]*util.LatencyTracker
+	// Calls and latencies by label selector with --label-selectors, keyed by all the selectors.
+	selectorRequests  map[string]*atomic.Uint64
+	selectorLatencies map[string]*util.LatencyTracker
+	// Held during the calls of each client with --serialize-per-client, indexed like the clients.
+	clientLocks []sync.Mutex
+	// Latencies of the calls started within the --annotate-period windows.
+	annotatedLatencies *util.LatencyTracker
+	// Latencies of all the calls by class of their final status code, keyed by all the statusClasses.
+	statusLatencies map[string]*util.LatencyTracker
+	// Latencies of the first and following pages with --follow-continue.
+	firstPageLatencies *util.LatencyTracker
+	laterPageLatencies *util.LatencyTracker
+	// Cancels the run, used once by --abort-on-first-error or a strict --content-type, with the stop reason to report.
+	abort       context.CancelFunc
+	abortOnce   sync.Once
+	aborted     atomic.Bool
+	abortReason string
+	// Why the run stopped before the total duration, set once the main loop exits.
+	stopReason string
+	// Failed calls whose response body was recorded with --failure-sample-body.
+	failureBodies atomic.Uint64
+	// Successful responses by the content type they were served with, and whether protobuf was requested but not served.
+	// Durations of the Server-Timing metrics by name, with --measure-apiserver-queue-wait.
+	serverTimingLock sync.Mutex
+	serverTiming     map[string]*util.LatencyTracker
+	contentTypeLock  sync.Mutex
+	contentTypes     map[string]uint64
+	protobufFallback bool
+	// Apiserver metrics scraped at the start of the run with --scrape-apiserver-metrics.
+	metricsBefore map[string]float64
+	// Whether the accumulation was downgraded to bounded strategies by --max-memory.
+	memoryDowngraded atomic.Bool
+}
+
+// Classes of status codes the latencies are reported by, calls without a response being counted as 'other'.
+var statusClasses = []string{"2xx", "4xx", "5xx", "other"}
+
+func statusClass(code int) string {
+	switch code / 100 {
+	case 2, 4, 5:
+		return fmt.Sprintf("%dxx", code/100)
+	}
+	return "other"
+}
+
+func newListStats(numClients int) *listStats {
+	stats := &listStats{
+		retryBudget:        util.NewRetryBudget(listConfig.retryBudgetRatio, retryBudgetReserve),
+		latencies:          util.NewLatencyTracker(),
+		clientLatencies:    make([]*util.LatencyTracker, numClients),
+		clientLocks:        make([]sync.Mutex, numClients),
+		clientFirstCalls:   make([]atomic.Int64, numClients),
+		clientRequests:     make([]atomic.Uint64, numClients),
+		throttledBy:        map[string]uint64{},
+		retriesByClass:     map[string]*atomic.Uint64{},
+		annotatedLatencies: util.NewLatencyTracker(),
+		decodeLatencies:    util.NewLatencyTracker(),
+		statusLatencies:    map[string]*util.LatencyTracker{},
+		contentTypes:       map[string]uint64{},
+		serverTiming:       map[string]*util.LatencyTracker{},
+		firstPageLatencies: util.NewLatencyTracker(),
+		laterPageLatencies: util.NewLatencyTracker(),
+		namespaceRequests:  map[string]*atomic.Uint64{},
+		namespaceLatencies: map[string]*util.LatencyTracker{},
+		selectorRequests:   map[string]*atomic.Uint64{},
+		selectorLatencies:  map[string]*util.LatencyTracker{},
+	}
+	for _, class := range statusClasses {
+		stats.statusLatencies[class] = util.NewLatencyTracker()
+	}
+	if listSelectorChoice != nil {
+		for _, selector := range listSelectorChoice.Names() {
+			stats.selectorRequests[selector] = &atomic.Uint64{}
+			stats.selectorLatencies[selector] = util.NewLatencyTracker()
+		}
+	}
+	for _, class := range retryClasses {
+		stats.retriesByClass[class] = &atomic.Uint64{}
+	}
+	if listConfig.restartErrors > 0 {
+		stats.restartDetector = util.NewBurstDetector(listConfig.restartErrors, listConfig.restartWindow)
+	}
+	namespaces := []string{listConfig.namespace}
+	if listNamespaceChoice != nil {
+		namespaces = listNamespaceChoice.Names()
+	}
+	for _, namespace := range namespaces {
+		stats.namespaceRequests[namespace] = &atomic.Uint64{}
+		stats.namespaceLatencies[namespace] = util.NewLatencyTracker()
+	}
+	for i := range stats.clientLatencies {
+		stats.clientLatencies[i] = util.NewLatencyTracker()
+	}
+	return stats
+}
+
+// Record an event for the summary, logging it right away.
+func (s *listStats) recordEvent(eventType, message string) {
+	event := RunEvent{Time: clk.Now(), Type: eventType, Message: message}
+	klog.Warningf("Event %v at %v: %v", eventType, event.Time.Format(time.RFC3339), message)
+	s.eventsLock.Lock()
+	defer s.eventsLock.Unlock()
+	s.events = append(s.events, event)
+}
+
+// Count a list attempt rejected with a 429, and the APF configuration which throttled it.
+func (s *listStats) recordThrottling(info *client.ResponseInfo, err error) {
+	if !apierrors.IsTooManyRequests(err) {
+		return
+	}
+	s.throttled.Add(1)
+	if info.Header == nil {
+		return
+	}
+	key := fmt.Sprintf("flowschema=%v,prioritylevel=%v", info.Header.Get(flowSchemaUIDHeader), info.Header.Get(priorityLevelUIDHeader))
+	s.throttledLock.Lock()
+	defer s.throttledLock.Unlock()
+	s.throttledBy[key]++
+}
+
+// Count the content type the server actually responded with, warning the first time JSON is served
+// instead of the requested protobuf.
+func (s *listStats) recordServerTiming(metrics []client.ServerTimingMetric) {
+	s.serverTimingLock.Lock()
+	defer s.serverTimingLock.Unlock()
+	for _, metric := range metrics {
+		tracker, ok := s.serverTiming[metric.Name]
+		if !ok {
+			tracker = util.NewLatencyTracker()
+			s.serverTiming[metric.Name] = tracker
+		}
+		tracker.Record(metric.Duration)
+	}
+}
+
+func (s *listStats) recordContentType(info *client.ResponseInfo) {
+	contentType, _, err := mime.ParseMediaType(info.Header.Get("Content-Type"))
+	if err != nil {
+		contentType = "unknown"
+	}
+	s.contentTypeLock.Lock()
+	defer s.contentTypeLock.Unlock()
+	s.contentTypes[contentType]++
+	if listConfig.contentType != contentTypeProtobuf || contentType == runtime.ContentTypeProtobuf {
+		return
+	}
+	if !listConfig.protobufJSONFallback {
+		s.abortOnce.Do(func() {
+			klog.Errorf("Protobuf was requested but the server responded to %v %v with '%v', aborting as '%v' can't be measured as protobuf",
+				info.Method, info.URL, contentType, listConfig.objectType)
+			s.abortReason = stopReasonProtobufFallback
+			s.aborted.Store(true)
+			s.abort()
+		})
+		return
+	}
+	if !s.protobufFallback {
+		s.protobufFallback = true
+		klog.Warningf("Protobuf was requested but the server responded with '%v', the measured latencies aren't those of protobuf", contentType)
+	}
+}
+
+// Log when the clients made their first call relative to the start of the run with --stagger-client-start,
+// returning the time it took for all the clients which made a call to start.
+func reportClientOnset(start time.Time, firstCalls []atomic.Int64) time.Duration {
+	var offsets []time.Duration
+	for i := range firstCalls {
+		if first := firstCalls[i].Load(); first != 0 {
+			offsets = append(offsets, time.Unix(0, first).Sub(start))
+		}
+	}
+	if len(offsets) == 0 {
+		return 0
+	}
+	slices.Sort(offsets)
+	onset := offsets[len(offsets)-1]
+	if listConfig.staggerClientStart > 0 {
+		klog.Infof("%d clients made their first call within %v of the start (over a --stagger-client-start of %v): 25%% by %v, 50%% by %v, 75%% by %v",
+			len(offsets), onset.Round(time.Millisecond), listConfig.staggerClientStart,
+			util.Percentile(offsets, 25).Round(time.Millisecond), util.Percentile(offsets, 50).Round(time.Millisecond), util.Percentile(offsets, 75).Round(time.Millisecond))
+	}
+	return onset
+}
+
+// Record a client-imbalance event when the calls of a client deviate from the mean of the clients by more than
+// --client-imbalance-threshold, in which case the clients' connections weren't equally warm.
+func checkClientBalance(stats *listStats, requests []uint64) {
+	var total uint64
+	for _, n := range requests {
+		total += n
+	}
+	if len(requests) < 2 || total == 0 {
+		return
+	}
+	mean := float64(total) / float64(len(requests))
+	lowest, highest := slices.Min(requests), slices.Max(requests)
+	if deviation := max(float64(highest)-mean, mean-float64(lowest)) / mean; deviation > listConfig.clientImbalance {
+		stats.recordEvent(runEventClientImbalance, fmt.Sprintf("clients made between %d and %d calls for a mean of %.1f, deviating by %.0f%% (over a --client-imbalance-threshold of %.0f%%)",
+			lowest, highest, mean, deviation*100, listConfig.clientImbalance*100))
+	}
+}
+
+func reportListStats(start time.Time, stats *listStats, connStats []*client.ConnectionStats, kubeClient *kubernetes.Clientset) *RunSummary {
+	reportLock.Lock()
+	defer reportLock.Unlock()
+	if stats.cluster != "" {
+		klog.Infof("Results for cluster '%v':", stats.cluster)
+	}
+	fc := stats.failed.Load()
+	tc := stats.total.Load()
+	klog.Infof("%d out of %d requests failed, failure rate: %v%%", fc, tc, float64(fc)/float64(tc)*100)
+	if l := stats.latencies.Summary(); l.Count > 0 {
+		klog.Infof("Latency of the %d successful requests: min = %v, max = %v, mean = %v, p50 = %v, p90 = %v, p95 = %v, p99 = %v",
+			l.Count, l.Min, l.Max, l.Mean, l.P50, l.P90, l.P95, l.P99)
+	} else {
+		klog.Infof("No successful requests, so no latencies to report")
+	}
+	clientOnset := reportClientOnset(start, stats.clientFirstCalls[:len(connStats)])
+	var handshakes uint64
+	for i, cs := range connStats {
+		klog.V(1).Infof("Client %d performed %d TLS handshakes", i, cs.TLSHandshakes.Load())
+		handshakes += cs.TLSHandshakes.Load()
+	}
+	elapsed := clk.Since(start)
+	achievedQPS := float64(tc-fc-stats.notFound.Load()) / elapsed.Seconds()
+	klog.Infof("Achieved %.2f QPS of successful calls using the '%v' worker model", achievedQPS, listConfig.workerModel)
+	if stats.limiter != nil {
+		klog.Infof("Adaptive concurrency settled at %d list calls in flight", stats.limiter.Limit())
+	}
+	if dc := stats.dropped.Load(); dc > 0 {
+		klog.Warningf("%d list calls were not issued because all the per-client workers were busy or the dispatch buffer was full", dc)
+	}
+	if listConfig.dispatchBuffer > 0 {
+		klog.Infof("Dispatch buffer peaked at %d out of %d queued ticks", stats.dispatchPeak, listConfig.dispatchBuffer)
+		if stats.dispatchPeak > listConfig.dispatchBuffer/2 {
+			klog.Warningf("The dispatch buffer got more than half full, the client couldn't keep up with --qps")
+		}
+	}
+	var newConns, reconnects uint64
+	for _, cs := range connStats {
+		n := cs.NewConnections.Load()
+		newConns += n
+		// Connections opened past the first one of a client replaced one which got closed or went idle.
+		if n > 1 {
+			reconnects += n - 1
+		}
+	}
+	klog.Infof("%d new connections opened, up to %d list calls were in flight at once", newConns, stats.maxInFlight.Load())
+	klog.Infof("%d reconnections across %d clients (--keep-alive=%v, --idle-conn-timeout=%v)", reconnects, len(connStats), keepAlive, idleConnTimeout)
+	klog.Infof("%d TLS handshakes performed across %d clients", handshakes, len(connStats))
+	if handshakes > uint64(maxExpectedHandshakesPerClient*len(connStats)) {
+		klog.Warningf("Seen more than %d TLS handshakes per client, connections might not be kept alive", maxExpectedHandshakesPerClient)
+	}
+	nf := stats.notFound.Load()
+	if listConfig.ignoreNotFound {
+		klog.Infof("%d requests returned not found (not counted as failures)", nf)
+	}
+	tr := stats.truncated.Load()
+	if listConfig.maxResponseBytes > 0 {
+		klog.Infof("%d responses were truncated at %d bytes", tr, listConfig.maxResponseBytes)
+	}
+	if listConfig.followContinue {
+		klog.Infof("%d lists failed with an expired continue token, %d lists were restarted after one", stats.expiredContinues.Load(), stats.continueRestarts.Load())
+	}
+	if lm := stats.lengthMismatches.Load(); lm > 0 {
+		klog.Warningf("%d responses were shorter than their Content-Length, they were likely truncated by a proxy or a dropped connection", lm)
+	}
+	if eo := stats.etcdOverloads.Load(); eo > 0 {
+		klog.Warningf("%d list calls failed with an etcd overload error (%v), the storage layer rather than the apiserver is saturated",
+			eo, strings.Join(etcdOverloadMessages, ", "))
+	}
+	dt := stats.drainTimeouts.Load()
+	if listConfig.drainTimeout > 0 {
+		klog.Infof("%d responses took longer than %v to drain (counted as failures)", dt, listConfig.drainTimeout)
+	}
+	clientSummaries := make([]util.LatencySummary, len(connStats))
+	clientRequests := make([]uint64, len(connStats))
+	for i, t := range stats.clientLatencies[:len(connStats)] {
+		clientSummaries[i] = t.Summary()
+		clientRequests[i] = stats.clientRequests[i].Load()
+		klog.Infof("Client %d: %d requests, %d successful, p50 = %v, p99 = %v",
+			i, clientRequests[i], clientSummaries[i].Count, clientSummaries[i].P50, clientSummaries[i].P99)
+	}
+	if listConfig.maxClients == 0 {
+		checkClientBalance(stats, clientRequests)
+	}
+	if sc := stats.latencies.Summary().Count; listConfig.asTable && sc > 0 {
+		klog.Infof("Tables returned by the successful requests had %.1f rows on average", float64(stats.tableRows.Load())/float64(sc))
+	}
+	if d := stats.decodeLatencies.Summary(); listConfig.measureDecode && d.Count > 0 {
+		klog.Infof("Decoding the successful responses took: p50 = %v, p90 = %v, p99 = %v, for %.1f objects on average",
+			d.P50, d.P90, d.P99, float64(stats.decodedObjects.Load())/float64(d.Count))
+	}
+	if summary := stats.latencies.Summary(); listConfig.serializePerClient || listConfig.workerModel == workerModelPerClient {
+		klog.Infof("Single-stream latency (no concurrent calls per client): p50 = %v, p90 = %v, p99 = %v", summary.P50, summary.P90, summary.P99)
+	}
+	cr := stats.compressed.Load()
+	if sc := stats.latencies.Summary().Count; sc > 0 {
+		klog.Infof("%d out of %d successful responses were compressed (%v%%)", cr, sc, float64(cr)/float64(sc)*100)
+	}
+	retries, suppressed := stats.retries.Load(), stats.retriesSuppressed.Load()
+	if listConfig.maxRetries > 0 {
+		klog.Infof("%d retries performed, %d retries suppressed by the retry budget", retries, suppressed)
+		for _, class := range retryClasses {
+			if retryOn[class] {
+				klog.Infof("%d retries of '%v' errors", stats.retriesByClass[class].Load(), class)
+			}
+		}
+	}
+	hedged := stats.hedged.Load()
+	if listConfig.hedgeAfter > 0 && tc > 0 {
+		klog.Infof("%d list calls were hedged (%v%% extra requests), the hedge responded first for %d of them",
+			hedged, float64(hedged)/float64(tc)*100, stats.hedgeWins.Load())
+	}
+	// Copied as calls of a run cut short might still be going on.
+	throttledBy := map[string]uint64{}
+	stats.throttledLock.Lock()
+	for key, count := range stats.throttledBy {
+		throttledBy[key] = count
+		klog.Infof("%d list calls throttled by APF with %v", count, key)
+	}
+	stats.throttledLock.Unlock()
+	var verdict string
+	if listConfig.throughputVerdict {
+		verdict = reportThroughputVerdict(stats, elapsed)
+	}
+	var sizeSeries []SizeSeriesPoint
+	if len(listConfig.sizeSeries) > 0 {
+		sizeSeries = reportSizeSeries(stats)
+	} else if listNamespaceChoice != nil {
+		for _, namespace := range listNamespaceChoice.Names() {
+			summary := stats.namespaceLatencies[namespace].Summary()
+			klog.Infof("Namespace '%v': %d requests, %d successful, p50 = %v, p99 = %v",
+				namespace, stats.namespaceRequests[namespace].Load(), summary.Count, summary.P50, summary.P99)
+		}
+	}
+	contentTypes := map[string]uint64{}
+	stats.contentTypeLock.Lock()
+	for contentType, count := range stats.contentTypes {
+		contentTypes[contentType] = count
+		klog.Infof("%d successful responses served as '%v'", count, contentType)
+	}
+	stats.contentTypeLock.Unlock()
+	if listSelectorChoice != nil {
+		for _, selector := range listSelectorChoice.Names() {
+			summary := stats.selectorLatencies[selector].Summary()
+			klog.Infof("Label selector '%v': %d requests, %d successful, p50 = %v, p99 = %v",
+				selector, stats.selectorRequests[selector].Load(), summary.Count, summary.P50, summary.P99)
+		}
+	}
+	if sampleBuffer != nil && sampleBuffer.Overwritten() > 0 {
+		klog.Warningf("%d samples were overwritten before being scraped, increase --samples-buffer-size or scrape more often", sampleBuffer.Overwritten())
+	}
+	if listConfig.followContinue {
+		first, later := stats.firstPageLatencies.Summary(), stats.laterPageLatencies.Summary()
+		klog.Infof("First pages: %d, p50 = %v, p99 = %v; following pages: %d, p50 = %v, p99 = %v",
+			first.Count, first.P50, first.P99, later.Count, later.P50, later.P99)
+	}
+	var metricsDeltas map[string]float64
+	if stats.metricsBefore != nil {
+		after, err := scrapeAPIServerMetrics(context.Background(), kubeClient)
+		if err != nil {
+			klog.Warningf("Failed to scrape the apiserver metrics after the run: %v", err)
+		} else {
+			metricsDeltas = metricDeltas(stats.metricsBefore, after)
+			klog.Infof("%d apiserver metric series changed during the run", len(metricsDeltas))
+			for _, series := range slices.Sorted(maps.Keys(metricsDeltas)) {
+				klog.V(1).Infof("%v: %+g", series, metricsDeltas[series])
+			}
+		}
+	}
+	var droppedRows uint64
+	if csvBuffer != nil {
+		droppedRows = csvBuffer.Dropped()
+		klog.Infof("%d CSV rows dropped with the '%v' backpressure policy", droppedRows, listConfig.csvBackpressure)
+	}
+	statusSummaries := map[string]util.LatencySummary{}
+	for _, class := range statusClasses {
+		summary := stats.statusLatencies[class].Summary()
+		if summary.Count == 0 {
+			continue
+		}
+		statusSummaries[class] = summary
+		klog.Infof("%v responses: %d calls, p50 = %v, p90 = %v, p99 = %v", class, summary.Count, summary.P50, summary.P90, summary.P99)
+	}
+	var serverTiming map[string]util.LatencySummary
+	if listConfig.serverTiming {
+		serverTiming = map[string]util.LatencySummary{}
+		stats.serverTimingLock.Lock()
+		for name, tracker := range stats.serverTiming {
+			serverTiming[name] = tracker.Summary()
+		}
+		stats.serverTimingLock.Unlock()
+		if len(serverTiming) == 0 {
+			klog.Warningf("No Server-Timing metrics were seen in the responses, the apiserver doesn't emit them")
+		}
+		names := slices.Sorted(maps.Keys(serverTiming))
+		for _, name := range names {
+			summary := serverTiming[name]
+			klog.Infof("Server-Timing '%v': %d responses, mean = %v, p50 = %v, p99 = %v", name, summary.Count, summary.Mean, summary.P50, summary.P99)
+		}
+	}
+	var annotated util.LatencySummary
+	if listConfig.annotatePeriod > 0 {
+		annotated = stats.annotatedLatencies.Summary()
+		klog.Infof("%d successful requests within the annotated windows, p50 = %v, p99 = %v", annotated.Count, annotated.P50, annotated.P99)
+	}
+	var adaptiveConcurrency int
+	if stats.limiter != nil {
+		adaptiveConcurrency = stats.limiter.Limit()
+	}
+	summary := &RunSummary{
+		Command:               listCmd.Name(),
+		RunID:                 runID,
+		StartTime:             start,
+		Version:               version.Get(),
+		LatencyUnit:           latencyUnit,
+		CacheWarmup:           cacheWarmup,
+		Cluster:               stats.cluster,
+		Duration:              elapsed,
+		TotalRequests:         tc,
+		FailedRequests:        fc,
+		NotFoundRequests:      nf,
+		TLSHandshakes:         handshakes,
+		Reconnects:            reconnects,
+		TruncatedResponses:    tr,
+		DrainTimeouts:         dt,
+		EtcdOverloads:         stats.etcdOverloads.Load(),
+		ExpiredContinues:      stats.expiredContinues.Load(),
+		ContinueRestarts:      stats.continueRestarts.Load(),
+		LengthMismatches:      stats.lengthMismatches.Load(),
+		SampleRate:            listConfig.sampleRate,
+		CompressedResponses:   cr,
+		Retries:               retries,
+		RetriesSuppressed:     suppressed,
+		HedgedRequests:        hedged,
+		HedgeWins:             stats.hedgeWins.Load(),
+		ThrottledBy:           throttledBy,
+		ThroughputVerdict:     verdict,
+		AchievedQPS:           achievedQPS,
+		WorkerModel:           listConfig.workerModel,
+		NumClients:            len(connStats),
+		ClientOnset:           clientOnset,
+		Events:                stats.events,
+		AdaptiveConcurrency:   adaptiveConcurrency,
+		SerializedPerClient:   listConfig.serializePerClient || listConfig.workerModel == workerModelPerClient,
+		Completed:             stats.stopReason == "",
+		StopReason:            stats.stopReason,
+		DroppedRequests:       stats.dropped.Load(),
+		DispatchBufferPeak:    stats.dispatchPeak,
+		DroppedCSVRows:        droppedRows,
+		APIServerMetricDeltas: metricsDeltas,
+		Latency:               stats.latencies.Summary(),
+		ClientLatencies:       clientSummaries,
+		ClientRequests:        clientRequests,
+		AnnotatedLatency:      annotated,
+		StatusClassLatency:    statusSummaries,
+		ServerTimingLatency:   serverTiming,
+		ContentTypes:          contentTypes,
+		SizeSeries:            sizeSeries,
+	}
+	if tc > 0 {
+		summary.FailureRate = float64(fc) / float64(tc)
+	}
+	if warmup := connectionWarmupOf(kubeClient); warmup != nil {
+		summary.WarmupLatency, summary.WarmupFailures = &warmup.latency, warmup.failures
+	}
+	if stats.memoryDowngraded.Load() && (listConfig.histogramFilepath != "" || listConfig.plotFilepath != "") {
+		klog.Warningf("Not writing the latency histogram and plot, the latencies weren't all kept after the memory downgrade")
+	} else if listConfig.histogramFilepath != "" {
+		if err := writeHistogramLog(clusterFilepath(listConfig.histogramFilepath, stats.cluster), start, elapsed, stats.latencies.Samples()); err != nil {
+			klog.Errorf("Failed to write the latency histogram: %v", err)
+		}
+	}
+	if listConfig.plotFilepath != "" && !stats.memoryDowngraded.Load() {
+		if err := writeLatencyPlot(clusterFilepath(listConfig.plotFilepath, stats.cluster), stats.latencies.Samples(), listConfig.plotCDF); err != nil {
+			klog.Errorf("Failed to write the latency plot: %v", err)
+		}
+	}
+	if listConfig.summaryFilepath != "" {
+		if err := writeSummary(clusterFilepath(listConfig.summaryFilepath, stats.cluster), summary); err != nil {
+			klog.Errorf("Failed to write run summary: %v", err)
+		}
+	}
+	if listConfig.summaryConfigMap != "" {
+		if err := writeSummaryConfigMap(context.Background(), kubeClient, listConfig.summaryConfigMap, summary); err != nil {
+			klog.Errorf("Failed to write run summary to configmap: %v", err)
+		}
+	}
+	return summary
+}
+
+// Issue a list call using the client at clientIndex (others only being used for hedging).
+func listOnce(ctx context.Context, clients []*kubernetes.Clientset, clientIndex int, runEnd time.Time, stats *listStats) error {
+	timeout := listConfig.requestTimeout
+	if listConfig.timeoutJitter > 0 {
+		timeout += time.Duration(rng.IntRange(-int(listConfig.timeoutJitter), int(listConfig.timeoutJitter)))
+	}
+	deadline := clk.Now().Add(timeout)
+	if hardEnd := runEnd.Add(runEndGracePeriod); hardEnd.Before(deadline) {
+		deadline = hardEnd
+	}
+	requestCtx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	requestCtx, respInfo := client.WithResponseInfo(requestCtx)
+	respInfo.CaptureErrorBody = stats.failureBodies.Load() < uint64(listConfig.failureSampleBody)
+	listID := stats.total.Add(1)
+	defer stats.complete()
+	inFlight := stats.inFlight.Add(1)
+	defer stats.inFlight.Add(-1)
+	for {
+		max := stats.maxInFlight.Load()
+		if inFlight <= max || stats.maxInFlight.CompareAndSwap(max, inFlight) {
+			break
+		}
+	}
+
+	pageSize := listConfig.pageSize
+	if listConfig.pageSizeMax > 0 {
+		pageSize = rng.IntRange(listConfig.pageSizeMin, listConfig.pageSizeMax)
+	}
+	namespace := listConfig.namespace
+	if listNamespaceChoice != nil {
+		namespace = listNamespaceChoice.Pick(rng)
+	}
+	stats.namespaceRequests[namespace].Add(1)
+	labelSelector := ""
+	if listSelectorChoice != nil {
+		labelSelector = listSelectorChoice.Pick(rng)
+		stats.selectorRequests[labelSelector].Add(1)
+	}
+
+	if listConfig.clientDelayPhase == clientDelaySend {
+		if err := sleepClientDelay(requestCtx); err != nil {
+			return err
+		}
+	}
+	start := clk.Now()
+	if sampled := phaseTraces != nil && rng.Float64() < listConfig.tracePhasesSampleRate; sampled || listConfig.throughputVerdict {
+		var trace *client.PhaseTrace
+		requestCtx, trace = client.WithPhaseTrace(requestCtx)
+		defer func() {
+			if listConfig.throughputVerdict {
+				stats.waits.record(trace)
+			}
+			if sampled {
+				phaseTraces.write(listID, clientIndex, namespace, respInfo.StatusCode, trace)
+			}
+		}()
+	}
+	stats.clientFirstCalls[clientIndex].CompareAndSwap(0, start.UnixNano())
+	stats.clientRequests[clientIndex].Add(1)
+	// Annotate calls starting within the recurring window, relative to the start of the run.
+	annotated := false
+	if listConfig.annotatePeriod > 0 {
+		annotated = start.Sub(runEnd.Add(-listConfig.totalDuration))%listConfig.annotatePeriod < listConfig.annotateWindow
+	}
+	stats.retryBudget.OnRequest()
+	// Delays of the --client-delay-phase=drain and --measure-decode time of the final attempt, taken out of its latency.
+	var clientDelay time.Duration
+	defer func() {
+		stats.statusLatencies[statusClass(respInfo.StatusCode)].Record(clk.Since(start) - clientDelay)
+	}()
+	if sampleBuffer != nil {
+		defer func() {
+			sampleBuffer.Add(util.Sample{
+				Timestamp: start,
+				LatencyMs: float64(clk.Since(start)) / float64(time.Millisecond),
+				Status:    respInfo.StatusCode,
+			})
+		}()
+	}
+	result, err := hedgedListAttempt(requestCtx, clients, clientIndex, namespace, pageSize, labelSelector, respInfo, stats)
+	stats.recordThrottling(respInfo, err)
+	stats.continueRestarts.Add(uint64(result.continueRestarts))
+	for attempt := 0; err != nil && attempt < listConfig.maxRetries && retryOn[retryClass(err)]; attempt++ {
+		if !stats.retryBudget.TryRetry() {
+			stats.retriesSuppressed.Add(1)
+			break
+		}
+		stats.retries.Add(1)
+		stats.retriesByClass[retryClass(err)].Add(1)
+		result, err = hedgedListAttempt(requestCtx, clients, clientIndex, namespace, pageSize, labelSelector, respInfo, stats)
+		stats.recordThrottling(respInfo, err)
+		stats.continueRestarts.Add(uint64(result.continueRestarts))
+	}
+	clientDelay = result.clientDelay + result.decodeTime
+	if err != nil {
+		if listConfig.ignoreNotFound && apierrors.IsNotFound(err) {
+			stats.notFound.Add(1)
+			return nil
+		}
+		stats.failed.Add(1)
+		if stats.restartDetector != nil {
+			if class := retryClass(err); (class == "conn-refused" || class == "eof") && stats.restartDetector.Record(clk.Now()) {
+				stats.recordEvent(runEventPossibleRestart, fmt.Sprintf("%d connection-level failures within %v, the last one being: %v", listConfig.restartErrors, listConfig.restartWindow, err))
+			}
+		}
+		switch class := retryClass(err); {
+		case class == "etcd-overload":
+			stats.etcdOverloads.Add(1)
+			stats.overloaded.Add(1)
+		case class == "5xx" || class == "timeout" || errors.Is(err, context.DeadlineExceeded):
+			stats.overloaded.Add(1)
+		}
+		if errors.Is(err, errDrainTimeout) {
+			stats.drainTimeouts.Add(1)
+		}
+		if errors.Is(err, errExpiredContinue) {
+			stats.expiredContinues.Add(1)
+		}
+		if respInfo.ErrorBody != nil && stats.failureBodies.Add(1) <= uint64(listConfig.failureSampleBody) {
+			recordFailureBody(listID, respInfo, err)
+		}
+		if listConfig.abortOnFirstError {
+			stats.abortOnce.Do(func() {
+				dumpFailedRequest(respInfo, err)
+				stats.abortReason = stopReasonFirstError
+				stats.aborted.Store(true)
+				stats.abort()
+			})
+		}
+		return err
+	}
+
+	latency := clk.Since(start) - clientDelay
+	stats.latencies.Record(latency)
+	if aggregateLatencies != nil {
+		aggregateLatencies.Record(latency)
+	}
+	if stats.intervalLatencies != nil {
+		stats.intervalLatencies.Record(latency)
+	}
+	stats.clientLatencies[clientIndex].Record(latency)
+	stats.namespaceLatencies[namespace].Record(latency)
+	if listSelectorChoice != nil {
+		stats.selectorLatencies[labelSelector].Record(latency)
+	}
+	if annotated {
+		stats.annotatedLatencies.Record(latency)
+	}
+	if result.truncated {
+		stats.truncated.Add(1)
+	}
+	if result.lengthMismatch {
+		stats.lengthMismatches.Add(1)
+		klog.V(1).Infof("List call read %d bytes of a response with a Content-Length of %d", result.bodyBytes, result.contentLength)
+	}
+	stats.tableRows.Add(uint64(result.tableRows))
+	if listConfig.measureDecode {
+		stats.decodeLatencies.Record(result.decodeTime)
+		stats.decodedObjects.Add(uint64(result.objectCount))
+	}
+	if respInfo.Compressed {
+		stats.compressed.Add(1)
+	}
+	stats.recordContentType(respInfo)
+	var serverTiming []client.ServerTimingMetric
+	if listConfig.serverTiming {
+		serverTiming = client.ParseServerTiming(respInfo.Header)
+		stats.recordServerTiming(serverTiming)
+	}
+	// All the pages of a sampled list get recorded.
+	if sampleRate := stats.rowSampleRate(); len(resultSinks) > 0 && (sampleRate >= 1 || rng.Float64() < sampleRate) {
+		row := &listRow{
+			sampleRate:    sampleRate,
+			start:         start,
+			latency:       latency,
+			pageSize:      pageSize,
+			truncated:     result.truncated,
+			annotated:     annotated,
+			clientIndex:   clientIndex,
+			namespace:     namespace,
+			status:        respInfo.StatusCode,
+			compressed:    respInfo.Compressed,
+			tableRows:     result.tableRows,
+			decodeTime:    result.decodeTime,
+			objectCount:   result.objectCount,
+			listID:        listID,
+			inFlight:      inFlight,
+			cluster:       stats.cluster,
+			serverTiming:  serverTiming,
+			contentLength: result.contentLength,
+			bodyBytes:     result.bodyBytes,
+			requestID:     respInfo.RequestID,
+			auditID:       respInfo.Header.Get(client.AuditIDHeader),
+		}
+		for i, page := range result.pages {
+			pageRow := *row
+			pageRow.latency, pageRow.pageIndex, pageRow.continueLength = page.latency, fmt.Sprintf("%d", i), page.continueLength
+			pageRow.contentLength, pageRow.bodyBytes = page.contentLength, page.bodyBytes
+			pageRow.requestID, pageRow.auditID = page.requestID, page.auditID
+			for _, sink := range resultSinks {
+				sink.Record(&pageRow)
+			}
+		}
+		if listConfig.followContinue {
+			row.pageIndex = "total"
+		}
+		for _, sink := range resultSinks {
+			sink.Record(row)
+		}
+	}
+	for i, page := range result.pages {
+		if i == 0 {
+			stats.firstPageLatencies.Record(page.latency)
+		} else {
+			stats.laterPageLatencies.Record(page.latency)
+		}
+	}
+
+	if listConfig.asTable {
+		klog.V(2).Infof("List call (page size = %v) returned a table of %v rows in: %v", pageSize, result.tableRows, latency)
+		return nil
+	}
+	klog.V(2).Infof("List call (page size = %v) took: %v", pageSize, latency)
+	return nil
+}
+
+// Sends a single list call (one attempt, without retries or hedging) with the client of the given index.
+type listRequester interface {
+	list(ctx context.Context, client *kubernetes.Clientset, clientIndex int, namespace string, pageSize int, labelSelector string) (listResult, error)
+}
+
+// Sends the list calls to the apiserver through the configured --list-path.
+type apiserverListRequester struct{}
+
+func (apiserverListRequester) list(ctx context.Context, client *kubernetes.Clientset, clientIndex int, namespace string, pageSize int, labelSelector string) (listResult, error) {
+	return listAttempt(ctx, client, clientIndex, namespace, pageSize, labelSelector)
+}
+
+// Send a list request, and with --hedge-after a duplicate one on the next client if the first is slow.
+// The first successful response wins and the other request gets cancelled.
+func hedgedListAttempt(ctx context.Context, clients []*kubernetes.Clientset, clientIndex int, namespace string, pageSize int, labelSelector string, respInfo *client.ResponseInfo, stats *listStats) (listResult, error) {
+	if listConfig.hedgeAfter <= 0 || len(clients) < 2 {
+		return listRequests.list(ctx, clients[clientIndex], clientIndex, namespace, pageSize, labelSelector)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type outcome struct {
+		result listResult
+		err    error
+		info   *client.ResponseInfo
+		hedge  bool
+	}
+	// Buffered so the losing request doesn't block once its result isn't wanted anymore.
+	outcomes := make(chan outcome, 2)
+	attempt := func(i int, hedge bool) {
+		// Each request records its own response info, the winner's is copied over.
+		attemptCtx, info := client.WithResponseInfo(ctx)
+		result, err := listRequests.list(attemptCtx, clients[i], i, namespace, pageSize, labelSelector)
+		outcomes <- outcome{result, err, info, hedge}
+	}
+	go attempt(clientIndex, false)
+
+	timer := clk.NewTimer(listConfig.hedgeAfter)
+	defer timer.Stop()
+	var o outcome
+	select {
+	case o = <-outcomes:
+	case <-timer.C():
+		stats.hedged.Add(1)
+		go attempt((clientIndex+1)%len(clients), true)
+		if o = <-outcomes; o.err != nil {
+			o = <-outcomes
+		}
+		if o.err == nil && o.hedge {
+			stats.hedgeWins.Add(1)
+		}
+	}
+	*respInfo = *o.info
+	return o.result, o.err
+}
+
+// API groups supported besides core with --object-type=<resource>.<group>.
+var objectGroups = map[string]struct {
+	groupVersion schema.GroupVersion
+	restClient   func(*kubernetes.Clientset) restclient.Interface
+}{
+	"events.k8s.io": {eventsv1.SchemeGroupVersion, func(c *kubernetes.Clientset) restclient.Interface { return c.EventsV1().RESTClient() }},
+}
+
+// REST client of the API group of the listed objects.
+func listRESTClient(c *kubernetes.Clientset) restclient.Interface {
+	if group, ok := objectGroups[listGroup]; ok {
+		return group.restClient(c)
+	}
+	return c.CoreV1().RESTClient()
+}
+
+// Parse the selectors of --label-selectors, weighted by their optional ':<weight>' suffix (colons can't be part of a selector).
+func parseLabelSelectors(specs []string) (*util.WeightedChoice, error) {
+	var selectors []string
+	var weights []float64
+	for _, spec := range specs {
+		selector, weight := spec, 1.0
+		if i := strings.LastIndexByte(spec, ':'); i >= 0 {
+			var err error
+			if weight, err = strconv.ParseFloat(spec[i+1:], 64); err != nil || weight <= 0 {
+				return nil, fmt.Errorf("invalid weight in '%v'", spec)
+			}
+			selector = spec[:i]
+		}
+		if _, err := labels.Parse(selector); err != nil {
+			return nil, err
+		}
+		if slices.Contains(selectors, selector) {
+			return nil, fmt.Errorf("duplicate selector '%v'", selector)
+		}
+		selectors = append(selectors, selector)
+		weights = append(weights, weight)
+	}
+	return util.NewWeightedChoice(selectors, weights), nil
+}
+
+// Build the field selector matching the events of the object referenced by --events-for.
+func eventsForSelector(ref string) (string, error) {
+	namespace, name, err := cache.SplitMetaNamespaceKey(ref)
+	if err != nil {
+		return "", err
+	}
+	// The events.k8s.io events name the referenced object 'regarding' instead.
+	field := "involvedObject"
+	if listGroup == "events.k8s.io" {
+		field = "regarding"
+	}
+	selector := fmt.Sprintf("%v.name=%v", field, name)
+	if namespace != "" {
+		selector += fmt.Sprintf(",%v.namespace=%v", field, namespace)
+	}
+	return selector, nil
+}
+
+// What was observed of a successful list response.
+type listResult struct {
+	truncated bool
+	// Number of rows, only set with --as-table.
+	tableRows int
+	// Pages of the list, only set with --follow-continue.
+	pages []listPage
+	// Continue token of the response, only set with --follow-continue.
+	continueToken string
+	// Times the list was restarted from its first page with --restart-on-expired-continue.
+	continueRestarts int
+	// Content-Length (-1 when unknown) and actual bytes of the response body or, with --follow-continue, of all
+	// the pages (the length being only known if it was for every page).
+	contentLength  int64
+	bodyBytes      int64
+	lengthMismatch bool
+	// Time spent in --client-delay-phase=drain delays, over all the pages.
+	clientDelay time.Duration
+	// Time to decode the body and number of objects in it, only set with --measure-decode.
+	decodeTime  time.Duration
+	objectCount int
+}
+
+// A single page of a list followed with --follow-continue.
+type listPage struct {
+	latency        time.Duration
+	continueLength int
+	contentLength  int64
+	bodyBytes      int64
+	requestID      string
+	auditID        string
+}
+
+// Send a single list request through the configured --list-path.
+func listAttempt(ctx context.Context, kubeClient *kubernetes.Clientset, clientIndex int, namespace string, pageSize int, labelSelector string) (listResult, error) {
+	opts := metav1.ListOptions{
+		Limit:                int64(pageSize),
+		FieldSelector:        listConfig.fieldSelector,
+		LabelSelector:        labelSelector,
+		ResourceVersion:      listConfig.resourceVersion,
+		ResourceVersionMatch: metav1.ResourceVersionMatch(listConfig.rvMatch),
+	}
+	var err error
+	switch listConfig.listPath {
+	case listPathTyped:
+		if listConfig.objectType == "pods" {
+			_, err = kubeClient.CoreV1().Pods(namespace).List(ctx, opts)
+		} else {
+			_, err = kubeClient.CoreV1().ConfigMaps(namespace).List(ctx, opts)
+		}
+		// The typed and dynamic clients don't expose the response.
+		return listResult{contentLength: -1}, err
+	case listPathDynamic:
+		gvr := corev1.SchemeGroupVersion.WithResource(listResource)
+		if group, ok := objectGroups[listGroup]; ok {
+			gvr = group.groupVersion.WithResource(listResource)
+		}
+		_, err = dynamicClients[clientIndex].Resource(gvr).Namespace(namespace).List(ctx, opts)
+		return listResult{contentLength: -1}, err
+	}
+	if !listConfig.followContinue {
+		return streamList(ctx, kubeClient, namespace, opts)
+	}
+
+	var result listResult
+	firstOpts := opts
+	for {
+		start := clk.Now()
+		page, err := streamList(ctx, kubeClient, namespace, opts)
+		// Only the token of a later page can have expired, the first page being served at the latest revision
+		// or failing for the --resource-version.
+		if err != nil && len(result.pages) > 0 && (apierrors.IsResourceExpired(err) || apierrors.IsGone(err)) {
+			if listConfig.restartExpiredContinue && result.continueRestarts < maxExpiredContinueRestarts {
+				klog.V(2).Infof("Continue token expired on page %d, restarting the list: %v", len(result.pages), err)
+				result = listResult{continueRestarts: result.continueRestarts + 1}
+				opts = firstOpts
+				continue
+			}
+			return result, fmt.Errorf("%w on page %d: %w", errExpiredContinue, len(result.pages), err)
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to list page %d: %v", len(result.pages), err)
+		}
+		listed := listPage{latency: clk.Since(start) - page.clientDelay, continueLength: len(page.continueToken), contentLength: page.contentLength, bodyBytes: page.bodyBytes}
+		if info := client.ResponseInfoFrom(ctx); info != nil {
+			listed.requestID, listed.auditID = info.RequestID, info.Header.Get(client.AuditIDHeader)
+		}
+		result.pages = append(result.pages, listed)
+		if len(result.pages) == 1 || result.contentLength < 0 || page.contentLength < 0 {
+			result.contentLength = page.contentLength
+		} else {
+			result.contentLength += page.contentLength
+		}
+		result.bodyBytes += page.bodyBytes
+		result.clientDelay += page.clientDelay
+		result.lengthMismatch = result.lengthMismatch || page.lengthMismatch
+		if page.continueToken == "" {
+			return result, nil
+		}
+		// The following pages are served from the snapshot of the first one, setting a resourceVersion isn't allowed.
+		opts.Continue = page.continueToken
+		opts.ResourceVersion, opts.ResourceVersionMatch = "", ""
+	}
+}
+
+// Phases of a list call the --client-delay can happen in.
+const (
+	clientDelaySend  = "send"
+	clientDelayDrain = "drain"
+)
+
+// Sleep for the --client-delay, randomized by its jitter, returning early with an error if the context is done.
+func sleepClientDelay(ctx context.Context) error {
+	delay := listConfig.clientDelay
+	if listConfig.clientDelayJitter > 0 {
+		delay += time.Duration(rng.IntRange(-int(listConfig.clientDelayJitter), int(listConfig.clientDelayJitter)))
+	}
+	if delay <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-clk.After(delay):
+		return nil
+	}
+}
+
+// Query parameters of the list options encoded so far with --reuse-list-options, by options.
+var listOptionsParams sync.Map
+
+// Return the query parameters of list options, encoded once with --reuse-list-options, nil when they must be
+// encoded for the call: without the flag, and for the continue tokens which change on every page.
+func encodedListOptions(opts metav1.ListOptions, groupVersion schema.GroupVersion) url.Values {
+	if !listConfig.reuseListOptions || opts.Continue != "" {
+		return nil
+	}
+	if params, ok := listOptionsParams.Load(opts); ok {
+		return params.(url.Values)
+	}
+	params, err := scheme.ParameterCodec.EncodeParameters(&opts, groupVersion)
+	if err != nil {
+		return nil
+	}
+	listOptionsParams.Store(opts, params)
+	return params
+}
+
+// Send a list request through the REST client and read the response.
+func streamList(ctx context.Context, kubeClient *kubernetes.Clientset, namespace string, opts metav1.ListOptions) (listResult, error) {
+	restClient := listRESTClient(kubeClient)
+	req := restClient.Get().
+		Namespace(namespace).
+		Resource(listResource)
+	if params := encodedListOptions(opts, restClient.APIVersion()); params != nil {
+		for name, values := range params {
+			for _, value := range values {
+				req = req.Param(name, value)
+			}
+		}
+	} else {
+		req = req.VersionedParams(&opts, scheme.ParameterCodec)
+	}
+	if listConfig.asTable {
+		req = req.SetHeader("Accept", tableAcceptHeader)
+	}
+	rc, err := req.Stream(ctx)
+	var clientDelay time.Duration
+	if err == nil && listConfig.clientDelayPhase == clientDelayDrain && listConfig.clientDelay > 0 {
+		start := clk.Now()
+		err = sleepClientDelay(ctx)
+		clientDelay = clk.Since(start)
+	}
+	var drainTimedOut atomic.Bool
+	if rc != nil && listConfig.drainTimeout > 0 {
+		// Closing the body unblocks a read stalled on a slowly streamed response.
+		timer := time.AfterFunc(listConfig.drainTimeout, func() {
+			drainTimedOut.Store(true)
+			rc.Close()
+		})
+		defer timer.Stop()
+	}
+	if err == nil && listConfig.asTable {
+		defer rc.Close()
+		// The decoder stops at the end of the table, the body isn't read to its end.
+		result, err := readTable(rc)
+		result.contentLength, result.clientDelay = -1, clientDelay
+		if drainTimedOut.Load() {
+			return listResult{}, errDrainTimeout
+		}
+		return result, err
+	}
+	truncated := false
+	continueToken := ""
+	if rc != nil && err == nil && listConfig.followContinue {
+		// Only the list metadata is kept, the items are skipped over by the decoder.
+		list := &struct {
+			Metadata metav1.ListMeta `json:"metadata"`
+		}{}
+		if decodeErr := json.NewDecoder(rc).Decode(list); decodeErr != nil {
+			err = fmt.Errorf("failed to decode the list metadata: %v", decodeErr)
+		}
+		continueToken = list.Metadata.Continue
+	}
+	var body []byte
+	if rc != nil {
+		// Drain response.body to enable TCP connection reuse.
+		// Ref: https://github.com/google/go-github/pull/317)
+		if listConfig.maxResponseBytes > 0 {
+			// Closing the stream early aborts the rest of the response.
+			_, copyErr := io.CopyN(ioutil.Discard, rc, listConfig.maxResponseBytes)
+			truncated = copyErr == nil
+		} else if listConfig.measureDecode && err == nil {
+			// The body is read in full first, for the decoding to be timed apart from the network.
+			var readErr error
+			if body, readErr = ioutil.ReadAll(rc); readErr != nil {
+				err = fmt.Errorf("failed to read the response: %v", readErr)
+			}
+		} else {
+			io.Copy(ioutil.Discard, rc)
+		}
+		if rc.Close() != nil {
+			klog.Errorf("Failed to close the response: %v", err)
+		}
+	}
+	if drainTimedOut.Load() {
+		return listResult{}, errDrainTimeout
+	}
+	result := listResult{truncated: truncated, continueToken: continueToken, contentLength: -1, clientDelay: clientDelay}
+	if listConfig.measureDecode && err == nil {
+		result.decodeTime, result.objectCount, err = decodeList(body)
+	}
+	// A body shorter than its Content-Length ends with an unexpected EOF which the drain doesn't surface.
+	if info := client.ResponseInfoFrom(ctx); info != nil && err == nil {
+		result.contentLength, result.bodyBytes = info.ContentLength, info.BodyBytes
+		result.lengthMismatch = !truncated && info.ContentLength >= 0 && info.BodyBytes != info.ContentLength
+	}
+	return result, err
+}
+
+// Decode a list response into its typed objects with --measure-decode, returning the time it took and their number.
+// The universal deserializer tells JSON and protobuf apart by the content of the body.
+func decodeList(body []byte) (time.Duration, int, error) {
+	start := clk.Now()
+	list, _, err := scheme.Codecs.UniversalDeserializer().Decode(body, nil, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to decode the list: %v", err)
+	}
+	count := meta.LenList(list)
+	return clk.Since(start), count, nil
+}
+
+// Decode a list response which should be a server-side printed Table.
+func readTable(rc io.Reader) (listResult, error) {
+	table := &metav1.Table{}
+	if err := json.NewDecoder(rc).Decode(table); err != nil {
+		return listResult{}, fmt.Errorf("failed to decode the table: %v", err)
+	}
+	if table.Kind != "Table" {
+		return listResult{}, fmt.Errorf("expected a Table response, got kind '%v'", table.Kind)
+	}
+	return listResult{tableRows: len(table.Rows)}, nil
+}
+
+// Redacted so the dump can be pasted around safely.
+var sensitiveHeaders = map[string]bool{"Authorization": true, "Cookie": true}
+
+// Record the status and body of a failed call, for --failure-sample-body.
+func recordFailureBody(listID uint64, info *client.ResponseInfo, err error) {
+	if failureBodyWriter != nil {
+		failureBodyWriter.Write([]string{fmt.Sprintf("%v", listID), fmt.Sprintf("%v", info.StatusCode), err.Error(), string(info.ErrorBody), runID})
+		return
+	}
+	klog.Infof("List call %d failed with status %v%v: %v\nResponse body: %s", listID, info.StatusCode, requestIDs(info), err, info.ErrorBody)
+}
+
+// Describe the request ID and audit ID of a request for the failure logs, empty when neither is known.
+func requestIDs(info *client.ResponseInfo) string {
+	var ids []string
+	if info.RequestID != "" {
+		ids = append(ids, "request ID "+info.RequestID)
+	}
+	if auditID := info.Header.Get(client.AuditIDHeader); auditID != "" {
+		ids = append(ids, "audit ID "+auditID)
+	}
+	if len(ids) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(ids, ", ") + ")"
+}
+
+// Print everything known about a failed request, for --abort-on-first-error.
+func dumpFailedRequest(info *client.ResponseInfo, err error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Aborting the run at the first failed list call\n")
+	fmt.Fprintf(&b, "Request: %v %v%v\n", info.Method, info.URL, requestIDs(info))
+	writeHeaders(&b, info.RequestHeader)
+	if info.StatusCode != 0 {
+		fmt.Fprintf(&b, "Response status: %v\n", info.StatusCode)
+		writeHeaders(&b, info.Header)
+	}
+	fmt.Fprintf(&b, "Error: %#v", err)
+	if status, ok := err.(apierrors.APIStatus); ok {
+		fmt.Fprintf(&b, "\nStatus: %+v", status.Status())
+	}
+	klog.Error(b.String())
+}
+
+func writeHeaders(b *strings.Builder, header http.Header) {
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := strings.Join(header[k], ", ")
+		if sensitiveHeaders[k] {
+			v = "<redacted>"
+		}
+		fmt.Fprintf(b, "  %v: %v\n", k, v)
+	}
+}
+
+// Whether the message of a 5xx is etcd reporting its overload, e.g 'etcdserver: request timed out'.
+func isEtcdOverload(message string) bool {
+	for _, overload := range etcdOverloadMessages {
+		if strings.Contains(message, overload) {
+			return true
+		}
+	}
+	return false
+}
+
+// Classify a failed list call for --retry-on, returning an empty class for errors never worth retrying.
+func retryClass(err error) string {
+	if status, ok := err.(apierrors.APIStatus); ok {
+		switch code := status.Status().Code; {
+		case code == http.StatusTooManyRequests:
+			return "429"
+		case code >= http.StatusInternalServerError:
+			if isEtcdOverload(status.Status().Message) {
+				return "etcd-overload"
+			}
+			return "5xx"
+		}
+		return ""
+	}
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded), errors.Is(err, errDrainTimeout):
+		return ""
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "conn-refused"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case utilnet.IsProbableEOF(err):
+		return "eof"
+	}
+	return ""
+}
@@ -0,0 +1,186 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/klog/v2"
+
+	"github.com/rcrozean/kube-stress/pkg/client"
+	"github.com/rcrozean/kube-stress/pkg/util"
+)
+
+type ListWatchConfig struct {
+	namespace     string
+	objectType    string
+	numClients    int
+	watchDuration time.Duration
+	totalDuration time.Duration
+}
+
+var (
+	listWatchConfig *ListWatchConfig
+	listWatchCmd    *cobra.Command
+)
+
+func init() {
+	listWatchConfig = &ListWatchConfig{}
+	listWatchCmd = &cobra.Command{
+		Use:   "list-then-watch",
+		Short: "Repeatedly list objects and watch from the returned resourceVersion, like informers do",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := listWatchCommand(); err != nil {
+				klog.Errorf("Error executing list-then-watch command: %v", err)
+				os.Exit(1)
+			}
+		},
+	}
+	rootCmd.AddCommand(listWatchCmd)
+	listWatchCmd.Flags().StringVar(&listWatchConfig.namespace, "namespace", KubeStress, "Namespace to list and watch the objects from (empty value means all namespaces)")
+	listWatchCmd.Flags().StringVar(&listWatchConfig.objectType, "object-type", "configmaps", "Type of objects to list and watch (any core/v1 resource, e.g 'pods' and 'configmaps')")
+	listWatchCmd.Flags().IntVar(&listWatchConfig.numClients, "num-clients", 10, "Number of clients, each running its own list-then-watch cycles concurrently")
+	listWatchCmd.Flags().DurationVar(&listWatchConfig.watchDuration, "watch-duration", 30*time.Second, "How long each watch is kept open before starting the next cycle with a new list")
+	listWatchCmd.Flags().DurationVar(&listWatchConfig.totalDuration, "total-duration", 5*time.Minute, "Total duration for which to run this command")
+}
+
+type listWatchStats struct {
+	cycles         atomic.Uint64
+	failedLists    atomic.Uint64
+	failedWatches  atomic.Uint64
+	events         atomic.Uint64
+	errorEvents    atomic.Uint64
+	noEventWatches atomic.Uint64
+	listLatencies  *util.LatencyTracker
+	// Time between the end of the list and the first event of the watch started from its resourceVersion.
+	firstEventGaps *util.LatencyTracker
+}
+
+func listWatchCommand() error {
+	if err := checkFileDescriptors(listWatchConfig.numClients); err != nil {
+		return err
+	}
+	clients := client.CreateKubeClients(loadKubeConfig(listWatchCmd), listWatchConfig.numClients)
+	signalCtx, signalCancel := signalContext()
+	defer signalCancel()
+	if err := waitForStart(signalCtx); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), listWatchConfig.totalDuration)
+	defer cancel()
+	go func() {
+		<-signalCtx.Done()
+		cancel()
+	}()
+
+	klog.V(1).Infof("Running list-then-watch cycles of '%v' objects in namespace '%v' using %v clients for %v",
+		listWatchConfig.objectType,
+		listWatchConfig.namespace,
+		listWatchConfig.numClients,
+		listWatchConfig.totalDuration)
+
+	stats := &listWatchStats{
+		listLatencies:  util.NewLatencyTracker(),
+		firstEventGaps: util.NewLatencyTracker(),
+	}
+	var wg sync.WaitGroup
+	for i, c := range clients {
+		wg.Add(1)
+		go func(i int, c *kubernetes.Clientset) {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				if err := listThenWatch(ctx, c, stats); err != nil && ctx.Err() == nil {
+					logRequestError("Error seen with list-then-watch cycle of client %d: %v", i, err)
+				}
+			}
+		}(i, c)
+	}
+	wg.Wait()
+	reportListWatchStats(stats)
+	return nil
+}
+
+// List the objects, then watch from the returned resourceVersion for --watch-duration.
+func listThenWatch(ctx context.Context, c *kubernetes.Clientset, stats *listWatchStats) error {
+	stats.cycles.Add(1)
+	start := time.Now()
+	list, err := c.CoreV1().RESTClient().Get().
+		Namespace(listWatchConfig.namespace).
+		Resource(listWatchConfig.objectType).
+		Do(ctx).
+		Get()
+	if err != nil {
+		stats.failedLists.Add(1)
+		return fmt.Errorf("list failed: %v", err)
+	}
+	listEnd := time.Now()
+	stats.listLatencies.Record(listEnd.Sub(start))
+	accessor, err := meta.ListAccessor(list)
+	if err != nil {
+		stats.failedLists.Add(1)
+		return fmt.Errorf("unexpected list response: %v", err)
+	}
+
+	watchCtx, cancel := context.WithTimeout(ctx, listWatchConfig.watchDuration)
+	defer cancel()
+	watcher, err := c.CoreV1().RESTClient().Get().
+		Namespace(listWatchConfig.namespace).
+		Resource(listWatchConfig.objectType).
+		VersionedParams(&metav1.ListOptions{Watch: true, ResourceVersion: accessor.GetResourceVersion()}, scheme.ParameterCodec).
+		Watch(watchCtx)
+	if err != nil {
+		stats.failedWatches.Add(1)
+		return fmt.Errorf("watch from resourceVersion %v failed: %v", accessor.GetResourceVersion(), err)
+	}
+	defer watcher.Stop()
+
+	seenEvent := false
+	for event := range watcher.ResultChan() {
+		if !seenEvent {
+			stats.firstEventGaps.Record(time.Since(listEnd))
+			seenEvent = true
+		}
+		stats.events.Add(1)
+		if event.Type == watch.Error {
+			// Most likely the resourceVersion is already too old (410 Gone), the next cycle lists again.
+			stats.errorEvents.Add(1)
+			return fmt.Errorf("watch from resourceVersion %v returned an error: %v", accessor.GetResourceVersion(), event.Object)
+		}
+	}
+	if !seenEvent {
+		stats.noEventWatches.Add(1)
+	}
+	return nil
+}
+
+func reportListWatchStats(stats *listWatchStats) {
+	l, g := stats.listLatencies.Summary(), stats.firstEventGaps.Summary()
+	klog.Infof("%d list-then-watch cycles, %d failed lists, %d failed watches", stats.cycles.Load(), stats.failedLists.Load(), stats.failedWatches.Load())
+	klog.Infof("List latency: p50 = %v, p90 = %v, p99 = %v, max = %v", l.P50, l.P90, l.P99, l.Max)
+	klog.Infof("Gap between list and first watch event: p50 = %v, p90 = %v, p99 = %v, max = %v (%d watches saw no event)",
+		g.P50, g.P90, g.P99, g.Max, stats.noEventWatches.Load())
+	klog.Infof("%d watch events received, %d of them errors", stats.events.Load(), stats.errorEvents.Load())
+}
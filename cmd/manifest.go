@@ -0,0 +1,96 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	restclient "k8s.io/client-go/rest"
+
+	"github.com/rcrozean/kube-stress/pkg/version"
+)
+
+// Manifest recording the effective configuration of a run, written before any load is generated.
+type RunManifest struct {
+	Command   string            `json:"command"`
+	RunID     string            `json:"run_id"`
+	StartTime time.Time         `json:"start_time"`
+	Version   version.Info      `json:"version"`
+	Server    string            `json:"server"`
+	Identity  ClientIdentity    `json:"identity"`
+	Flags     map[string]string `json:"flags"`
+}
+
+// Identity the clients authenticate as (never includes credentials).
+type ClientIdentity struct {
+	AuthMethod         string   `json:"auth_method"`
+	Username           string   `json:"username,omitempty"`
+	ImpersonatedUser   string   `json:"impersonated_user,omitempty"`
+	ImpersonatedGroups []string `json:"impersonated_groups,omitempty"`
+}
+
+// Flags whose values carry credentials, and are never written out.
+var redactedFlags = map[string]bool{"kubeconfig-data": true}
+
+func writeManifest(filepath string, cmd *cobra.Command, config *restclient.Config) error {
+	manifest := RunManifest{
+		Command:   cmd.Name(),
+		RunID:     runID,
+		StartTime: time.Now(),
+		Version:   version.Get(),
+		Server:    config.Host,
+		Identity:  clientIdentityFor(config),
+		Flags:     map[string]string{},
+	}
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		manifest.Flags[f.Name] = f.Value.String()
+		if redactedFlags[f.Name] && f.Changed {
+			manifest.Flags[f.Name] = "<redacted>"
+		}
+	})
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath, data, 0644)
+}
+
+func clientIdentityFor(config *restclient.Config) ClientIdentity {
+	identity := ClientIdentity{
+		Username:           config.Username,
+		ImpersonatedUser:   config.Impersonate.UserName,
+		ImpersonatedGroups: config.Impersonate.Groups,
+	}
+	switch {
+	case config.ExecProvider != nil:
+		identity.AuthMethod = "exec"
+	case config.AuthProvider != nil:
+		identity.AuthMethod = "auth-provider"
+	case config.BearerToken != "" || config.BearerTokenFile != "":
+		identity.AuthMethod = "token"
+	case len(config.CertData) > 0 || config.CertFile != "":
+		identity.AuthMethod = "client-certificate"
+	case config.Username != "":
+		identity.AuthMethod = "basic"
+	default:
+		identity.AuthMethod = "anonymous"
+	}
+	return identity
+}
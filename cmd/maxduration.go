@@ -0,0 +1,56 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+// How long the results get to be flushed once --max-duration is exceeded, before the process exits anyway.
+const maxDurationFlushTimeout = 10 * time.Second
+
+// Force-terminate the process once it ran for --max-duration, whatever the command is doing. The limit must
+// leave the command its --total-duration, on top of which it covers the shutdown.
+func armMaxDuration(cmd *cobra.Command) error {
+	if maxDuration <= 0 {
+		return nil
+	}
+	if f := cmd.Flags().Lookup("total-duration"); f != nil {
+		if total, err := time.ParseDuration(f.Value.String()); err == nil && maxDuration <= total {
+			return fmt.Errorf("--max-duration=%v must be longer than the --total-duration=%v of the command", maxDuration, total)
+		}
+	}
+	time.AfterFunc(maxDuration, func() {
+		klog.Errorf("Run exceeded --max-duration=%v, force-terminating after flushing the results", maxDuration)
+		flushed := make(chan struct{})
+		go func() {
+			listCleanups.flushOutputs()
+			close(flushed)
+		}()
+		select {
+		case <-flushed:
+		case <-time.After(maxDurationFlushTimeout):
+			klog.Errorf("Flushing the results didn't complete within %v, they may be incomplete", maxDurationFlushTimeout)
+		}
+		klog.Flush()
+		os.Exit(exitCodeMaxDuration)
+	})
+	return nil
+}
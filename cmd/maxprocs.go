@@ -0,0 +1,76 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// Parse a list of CPUs like taskset's, e.g '0-3,6'.
+func parseCPUList(spec string) ([]int, error) {
+	var cpus []int
+	for _, part := range strings.Split(spec, ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		from, err := strconv.Atoi(first)
+		if err != nil || from < 0 {
+			return nil, fmt.Errorf("invalid CPU '%v'", part)
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(last); err != nil || to < from {
+				return nil, fmt.Errorf("invalid CPU range '%v'", part)
+			}
+		}
+		for cpu := from; cpu <= to; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
+
+// Pin the process to the --cpu-affinity CPUs, then set GOMAXPROCS to --max-procs or else to the CPUs the process
+// can use: the pinned ones, capped by the CPU limit of its container. The go runtime sizes GOMAXPROCS after the
+// CPUs of the host otherwise, scheduling more threads than the container gets CPU time for.
+func applyMaxProcs() error {
+	if maxProcs < 0 {
+		return fmt.Errorf("--max-procs can't be negative")
+	}
+	available := runtime.NumCPU()
+	if cpuAffinity != "" {
+		cpus, err := parseCPUList(cpuAffinity)
+		if err != nil {
+			return fmt.Errorf("invalid --cpu-affinity: %v", err)
+		}
+		if err := setCPUAffinity(cpus); err != nil {
+			return fmt.Errorf("failed to apply --cpu-affinity: %v", err)
+		}
+		available = len(cpus)
+	}
+	procs := maxProcs
+	if procs == 0 {
+		procs = available
+		if limit, ok := containerCPULimit(); ok {
+			procs = max(min(procs, int(limit)), 1)
+		}
+	}
+	runtime.GOMAXPROCS(procs)
+	klog.V(1).Infof("Using GOMAXPROCS = %d", runtime.GOMAXPROCS(0))
+	return nil
+}
@@ -0,0 +1,29 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+
+package cmd
+
+import "fmt"
+
+// CPU pinning is only supported on linux.
+func setCPUAffinity(cpus []int) error {
+	return fmt.Errorf("CPU affinity is only supported on linux")
+}
+
+// Container CPU limits are only detected on linux.
+func containerCPULimit() (float64, bool) {
+	return 0, false
+}
@@ -0,0 +1,119 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/rcrozean/kube-stress/pkg/util"
+)
+
+const (
+	// Interval between the checks of the heap size against --max-memory.
+	memoryCheckInterval = time.Second
+	// Fraction of --max-memory over which the run switches to its bounded accumulation.
+	memoryDowngradeFraction = 0.8
+	// Fraction of the --sample-rate still written to the outputs once downgraded.
+	memoryDowngradeSampleRate = 0.1
+)
+
+// Percentile estimators of the latency trackers once downgraded, selected by --estimator.
+var percentileEstimators = map[string]func() util.PercentileEstimator{
+	"hdr": util.NewHdrEstimator,
+	"tdigest": func() util.PercentileEstimator {
+		return util.NewTDigestEstimator(util.DefaultTDigestCompression)
+	},
+}
+
+// Parse --max-memory as a quantity of bytes (e.g '2Gi'), 0 meaning no budget.
+func parseMaxMemory(spec string) (int64, error) {
+	if spec == "" {
+		return 0, nil
+	}
+	q, err := resource.ParseQuantity(spec)
+	if err != nil {
+		return 0, fmt.Errorf("invalid --max-memory: %v", err)
+	}
+	if q.Value() < 0 {
+		return 0, fmt.Errorf("--max-memory can't be negative")
+	}
+	return q.Value(), nil
+}
+
+// Check the heap size every memoryCheckInterval until the context is done, downgrading the accumulation of the
+// stats once it gets close to the budget.
+func watchMemory(ctx context.Context, budget int64, stats *listStats) {
+	// Makes the garbage collector work harder close to the budget, before the accumulation gets downgraded.
+	debug.SetMemoryLimit(budget)
+	ticker := clk.NewTicker(memoryCheckInterval)
+	defer ticker.Stop()
+	var m runtime.MemStats
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+		runtime.ReadMemStats(&m)
+		if float64(m.HeapAlloc) >= memoryDowngradeFraction*float64(budget) {
+			stats.downgradeMemory(m.HeapAlloc, budget)
+			return
+		}
+	}
+}
+
+// Switch the latency trackers to fixed-size histograms and sample fewer rows to the outputs, leaving the rest
+// of the run with a bounded memory footprint.
+func (s *listStats) downgradeMemory(heap uint64, budget int64) {
+	trackers := []*util.LatencyTracker{s.latencies, s.annotatedLatencies, s.firstPageLatencies, s.laterPageLatencies}
+	if s.intervalLatencies != nil {
+		trackers = append(trackers, s.intervalLatencies)
+	}
+	if aggregateLatencies != nil {
+		trackers = append(trackers, aggregateLatencies)
+	}
+	trackers = append(trackers, s.clientLatencies...)
+	for _, byKey := range []map[string]*util.LatencyTracker{s.statusLatencies, s.namespaceLatencies, s.selectorLatencies} {
+		for _, t := range byKey {
+			trackers = append(trackers, t)
+		}
+	}
+	s.serverTimingLock.Lock()
+	for _, t := range s.serverTiming {
+		trackers = append(trackers, t)
+	}
+	s.serverTimingLock.Unlock()
+	for _, t := range trackers {
+		t.Bound(percentileEstimators[listConfig.estimator])
+	}
+	s.memoryDowngraded.Store(true)
+	s.recordEvent(runEventMemoryDowngrade, fmt.Sprintf("heap of %v bytes reached %.0f%% of --max-memory=%v, keeping %v estimates instead of all the latencies and writing %v of the sampled rows",
+		heap, memoryDowngradeFraction*100, budget, listConfig.estimator, memoryDowngradeSampleRate))
+	runtime.GC()
+}
+
+// Fraction of the successful calls written to the outputs, lowered once the accumulation got downgraded.
+func (s *listStats) rowSampleRate() float64 {
+	if s.memoryDowngraded.Load() {
+		return listConfig.sampleRate * memoryDowngradeSampleRate
+	}
+	return listConfig.sampleRate
+}
@@ -0,0 +1,76 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// Apiserver series scraped by --scrape-apiserver-metrics, the etcd histogram only through its count and sum.
+var scrapedMetrics = []string{
+	"apiserver_request_total",
+	"etcd_request_duration_seconds_count",
+	"etcd_request_duration_seconds_sum",
+}
+
+// Fetch the apiserver metrics and return the value of the scraped series, keyed by the series with their labels.
+func scrapeAPIServerMetrics(ctx context.Context, client *kubernetes.Clientset) (map[string]float64, error) {
+	data, err := client.CoreV1().RESTClient().Get().AbsPath("/metrics").DoRaw(ctx)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]float64{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		// Lines look like 'name{label="value",...} value', the labels can't contain spaces.
+		i := strings.LastIndexByte(line, ' ')
+		if i < 0 {
+			continue
+		}
+		series := line[:i]
+		name, _, _ := strings.Cut(series, "{")
+		if !slices.Contains(scrapedMetrics, name) {
+			continue
+		}
+		value, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			continue
+		}
+		values[series] = value
+	}
+	return values, scanner.Err()
+}
+
+// Change of every series between the two scrapes, leaving out the unchanged ones.
+func metricDeltas(before, after map[string]float64) map[string]float64 {
+	deltas := map[string]float64{}
+	for series, value := range after {
+		if delta := value - before[series]; delta != 0 {
+			deltas[series] = delta
+		}
+	}
+	return deltas
+}
@@ -0,0 +1,178 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	"github.com/rcrozean/kube-stress/pkg/client"
+	"github.com/rcrozean/kube-stress/pkg/util"
+)
+
+type MixConfig struct {
+	namespace     string
+	verbMix       string
+	objectSize    int
+	numClients    int
+	qps           float32
+	totalDuration time.Duration
+}
+
+var (
+	mixConfig *MixConfig
+	mixCmd    *cobra.Command
+)
+
+// Handlers for the verbs supported by --verb-mix, all operating on configmaps.
+var mixVerbs = map[string]func(ctx context.Context, client *kubernetes.Clientset) error{
+	"list": func(ctx context.Context, client *kubernetes.Clientset) error {
+		rc, err := client.CoreV1().RESTClient().Get().
+			Namespace(mixConfig.namespace).
+			Resource("configmaps").
+			Stream(ctx)
+		if rc != nil {
+			io.Copy(ioutil.Discard, rc)
+			rc.Close()
+		}
+		return err
+	},
+	"create": func(ctx context.Context, client *kubernetes.Clientset) error {
+		_, err := client.CoreV1().ConfigMaps(mixConfig.namespace).Create(ctx, newConfigMap(mixConfig.objectSize), metav1.CreateOptions{})
+		return err
+	},
+}
+
+func init() {
+	mixConfig = &MixConfig{}
+	mixCmd = &cobra.Command{
+		Use:   "mix",
+		Short: "Send a weighted mix of verbs for configmaps in the cluster",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := mixCommand(); err != nil {
+				klog.Errorf("Error executing mix command: %v", err)
+				os.Exit(1)
+			}
+		},
+	}
+	rootCmd.AddCommand(mixCmd)
+	mixCmd.Flags().StringVar(&mixConfig.namespace, "namespace", KubeStress, "Namespace where the configmaps are listed and created")
+	mixCmd.Flags().StringVar(&mixConfig.verbMix, "verb-mix", "list=9,create=1", "Weights of the verbs to send (supported verbs are 'list' and 'create')")
+	mixCmd.Flags().IntVar(&mixConfig.objectSize, "object-size-bytes", 40000, "Size of each configmap to be created")
+	mixCmd.Flags().IntVar(&mixConfig.numClients, "num-clients", 10, "Number of clients to use for spreading the calls")
+	mixCmd.Flags().Float32Var(&mixConfig.qps, "qps", 10.0, "QPS shared by all the verbs")
+	mixCmd.Flags().DurationVar(&mixConfig.totalDuration, "total-duration", 5*time.Minute, "Total duration for which to run this command")
+}
+
+// Counters and latencies of the calls for a single verb.
+type verbStats struct {
+	total     atomic.Uint64
+	failed    atomic.Uint64
+	latencies *util.LatencyTracker
+}
+
+func mixCommand() error {
+	if err := checkQPSPerClient(mixConfig.qps, mixConfig.numClients); err != nil {
+		return err
+	}
+	verbMix, err := util.ParseWeightedChoice(mixConfig.verbMix)
+	if err != nil {
+		return fmt.Errorf("invalid --verb-mix: %v", err)
+	}
+	stats := map[string]*verbStats{}
+	for _, verb := range verbMix.Names() {
+		if _, ok := mixVerbs[verb]; !ok {
+			return fmt.Errorf("unsupported verb '%v' in --verb-mix", verb)
+		}
+		stats[verb] = &verbStats{latencies: util.NewLatencyTracker()}
+	}
+	// Any share of the QPS may end up creating, as the verbs are picked at random.
+	if slices.Contains(verbMix.Names(), "create") {
+		if err := checkDestructive(destructiveCreate, float64(mixConfig.qps), mixConfig.namespace); err != nil {
+			return err
+		}
+	}
+
+	if err := checkFileDescriptors(mixConfig.numClients); err != nil {
+		return err
+	}
+	clients := client.CreateKubeClients(loadKubeConfig(mixCmd), mixConfig.numClients)
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	if err := waitForStart(ctx); err != nil {
+		return err
+	}
+	klog.V(1).Infof("Sending verb mix '%v' for configmaps in namespace '%v' using %v clients and QPS = %v for %v",
+		mixConfig.verbMix,
+		mixConfig.namespace,
+		mixConfig.numClients,
+		mixConfig.qps,
+		mixConfig.totalDuration)
+
+	start := time.Now()
+	ticker := time.NewTicker(time.Duration(1000000000.0/mixConfig.qps) * time.Nanosecond)
+	defer ticker.Stop()
+	defer reportMixStats(verbMix.Names(), stats)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for i := 0; time.Since(start) < mixConfig.totalDuration; i++ {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			client := clients[i%len(clients)]
+			verb := verbMix.Pick(rng)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				requestCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
+				defer cancel()
+				s := stats[verb]
+				s.total.Add(1)
+				requestStart := time.Now()
+				if err := mixVerbs[verb](requestCtx, client); err != nil {
+					s.failed.Add(1)
+					logRequestError("Error seen with %v call: %v", verb, err)
+					return
+				}
+				s.latencies.Record(time.Since(requestStart))
+			}()
+		}
+	}
+	return nil
+}
+
+func reportMixStats(verbs []string, stats map[string]*verbStats) {
+	for _, verb := range verbs {
+		s := stats[verb]
+		l := s.latencies.Summary()
+		klog.Infof("%v: %d out of %d requests failed, p50 = %v, p90 = %v, p99 = %v",
+			verb, s.failed.Load(), s.total.Load(), l.P50, l.P90, l.P99)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// Create the namespace if it doesn't exist yet, tolerating it being created concurrently.
+func ensureNamespace(ctx context.Context, client kubernetes.Interface, name string) error {
+	_, err := createNamespace(ctx, client, name)
+	return err
+}
+
+// Create the namespace unless it already exists, returning whether it was created.
+func createNamespace(ctx context.Context, client kubernetes.Interface, name string) (bool, error) {
+	if name == "" {
+		return false, fmt.Errorf("cannot create a namespace with an empty name")
+	}
+	namespace := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			// Below label helps selectively list/delete objects created by kube-stress.
+			Labels: map[string]string{
+				KubeStress: name,
+				RunIDLabel: runID,
+			},
+		},
+	}
+	_, err := client.CoreV1().Namespaces().Create(ctx, namespace, metav1.CreateOptions{})
+	switch {
+	case err == nil:
+		klog.V(1).Infof("Created namespace '%v'", name)
+		return true, nil
+	case apierrors.IsAlreadyExists(err):
+		klog.V(1).Infof("Namespace '%v' already exists", name)
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// Names of the namespaces spread across with a count of them, '<namespace>-<index>' like the ones of create's
+// --num-namespaces.
+func indexedNamespaces(namespace string, count int) []string {
+	names := make([]string, count)
+	for i := range names {
+		names[i] = fmt.Sprintf("%v-%d", namespace, i)
+	}
+	return names
+}
+
+// Delete the namespace along with its contents, tolerating it being already gone.
+func deleteNamespace(ctx context.Context, client kubernetes.Interface, name string) {
+	err := client.CoreV1().Namespaces().Delete(ctx, name, metav1.DeleteOptions{})
+	switch {
+	case err == nil:
+		klog.V(1).Infof("Deleted namespace '%v'", name)
+	case apierrors.IsNotFound(err):
+		klog.V(1).Infof("Namespace '%v' was already deleted", name)
+	default:
+		klog.Errorf("Failed to delete namespace '%v': %v", name, err)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"slices"
+	"sync"
+
+	"k8s.io/klog/v2"
+
+	"github.com/rcrozean/kube-stress/pkg/util"
+)
+
+// Supported values for --object-size-distribution.
+const (
+	sizeDistributionFixed     = "fixed"
+	sizeDistributionUniform   = "uniform"
+	sizeDistributionLognormal = "lognormal"
+)
+
+// Check the size flags of the create command against --object-size-distribution.
+func checkObjectSizeDistribution() error {
+	// --payload-min-size-bytes predates the distributions and alone keeps meaning uniform sizes.
+	if createConfig.minObjectSize > 0 && !createCmd.Flags().Changed("object-size-distribution") {
+		createConfig.sizeDistribution = sizeDistributionUniform
+	}
+	switch createConfig.sizeDistribution {
+	case sizeDistributionFixed:
+	case sizeDistributionUniform:
+		if createConfig.minObjectSize < 0 || createConfig.minObjectSize > createConfig.objectSize {
+			return fmt.Errorf("--payload-min-size-bytes must be between 0 and --object-size-bytes")
+		}
+	case sizeDistributionLognormal:
+		if createConfig.sizeSigma <= 0 {
+			return fmt.Errorf("--object-size-sigma must be positive")
+		}
+		if createConfig.minObjectSize < 0 || createConfig.minObjectSize > createConfig.objectSize || createConfig.objectSize > createConfig.maxObjectSize {
+			return fmt.Errorf("--object-size-bytes must be between --payload-min-size-bytes and --object-size-max-bytes")
+		}
+	default:
+		return fmt.Errorf("unsupported --object-size-distribution value '%v'", createConfig.sizeDistribution)
+	}
+	return nil
+}
+
+// Draw the size of the next object from --object-size-distribution, with the --seed generator.
+func nextObjectSize() int {
+	switch createConfig.sizeDistribution {
+	case sizeDistributionUniform:
+		return rng.IntRange(createConfig.minObjectSize, createConfig.objectSize)
+	case sizeDistributionLognormal:
+		// The median of a lognormal distribution is the exponential of the mean of its normal one.
+		size := float64(createConfig.objectSize) * math.Exp(createConfig.sizeSigma*rng.NormFloat64())
+		return int(min(max(size, float64(createConfig.minObjectSize)), float64(createConfig.maxObjectSize)))
+	}
+	return createConfig.objectSize
+}
+
+// Sizes of the objects created successfully, for the size histogram at the end of the run.
+type objectSizeTracker struct {
+	lock  sync.Mutex
+	sizes []int
+}
+
+var createdSizes = &objectSizeTracker{}
+
+func (t *objectSizeTracker) record(size int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.sizes = append(t.sizes, size)
+}
+
+// Log the percentiles of the sizes and their histogram, in power-of-two buckets.
+func (t *objectSizeTracker) report() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if len(t.sizes) == 0 {
+		return
+	}
+	sizes := slices.Clone(t.sizes)
+	slices.Sort(sizes)
+	klog.Infof("Sizes of the %d created objects ('%v' distribution): min = %v, p50 = %v, p90 = %v, p99 = %v, max = %v bytes",
+		len(sizes), createConfig.sizeDistribution, sizes[0],
+		util.Percentile(sizes, 50), util.Percentile(sizes, 90), util.Percentile(sizes, 99), sizes[len(sizes)-1])
+	if sizes[0] == sizes[len(sizes)-1] {
+		return
+	}
+	counts := make([]int, bits.Len(uint(sizes[len(sizes)-1]))+1)
+	for _, size := range sizes {
+		counts[bits.Len(uint(size))]++
+	}
+	for i, count := range counts {
+		if count == 0 {
+			continue
+		}
+		// Bucket i holds the sizes of i significant bits, 0 alone in the first one.
+		low, high := 0, 0
+		if i > 0 {
+			low, high = 1<<(i-1), 1<<i-1
+		}
+		klog.Infof("  [%v, %v] bytes: %d objects (%.1f%%)", low, high, count, float64(count)/float64(len(sizes))*100)
+	}
+}
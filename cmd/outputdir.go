@@ -0,0 +1,72 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+// Artifacts placed under --output-dir, by the flag setting their path.
+var outputDirArtifacts = []struct {
+	flag string
+	file string
+	// Flag which must be set to a non-zero value for the artifact to be written at all, if any.
+	requires string
+}{
+	{flag: "csv-output-filepath", file: "latency.csv"},
+	{flag: "summary-output-filepath", file: "summary.json"},
+	{flag: "manifest-output-filepath", file: "manifest.json"},
+	{flag: "histogram-output-filepath", file: "latency.hdr"},
+	{flag: "timeseries-output-filepath", file: "timeseries.csv"},
+	{flag: "plot-output-filepath", file: "latency.svg"},
+	{flag: "failure-sample-filepath", file: "failures.csv", requires: "failure-sample-body"},
+}
+
+// Create a timestamped directory under --output-dir and point the artifact flags of the command which
+// weren't explicitly set into it.
+func applyOutputDir(cmd *cobra.Command) error {
+	dir := filepath.Join(outputDir, clk.Now().Format("20060102-150405")+"-"+cmd.Name())
+	created := false
+	for _, artifact := range outputDirArtifacts {
+		f := cmd.Flags().Lookup(artifact.flag)
+		if f == nil || f.Changed {
+			continue
+		}
+		if artifact.requires != "" {
+			if r := cmd.Flags().Lookup(artifact.requires); r == nil || r.Value.String() == r.DefValue {
+				continue
+			}
+		}
+		if !created {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return fmt.Errorf("failed to create the output directory: %v", err)
+			}
+			created = true
+		}
+		// Setting the value directly leaves the flag as not changed, like a default.
+		if err := f.Value.Set(filepath.Join(dir, artifact.file)); err != nil {
+			return err
+		}
+	}
+	if created {
+		klog.Infof("Writing the run artifacts to %v", dir)
+	}
+	return nil
+}
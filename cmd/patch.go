@@ -0,0 +1,326 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+
+	"github.com/rcrozean/kube-stress/pkg/client"
+	"github.com/rcrozean/kube-stress/pkg/util"
+)
+
+type PatchConfig struct {
+	namespace         string
+	objectType        string
+	name              string
+	patchType         string
+	patchBody         string
+	patchFile         string
+	numClients        int
+	qps               float32
+	totalDuration     time.Duration
+	csvOutputFilepath string
+	// What the default patches change, and the label rotated among its values by the label ones.
+	churn            string
+	churnLabelKey    string
+	churnLabelValues []string
+}
+
+// Supported values for --patch-type.
+var patchTypes = map[string]types.PatchType{
+	"json":      types.JSONPatchType,
+	"merge":     types.MergePatchType,
+	"strategic": types.StrategicMergePatchType,
+}
+
+// Supported values for --churn.
+const (
+	churnAnnotation = "annotation"
+	churnLabel      = "label"
+	// Alternating between the annotation and label patches.
+	churnBoth = "both"
+)
+
+// Annotation set to the time of the patch by the annotation churn, which changes the object each time.
+const patchedAtAnnotation = KubeStress + "/patched-at"
+
+var (
+	patchConfig *PatchConfig
+	patchCmd    *cobra.Command
+)
+
+func init() {
+	patchConfig = &PatchConfig{}
+	patchCmd = &cobra.Command{
+		Use:   "patch",
+		Short: "Repeatedly patch objects of a given type in the cluster",
+		Run: func(cmd *cobra.Command, args []string) {
+			if patchConfig.csvOutputFilepath != "" {
+				csvWriter = util.NewThreadSafeCsvWriter(patchConfig.csvOutputFilepath)
+				defer csvWriter.Flush()
+			}
+			if err := patchCommand(); err != nil {
+				klog.Errorf("Error executing patch command: %v", err)
+				os.Exit(1)
+			}
+		},
+	}
+	rootCmd.AddCommand(patchCmd)
+	patchCmd.Flags().StringVar(&patchConfig.namespace, "namespace", KubeStress, "Namespace of the objects to patch (empty value means all namespaces, only without --name)")
+	patchCmd.Flags().StringVar(&patchConfig.objectType, "object-type", "configmaps", "Type of objects to patch (any core/v1 resource, e.g 'pods' and 'configmaps')")
+	patchCmd.Flags().StringVar(&patchConfig.name, "name", "", "Name of the single object to patch (empty means patch random objects listed at startup)")
+	patchCmd.Flags().StringVar(&patchConfig.patchType, "patch-type", "merge", "Type of the patch: 'json', 'merge' or 'strategic'")
+	patchCmd.Flags().StringVar(&patchConfig.patchBody, "patch-body", "", "Body of the patch (defaults to setting an annotation to the current time for merge and strategic patches)")
+	patchCmd.Flags().StringVar(&patchConfig.patchFile, "patch-from-file", "", "Path to a file holding the body of the patch")
+	patchCmd.Flags().IntVar(&patchConfig.numClients, "num-clients", 10, "Number of clients to use for spreading the patch calls")
+	patchCmd.Flags().Float32Var(&patchConfig.qps, "qps", 10.0, "QPS to generate for the patch calls")
+	patchCmd.Flags().DurationVar(&patchConfig.totalDuration, "total-duration", 5*time.Minute, "Total duration for which to run this command")
+	patchCmd.Flags().StringVar(&patchConfig.csvOutputFilepath, "csv-output-filepath", "", "Path to the output CSV file where latency values will be written")
+	patchCmd.Flags().StringVar(&patchConfig.churn, "churn", churnAnnotation, "What the default patches change: 'annotation' (an annotation set to the current time), 'label' (rotating the value of --churn-label-key, which updates the label index of the watch cache and re-evaluates the label-filtered watches) or 'both' (alternating, with their latencies reported separately)")
+	patchCmd.Flags().StringVar(&patchConfig.churnLabelKey, "churn-label-key", KubeStress+"/churn", "Label whose value the label patches rotate")
+	patchCmd.Flags().StringSliceVar(&patchConfig.churnLabelValues, "churn-label-values", []string{"a", "b", "c"}, "Comma-separated values the label patches rotate each object's --churn-label-key among, in order")
+}
+
+func patchCommand() error {
+	if err := checkQPSPerClient(patchConfig.qps, patchConfig.numClients); err != nil {
+		return err
+	}
+	patchType, ok := patchTypes[patchConfig.patchType]
+	if !ok {
+		return fmt.Errorf("unsupported --patch-type value '%v'", patchConfig.patchType)
+	}
+	if patchConfig.patchBody != "" && patchConfig.patchFile != "" {
+		return fmt.Errorf("--patch-body and --patch-from-file are mutually exclusive")
+	}
+	var body []byte
+	if patchConfig.patchBody != "" {
+		body = []byte(patchConfig.patchBody)
+	} else if patchConfig.patchFile != "" {
+		data, err := os.ReadFile(patchConfig.patchFile)
+		if err != nil {
+			return fmt.Errorf("failed to read the patch: %v", err)
+		}
+		body = data
+	} else if patchType == types.JSONPatchType {
+		return fmt.Errorf("--patch-type=json requires --patch-body or --patch-from-file")
+	}
+	switch patchConfig.churn {
+	case churnAnnotation:
+	case churnLabel, churnBoth:
+		if body != nil {
+			return fmt.Errorf("--churn=%v only applies to the default patches, without --patch-body or --patch-from-file", patchConfig.churn)
+		}
+		if errs := validation.IsQualifiedName(patchConfig.churnLabelKey); len(errs) > 0 {
+			return fmt.Errorf("invalid --churn-label-key: %v", strings.Join(errs, ", "))
+		}
+		if len(patchConfig.churnLabelValues) < 2 {
+			return fmt.Errorf("--churn-label-values needs at least 2 values for the label to change")
+		}
+		for _, value := range patchConfig.churnLabelValues {
+			if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+				return fmt.Errorf("invalid --churn-label-values value '%v': %v", value, strings.Join(errs, ", "))
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported --churn value '%v'", patchConfig.churn)
+	}
+	if err := checkDestructive(destructivePatch, float64(patchConfig.qps), patchConfig.namespace); err != nil {
+		return err
+	}
+
+	if err := checkFileDescriptors(patchConfig.numClients); err != nil {
+		return err
+	}
+	clients := client.CreateKubeClients(loadKubeConfig(patchCmd), patchConfig.numClients)
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	pool := newNamePool()
+	if patchConfig.name != "" {
+		pool.add(patchConfig.namespace + "/" + patchConfig.name)
+	} else {
+		var err error
+		if pool, err = listNamePool(ctx, clients[0], patchConfig.namespace, patchConfig.objectType); err != nil {
+			return err
+		}
+	}
+	if pool.size() == 0 {
+		return fmt.Errorf("no '%v' objects to patch in namespace '%v'", patchConfig.objectType, patchConfig.namespace)
+	}
+
+	if err := waitForStart(ctx); err != nil {
+		return err
+	}
+	klog.V(1).Infof("Patching %v '%v' objects in namespace '%v' with %v patches (%v) using %v clients and QPS = %v for %v",
+		pool.size(),
+		patchConfig.objectType,
+		patchConfig.namespace,
+		patchConfig.patchType,
+		describePatchKinds(body),
+		patchConfig.numClients,
+		patchConfig.qps,
+		patchConfig.totalDuration)
+	patchObjects(ctx, clients, pool, patchType, body)
+	return nil
+}
+
+// Kind of the patches of a --patch-body or --patch-from-file.
+const patchKindCustom = "custom"
+
+// Kinds of the patches sent in turn, the default ones churning an annotation and/or a label.
+func patchKinds(body []byte) []string {
+	switch {
+	case body != nil:
+		return []string{patchKindCustom}
+	case patchConfig.churn == churnBoth:
+		return []string{churnAnnotation, churnLabel}
+	default:
+		return []string{patchConfig.churn}
+	}
+}
+
+func describePatchKind(kind string) string {
+	if kind == patchKindCustom {
+		return "custom body"
+	}
+	return kind + " churn"
+}
+
+func describePatchKinds(body []byte) string {
+	var descriptions []string
+	for _, kind := range patchKinds(body) {
+		descriptions = append(descriptions, describePatchKind(kind))
+	}
+	return strings.Join(descriptions, " and ")
+}
+
+// Next value of the rotated label of each object, so that every label patch changes it.
+type labelRotation struct {
+	lock sync.Mutex
+	next map[string]int
+}
+
+func (r *labelRotation) value(key string) string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	i := r.next[key]
+	r.next[key] = (i + 1) % len(patchConfig.churnLabelValues)
+	return patchConfig.churnLabelValues[i]
+}
+
+func patchObjects(ctx context.Context, clients []*kubernetes.Clientset, pool *namePool, patchType types.PatchType, body []byte) {
+	start := time.Now()
+	ticker := time.NewTicker(time.Duration(1000000000.0/patchConfig.qps) * time.Nanosecond)
+	defer ticker.Stop()
+
+	var totalCount, failedCount, conflictCount atomic.Uint64
+	kinds := patchKinds(body)
+	latencies := make(map[string]*util.LatencyTracker, len(kinds))
+	for _, kind := range kinds {
+		latencies[kind] = util.NewLatencyTracker()
+	}
+	labels := &labelRotation{next: map[string]int{}}
+	defer func() {
+		fc, tc := failedCount.Load(), totalCount.Load()
+		klog.Infof("%d out of %d requests failed, failure rate: %v%%", fc, tc, float64(fc)/float64(tc)*100)
+		klog.Infof("%d conflicts were retried", conflictCount.Load())
+		for _, kind := range kinds {
+			l := latencies[kind].Summary()
+			klog.Infof("Patch latency (%v, %v): p50 = %v, p90 = %v, p99 = %v", patchConfig.patchType, describePatchKind(kind), l.P50, l.P90, l.P99)
+		}
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for i := 0; time.Since(start) < patchConfig.totalDuration; i++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			key, _ := pool.pick(rng)
+			client := clients[i%len(clients)]
+			kind := kinds[i%len(kinds)]
+			patchBody := body
+			if kind == churnLabel {
+				patchBody = []byte(fmt.Sprintf(`{"metadata":{"labels":{%q:%q}}}`, patchConfig.churnLabelKey, labels.value(key)))
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				totalCount.Add(1)
+				// Patches only conflict when they carry a resourceVersion precondition, retrying them is then safe.
+				err := retry.OnError(retry.DefaultRetry, apierrors.IsConflict, func() error {
+					err := patchOnce(ctx, client, key, patchType, patchBody, latencies[kind])
+					if apierrors.IsConflict(err) {
+						conflictCount.Add(1)
+					}
+					return err
+				})
+				if err != nil {
+					failedCount.Add(1)
+					logRequestError("Error seen with patch call: %v", err)
+				}
+			}()
+		}
+	}
+}
+
+func patchOnce(ctx context.Context, client *kubernetes.Clientset, key string, patchType types.PatchType, body []byte, latencies *util.LatencyTracker) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	if body == nil {
+		// The patch has to change the object each time, the server skips the write of no-op patches.
+		body = []byte(fmt.Sprintf(`{"metadata":{"annotations":{"%v":"%v"}}}`, patchedAtAnnotation, time.Now().Format(time.RFC3339Nano)))
+	}
+	requestCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	err = client.CoreV1().RESTClient().Patch(patchType).
+		Namespace(namespace).
+		Resource(patchConfig.objectType).
+		Name(name).
+		Body(body).
+		Do(requestCtx).
+		Error()
+	if err != nil {
+		return err
+	}
+
+	latency := time.Since(start)
+	latencies.Record(latency)
+	if csvWriter != nil {
+		csvWriter.Write([]string{formatLatency(latency), patchConfig.patchType, runID})
+	}
+	klog.V(2).Infof("Patch call for %v took: %v", key, latency)
+	return nil
+}
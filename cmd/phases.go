@@ -0,0 +1,134 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/rcrozean/kube-stress/pkg/client"
+)
+
+// Event of the Chrome trace event format, loadable into trace viewers (e.g Perfetto and speedscope) and
+// convertible to flamegraphs. Complete events nest by time on the same thread.
+type traceEvent struct {
+	Name  string `json:"name"`
+	Phase string `json:"ph"`
+	// Timestamp and duration in microseconds.
+	TS   float64        `json:"ts"`
+	Dur  float64        `json:"dur"`
+	PID  int            `json:"pid"`
+	TID  uint64         `json:"tid"`
+	Args map[string]any `json:"args,omitempty"`
+}
+
+// Writes the phases of the sampled list calls to --trace-phases-output, a list call per thread.
+type phaseTraceWriter struct {
+	lock   sync.Mutex
+	file   *os.File
+	buf    *bufio.Writer
+	events int
+}
+
+// Writes the phase traces of the list calls, only set with --trace-phases-output.
+var phaseTraces *phaseTraceWriter
+
+func newPhaseTraceWriter(fileName string) (*phaseTraceWriter, error) {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return nil, err
+	}
+	w := &phaseTraceWriter{file: file, buf: bufio.NewWriter(file)}
+	w.buf.WriteString("[\n")
+	return w, nil
+}
+
+// Phases of a request, between the times of its round trip they start and end at, the dial and TLS handshake
+// nesting in the wait for a connection.
+var requestPhaseSpans = []struct {
+	name       string
+	start, end func(p *client.RequestPhases) time.Time
+}{
+	{"rate_limiter_wait", func(p *client.RequestPhases) time.Time { return p.Start }, func(p *client.RequestPhases) time.Time { return p.GetConn }},
+	{"get_conn", func(p *client.RequestPhases) time.Time { return p.GetConn }, func(p *client.RequestPhases) time.Time { return p.GotConn }},
+	{"dial", func(p *client.RequestPhases) time.Time { return p.ConnectStart }, func(p *client.RequestPhases) time.Time { return p.ConnectDone }},
+	{"tls_handshake", func(p *client.RequestPhases) time.Time { return p.TLSStart }, func(p *client.RequestPhases) time.Time { return p.TLSDone }},
+	{"send", func(p *client.RequestPhases) time.Time { return p.GotConn }, func(p *client.RequestPhases) time.Time { return p.WroteRequest }},
+	{"ttfb", func(p *client.RequestPhases) time.Time { return p.WroteRequest }, func(p *client.RequestPhases) time.Time { return p.FirstByte }},
+	{"body_drain", func(p *client.RequestPhases) time.Time { return p.FirstByte }, func(p *client.RequestPhases) time.Time { return p.BodyDone }},
+}
+
+// Write the spans of a list call: one for the whole call, one for each of its requests (e.g its pages) and
+// one for each phase of these.
+func (w *phaseTraceWriter) write(listID uint64, clientIndex int, namespace string, status int, trace *client.PhaseTrace) {
+	end := time.Now()
+	requests := trace.Requests()
+	events := []traceEvent{span("list", trace.Start, end, listID, map[string]any{"client_index": clientIndex, "namespace": namespace, "status": status})}
+	for i, r := range requests {
+		requestEnd := r.BodyDone
+		if requestEnd.IsZero() {
+			requestEnd = end
+		}
+		events = append(events, span("request", r.Start, requestEnd, listID, map[string]any{"index": i}))
+		for _, phase := range requestPhaseSpans {
+			if start, end := phase.start(&r), phase.end(&r); !start.IsZero() && !end.IsZero() {
+				events = append(events, span(phase.name, start, end, listID, nil))
+			}
+		}
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			klog.Errorf("Failed to encode a phase trace: %v", err)
+			return
+		}
+		if w.events > 0 {
+			w.buf.WriteString(",\n")
+		}
+		w.buf.Write(data)
+		w.events++
+	}
+}
+
+func span(name string, start, end time.Time, listID uint64, args map[string]any) traceEvent {
+	return traceEvent{
+		Name:  name,
+		Phase: "X",
+		TS:    float64(start.UnixNano()) / 1e3,
+		Dur:   float64(end.Sub(start).Nanoseconds()) / 1e3,
+		PID:   1,
+		TID:   listID,
+		Args:  args,
+	}
+}
+
+func (w *phaseTraceWriter) Close() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.buf.WriteString("\n]\n")
+	if err := w.buf.Flush(); err != nil {
+		klog.Errorf("Failed to write the phase traces: %v", err)
+	}
+	if err := w.file.Close(); err != nil {
+		klog.Errorf("Failed to close file: %v", err)
+	}
+}
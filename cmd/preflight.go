@@ -0,0 +1,87 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	"github.com/rcrozean/kube-stress/pkg/client"
+)
+
+// Number of names of a name pool checked to exist before the run.
+const preflightSampleSize = 5
+
+// Fail with --require-objects (or warn otherwise) when a run would target an empty collection.
+func preflightFailure(msg string) error {
+	if requireObjects {
+		return errors.New(msg)
+	}
+	klog.Warningf("%v, the run will measure requests for nothing", msg)
+	return nil
+}
+
+// Check with a single-item list that there are objects to list.
+func preflightObjects(ctx context.Context, restClient restclient.Interface, namespace, objectType, fieldSelector string) error {
+	list, err := restClient.Get().
+		Namespace(namespace).
+		Resource(objectType).
+		VersionedParams(&metav1.ListOptions{Limit: 1, FieldSelector: fieldSelector}, scheme.ParameterCodec).
+		Do(ctx).
+		Get()
+	if errors.Is(err, client.ErrDryRun) {
+		// Nothing to check as the dry run doesn't reach the server, leaving it to log the requests of the run.
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("preflight list failed: %v", err)
+	}
+	if meta.LenList(list) == 0 {
+		return preflightFailure(fmt.Sprintf("no '%v' objects found in namespace '%v'", objectType, namespace))
+	}
+	return nil
+}
+
+// Check that a random sample of the names of a pool actually exist.
+func preflightNames(ctx context.Context, kubeClient *kubernetes.Clientset, objectType string, pool *namePool) error {
+	if pool.size() == 0 {
+		return preflightFailure(fmt.Sprintf("no '%v' object names to target", objectType))
+	}
+	missing := 0
+	for i := 0; i < preflightSampleSize && i < pool.size(); i++ {
+		key, _ := pool.pick(rng)
+		namespace, name, err := cache.SplitMetaNamespaceKey(key)
+		if err != nil {
+			return err
+		}
+		if err := kubeClient.CoreV1().RESTClient().Get().Namespace(namespace).Resource(objectType).Name(name).Do(ctx).Error(); err != nil {
+			klog.V(1).Infof("Preflight get of %v failed: %v", key, err)
+			missing++
+		}
+	}
+	if missing > 0 {
+		return preflightFailure(fmt.Sprintf("%d out of %d sampled '%v' objects couldn't be fetched", missing, min(preflightSampleSize, pool.size()), objectType))
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	"github.com/rcrozean/kube-stress/pkg/client"
+	"github.com/rcrozean/kube-stress/pkg/util"
+)
+
+type PropagationConfig struct {
+	namespace     string
+	objectSize    int
+	qps           float32
+	totalDuration time.Duration
+	pollInterval  time.Duration
+	timeout       time.Duration
+}
+
+var (
+	propagationConfig *PropagationConfig
+	propagationCmd    *cobra.Command
+)
+
+func init() {
+	propagationConfig = &PropagationConfig{}
+	propagationCmd = &cobra.Command{
+		Use:   "propagation",
+		Short: "Measure how long created objects take to show up in watches and cached lists",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := propagationCommand(); err != nil {
+				klog.Errorf("Error executing propagation command: %v", err)
+				os.Exit(1)
+			}
+		},
+	}
+	rootCmd.AddCommand(propagationCmd)
+	propagationCmd.Flags().StringVar(&propagationConfig.namespace, "namespace", KubeStress, "Namespace where the test configmaps will be created")
+	propagationCmd.Flags().IntVar(&propagationConfig.objectSize, "object-size-bytes", 1000, "Size of each configmap to be created")
+	propagationCmd.Flags().Float32Var(&propagationConfig.qps, "qps", 1.0, "Rate at which configmaps are created")
+	propagationCmd.Flags().DurationVar(&propagationConfig.totalDuration, "total-duration", 5*time.Minute, "Total duration for which to run this command")
+	propagationCmd.Flags().DurationVar(&propagationConfig.pollInterval, "poll-interval", 10*time.Millisecond, "Interval between the cached list calls polling for a created configmap")
+	propagationCmd.Flags().DurationVar(&propagationConfig.timeout, "propagation-timeout", 30*time.Second, "How long to wait for a created configmap to be seen before giving up")
+}
+
+// Delays measured from the start of each create call.
+type propagationStats struct {
+	createLatencies *util.LatencyTracker
+	watchDelays     *util.LatencyTracker
+	listDelays      *util.LatencyTracker
+	failedCreates   atomic.Uint64
+	watchTimeouts   atomic.Uint64
+	listTimeouts    atomic.Uint64
+}
+
+// Watches the configmaps of this run and notifies the waiters registered for each name.
+type propagationWatcher struct {
+	lock    sync.Mutex
+	waiters map[string]chan time.Time
+}
+
+func (w *propagationWatcher) register(name string) <-chan time.Time {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	ch := make(chan time.Time, 1)
+	w.waiters[name] = ch
+	return ch
+}
+
+func (w *propagationWatcher) unregister(name string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	delete(w.waiters, name)
+}
+
+func (w *propagationWatcher) run(ctx context.Context, client *kubernetes.Clientset, selector string) error {
+	watcher, err := client.CoreV1().ConfigMaps(propagationConfig.namespace).Watch(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return err
+	}
+	go func() {
+		defer watcher.Stop()
+		for event := range watcher.ResultChan() {
+			received := time.Now()
+			configmap, ok := event.Object.(*corev1.ConfigMap)
+			if event.Type != watch.Added || !ok {
+				continue
+			}
+			w.lock.Lock()
+			if ch, ok := w.waiters[configmap.Name]; ok {
+				ch <- received
+				delete(w.waiters, configmap.Name)
+			}
+			w.lock.Unlock()
+		}
+	}()
+	return nil
+}
+
+func propagationCommand() error {
+	if err := checkDestructive(destructiveCreate, float64(propagationConfig.qps), propagationConfig.namespace); err != nil {
+		return err
+	}
+	clients := client.CreateKubeClients(loadKubeConfig(propagationCmd), 3)
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	watcher := &propagationWatcher{waiters: map[string]chan time.Time{}}
+	if err := watcher.run(ctx, clients[1], labels.Set{RunIDLabel: runID}.String()); err != nil {
+		return fmt.Errorf("failed to start the watch: %v", err)
+	}
+
+	if err := waitForStart(ctx); err != nil {
+		return err
+	}
+	klog.V(1).Infof("Measuring propagation of configmaps created in namespace '%v' with QPS = %v for %v",
+		propagationConfig.namespace,
+		propagationConfig.qps,
+		propagationConfig.totalDuration)
+
+	stats := &propagationStats{
+		createLatencies: util.NewLatencyTracker(),
+		watchDelays:     util.NewLatencyTracker(),
+		listDelays:      util.NewLatencyTracker(),
+	}
+	defer reportPropagationStats(stats)
+
+	start := time.Now()
+	ticker := time.NewTicker(time.Duration(1000000000.0/propagationConfig.qps) * time.Nanosecond)
+	defer ticker.Stop()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for time.Since(start) < propagationConfig.totalDuration {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				measurePropagation(ctx, clients[0], clients[2], watcher, stats)
+			}()
+		}
+	}
+	return nil
+}
+
+// Create a configmap, then wait for it to be seen both by the watch and by cached list calls.
+func measurePropagation(ctx context.Context, writer, reader *kubernetes.Clientset, watcher *propagationWatcher, stats *propagationStats) {
+	configmap := newConfigMap(propagationConfig.objectSize)
+	seenByWatch := watcher.register(configmap.Name)
+	defer watcher.unregister(configmap.Name)
+
+	start := time.Now()
+	if _, err := writer.CoreV1().ConfigMaps(propagationConfig.namespace).Create(ctx, configmap, metav1.CreateOptions{}); err != nil {
+		stats.failedCreates.Add(1)
+		logRequestError("Failed to create object: %v", err)
+		return
+	}
+	stats.createLatencies.Record(time.Since(start))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case received := <-seenByWatch:
+			stats.watchDelays.Record(received.Sub(start))
+		case <-time.After(propagationConfig.timeout):
+			stats.watchTimeouts.Add(1)
+		case <-ctx.Done():
+		}
+	}()
+
+	// Poll the watch cache (resourceVersion=0) until the configmap shows up in a list.
+	opts := metav1.ListOptions{
+		ResourceVersion: "0",
+		FieldSelector:   fields.OneTermEqualSelector("metadata.name", configmap.Name).String(),
+	}
+	for {
+		list, err := reader.CoreV1().ConfigMaps(propagationConfig.namespace).List(ctx, opts)
+		if err == nil && len(list.Items) > 0 {
+			stats.listDelays.Record(time.Since(start))
+			break
+		}
+		if time.Since(start) > propagationConfig.timeout {
+			stats.listTimeouts.Add(1)
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(propagationConfig.pollInterval):
+		}
+	}
+	wg.Wait()
+}
+
+func reportPropagationStats(stats *propagationStats) {
+	c, w, l := stats.createLatencies.Summary(), stats.watchDelays.Summary(), stats.listDelays.Summary()
+	klog.Infof("Created %d configmaps (%d failed), create latency: p50 = %v, p99 = %v", c.Count, stats.failedCreates.Load(), c.P50, c.P99)
+	klog.Infof("Watch propagation delay: p50 = %v, p90 = %v, p99 = %v, max = %v (%d timeouts)", w.P50, w.P90, w.P99, w.Max, stats.watchTimeouts.Load())
+	klog.Infof("Cached list propagation delay: p50 = %v, p90 = %v, p99 = %v, max = %v (%d timeouts)", l.P50, l.P90, l.P99, l.Max, stats.listTimeouts.Load())
+}
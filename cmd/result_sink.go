@@ -0,0 +1,256 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/rcrozean/kube-stress/pkg/util"
+)
+
+// ResultSink receives a row for every successful list call (and each of its pages with --follow-continue),
+// or for every event received by the watch command, several sinks being possibly active at once. Sinks are safe for concurrent use and nothing is recorded
+// after they get closed.
+type ResultSink interface {
+	Record(row *listRow)
+	Close()
+}
+
+// Writes the --csv-columns of the rows to --csv-output-filepath.
+type csvResultSink struct {
+	writer util.CsvWriter
+}
+
+func (s *csvResultSink) Record(row *listRow) {
+	s.writer.Write(row.csv(csvColumns))
+}
+
+func (s *csvResultSink) Close() {
+	s.writer.Flush()
+}
+
+// Writes the --csv-columns of the rows to --jsonl-output-filepath, as a JSON object per line.
+type jsonResultSink struct {
+	lock    sync.Mutex
+	file    *os.File
+	buf     *bufio.Writer
+	encoder *json.Encoder
+}
+
+func newJSONResultSink(fileName string) (*jsonResultSink, error) {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return nil, err
+	}
+	buf := bufio.NewWriter(file)
+	return &jsonResultSink{file: file, buf: buf, encoder: json.NewEncoder(buf)}, nil
+}
+
+func (s *jsonResultSink) Record(row *listRow) {
+	values := row.csv(csvColumns)
+	object := make(map[string]string, len(values))
+	for i, column := range csvColumns {
+		object[column] = values[i]
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.encoder.Encode(object); err != nil {
+		klog.Errorf("Failed to write a JSON result: %v", err)
+	}
+}
+
+func (s *jsonResultSink) Close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.buf.Flush(); err != nil {
+		klog.Errorf("Failed to write the JSON results: %v", err)
+	}
+	if err := s.file.Close(); err != nil {
+		klog.Errorf("Failed to close file: %v", err)
+	}
+}
+
+// Measurements of the rows written by the Influx sink, for the list calls and the watch events.
+const (
+	influxMeasurement      = "kube_stress_request"
+	influxEventMeasurement = "kube_stress_watch_event"
+)
+
+// Timestamp precisions supported by --influx-precision, as named by the InfluxDB write API.
+var influxPrecisions = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+}
+
+// Lines buffered by the Influx sink before they're sent to an HTTP endpoint.
+const influxBatchLines = 5000
+
+// Escapes the commas, equal signs and spaces of the tag keys and values of the line protocol.
+var influxTagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// Writes the rows to --influx-output in InfluxDB line protocol, either to a file or in batches to the write
+// endpoint given as an HTTP(S) URL.
+type influxResultSink struct {
+	lock      sync.Mutex
+	precision time.Duration
+	buf       bytes.Buffer
+	lines     int
+	// Only set for a file output.
+	file *os.File
+	// Only set for an HTTP output, the batches being sent one at a time in the background.
+	url     string
+	sending sync.WaitGroup
+	sendMu  sync.Mutex
+}
+
+func newInfluxResultSink(output, precision string) (*influxResultSink, error) {
+	unit, ok := influxPrecisions[precision]
+	if !ok {
+		return nil, fmt.Errorf("unsupported --influx-precision value '%v' (supported values are 'ns', 'us', 'ms' and 's')", precision)
+	}
+	sink := &influxResultSink{precision: unit}
+	if !strings.HasPrefix(output, "http://") && !strings.HasPrefix(output, "https://") {
+		file, err := os.Create(output)
+		if err != nil {
+			return nil, err
+		}
+		sink.file = file
+		return sink, nil
+	}
+	u, err := url.Parse(output)
+	if err != nil {
+		return nil, err
+	}
+	// The server must parse the timestamps in the precision they're written in.
+	query := u.Query()
+	query.Set("precision", precision)
+	u.RawQuery = query.Encode()
+	sink.url = u.String()
+	return sink, nil
+}
+
+// Format a row as a line of the line protocol, leaving out the tags without a value which it doesn't allow.
+func influxLine(row *listRow, precision time.Duration) string {
+	if row.eventType != "" {
+		return influxEventLine(row, precision)
+	}
+	var line strings.Builder
+	line.WriteString(influxMeasurement)
+	result := "success"
+	if row.truncated {
+		result = "truncated"
+	}
+	for _, tag := range [][2]string{{"result", result}, {"resource", listResource}, {"namespace", row.namespace}} {
+		if tag[1] != "" {
+			fmt.Fprintf(&line, ",%v=%v", tag[0], influxTagEscaper.Replace(tag[1]))
+		}
+	}
+	latencyMS := strconv.FormatFloat(float64(row.latency)/float64(time.Millisecond), 'f', -1, 64)
+	fmt.Fprintf(&line, " latency_ms=%v,bytes=%di %d\n", latencyMS, row.bodyBytes, row.start.UnixNano()/int64(precision))
+	return line.String()
+}
+
+// Format the row of a watch event, tagged by event type, resource and namespace.
+func influxEventLine(row *listRow, precision time.Duration) string {
+	var line strings.Builder
+	line.WriteString(influxEventMeasurement)
+	for _, tag := range [][2]string{{"event_type", row.eventType}, {"resource", watchConfig.objectType}, {"namespace", row.namespace}} {
+		if tag[1] != "" {
+			fmt.Fprintf(&line, ",%v=%v", tag[0], influxTagEscaper.Replace(tag[1]))
+		}
+	}
+	fmt.Fprintf(&line, " object_key=%v,resource_version=%v", strconv.Quote(row.objectKey), strconv.Quote(row.resourceVersion))
+	if row.deliveryTimed {
+		fmt.Fprintf(&line, ",delivery_latency_ms=%v", strconv.FormatFloat(float64(row.deliveryLatency)/float64(time.Millisecond), 'f', -1, 64))
+	}
+	fmt.Fprintf(&line, " %d\n", row.start.UnixNano()/int64(precision))
+	return line.String()
+}
+
+func (s *influxResultSink) Record(row *listRow) {
+	line := influxLine(row, s.precision)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.buf.WriteString(line)
+	s.lines++
+	if s.lines >= influxBatchLines {
+		s.flush()
+	}
+}
+
+// Write out the buffered lines, to be called with the lock held.
+func (s *influxResultSink) flush() {
+	if s.lines == 0 {
+		return
+	}
+	if s.file != nil {
+		if _, err := s.file.Write(s.buf.Bytes()); err != nil {
+			klog.Errorf("Failed to write the Influx results: %v", err)
+		}
+	} else {
+		batch := bytes.Clone(s.buf.Bytes())
+		s.sending.Add(1)
+		go func() {
+			defer s.sending.Done()
+			s.send(batch)
+		}()
+	}
+	s.buf.Reset()
+	s.lines = 0
+}
+
+// Send a batch of lines to the HTTP write endpoint.
+func (s *influxResultSink) send(batch []byte) {
+	// Keeps the batches in order, and the endpoint from getting more than a write at a time.
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	resp, err := http.Post(s.url, "text/plain; charset=utf-8", bytes.NewReader(batch))
+	if err != nil {
+		klog.Errorf("Failed to send the Influx results: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		klog.Errorf("Failed to send the Influx results: %v: %s", resp.Status, body)
+	}
+}
+
+func (s *influxResultSink) Close() {
+	s.lock.Lock()
+	s.flush()
+	s.lock.Unlock()
+	s.sending.Wait()
+	if s.file != nil {
+		if err := s.file.Close(); err != nil {
+			klog.Errorf("Failed to close file: %v", err)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux || darwin
+
+package cmd
+
+import (
+	"fmt"
+	"syscall"
+
+	"k8s.io/klog/v2"
+)
+
+// Make sure the process can open a file descriptor for every connection of the clients, raising the soft limit
+// up to the hard one if needed (which recent go runtimes already do at startup), or fail with a clear error
+// instead of the connection errors looking like server failures down the line.
+func checkFileDescriptors(numClients int) error {
+	needed := uint64(numClients*fileDescriptorsPerClient + reservedFileDescriptors)
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		klog.Warningf("Failed to get the file descriptor limit: %v", err)
+		return nil
+	}
+	if limit.Cur >= needed {
+		return nil
+	}
+	if limit.Max >= needed {
+		raised := limit
+		raised.Cur = needed
+		if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &raised); err == nil {
+			klog.V(1).Infof("Raised the file descriptor limit from %d to %d for %d clients", limit.Cur, needed, numClients)
+			return nil
+		}
+	}
+	return fmt.Errorf("%d clients need about %d file descriptors but the limit is %d, raise it with 'ulimit -n %d'", numClients, needed, limit.Cur, needed)
+}
@@ -15,26 +15,137 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
+	"math"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
+	restclient "k8s.io/client-go/rest"
 	"k8s.io/client-go/util/homedir"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
+
+	"github.com/rcrozean/kube-stress/pkg/client"
+	"github.com/rcrozean/kube-stress/pkg/util"
 )
 
 const (
 	KubeStress = "kube-stress"
+	// Label set on the objects created by kube-stress, identifying the run which created them.
+	RunIDLabel = KubeStress + "/run-id"
+)
+
+// Reasons for a run to stop before its total duration.
+const (
+	stopReasonSignal     = "signal"
+	stopReasonFirstError = "first-error"
+	// The server served JSON while protobuf was required, with --protobuf-accept-json-fallback=false.
+	stopReasonProtobufFallback = "protobuf-fallback"
+)
+
+// Exit codes telling apart runs cut short from clean finishes (0) and failures (1).
+const (
+	// Stopped by SIGTERM or SIGINT, following the shell convention for SIGINT.
+	exitCodeSignal = 130
+	// Stopped by kube-stress itself, e.g with --abort-on-first-error.
+	exitCodeStopped = 4
+	// Force-terminated past --max-duration, its results possibly incomplete.
+	exitCodeMaxDuration = 5
 )
 
 var (
 	rootCmd = &cobra.Command{
 		Use:   KubeStress,
 		Short: "Simple tool for generating stress on a Kubernetes cluster.",
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			if quiet {
+				// Overrides any -v value, leaving only the V(0) summaries.
+				flag.Lookup("v").Value.Set("0")
+			}
+			if _, ok := latencyUnits[latencyUnit]; !ok {
+				exitOnError(cmd.Name(), fmt.Errorf("unsupported --latency-unit value '%v'", latencyUnit))
+			}
+			if startAtFlag != "" {
+				var err error
+				if startAt, err = time.Parse(time.RFC3339, startAtFlag); err != nil {
+					exitOnError(cmd.Name(), fmt.Errorf("invalid --start-at: %v", err))
+				}
+			}
+			exitOnError(cmd.Name(), armMaxDuration(cmd))
+			exitOnError(cmd.Name(), applyMaxProcs())
+			exitOnError(cmd.Name(), applyDryRun(cmd))
+			rng = util.NewThreadSafeRand(seed)
+			if runID == "" {
+				runID = uuid.Must(uuid.NewRandom()).String()
+			}
+			klog.V(1).Infof("Using run ID %v", runID)
+			if outputDir != "" {
+				exitOnError(cmd.Name(), applyOutputDir(cmd))
+			}
+		},
+		PersistentPostRun: func(cmd *cobra.Command, args []string) {
+			if dryRunActive() {
+				finishDryRun(dryRunInterceptedCount())
+			}
+		},
 	}
 	kubeconfig string
+	// Base64-encoded kubeconfig contents, used in place of the kubeconfig file.
+	kubeconfigData string
+	userAgent      string
+	compress       bool
+	runID          string
+	seed           int64
+	rng            *util.ThreadSafeRand
+	noColor        bool
+	quiet          bool
+	strict         bool
+	// Whether to fail runs targeting an empty collection, rather than warn.
+	requireObjects bool
+	latencyUnit    string
+	startAtFlag    string
+	insecureHosts  []string
+	resolveSpecs   []string
+	headerSpecs    []string
+	outputDir      string
+	// Wall-clock limit of the process, past which it's force-terminated.
+	maxDuration time.Duration
+	// 'namespace/name[:key]' of a ConfigMap holding the CA bundle to trust, fetched in-cluster.
+	caConfigMap string
+	// Idle timeout of the connections (0 for the default) and whether they're kept alive between requests.
+	idleConnTimeout time.Duration
+	keepAlive       bool
+	// GOMAXPROCS (0 for the CPUs available to the process) and the CPUs to pin the process to.
+	maxProcs    int
+	cpuAffinity string
+	// Namespace patterns where destructive or high-volume writes need --i-understand-this-is-destructive.
+	protectedNamespaces  []string
+	destructiveConfirmed bool
+	// Client dry-run mode, the number of intercepted requests it logs and whether to run for real after the plan.
+	dryRun          string
+	dryRunRequests  int
+	dryRunConfirmed bool
+	// Header getting a random UUID for each request, to correlate the requests with their audit events.
+	requestIDHeader string
+	sendRequestIDs  bool
+	// Whether to send a ratio of the requests with a random traceparent header, for server-side tracing.
+	injectTraceparent      bool
+	traceparentSampleRatio float64
+	// Wall-clock time at which the load starts with --start-at.
+	startAt time.Time
+	// Clock used by the dispatch and duration logic, replaceable by a fake clock to simulate time.
+	clk clock.WithTicker = clock.RealClock{}
 )
 
 func init() {
@@ -42,9 +153,202 @@ func init() {
 	rootCmd.Flags().SortFlags = false
 	klog.InitFlags(nil)
 	klog.SetOutput(os.Stdout)
-	flag.Parse()
 	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
 	rootCmd.PersistentFlags().StringVar(&kubeconfig, "kubeconfig", filepath.Join(homedir.HomeDir(), ".kube", "config"), "Absolute path to the kubeconfig file")
+	rootCmd.PersistentFlags().StringVar(&kubeconfigData, "kubeconfig-data", "", "Base64-encoded kubeconfig contents, used instead of --kubeconfig (defaults to $"+client.KubeconfigDataEnv+" unless --kubeconfig is set)")
+	rootCmd.PersistentFlags().StringVar(&userAgent, "user-agent", "", "User-Agent to send with every request (defaults to 'kube-stress/<version> (<command>; run=<run-id>)')")
+	rootCmd.PersistentFlags().BoolVar(&compress, "response-compression", true, "Ask the server for gzip-compressed responses (it only compresses large enough ones)")
+	rootCmd.PersistentFlags().StringVar(&runID, "run-id", "", "Identifier of this run, propagated to the User-Agent, created objects and outputs (defaults to a random UUID)")
+	rootCmd.PersistentFlags().Int64Var(&seed, "seed", 0, "Seed for the random number generator used to vary requests (0 means seed from the current time)")
+	rootCmd.PersistentFlags().BoolVar(&noColor, "no-color", false, "Disable coloring of printed tables (also disabled when stdout isn't a terminal or NO_COLOR is set)")
+	rootCmd.PersistentFlags().BoolVar(&quiet, "quiet", false, "Only log the final summaries and fatal errors, regardless of the -v level")
+	rootCmd.PersistentFlags().BoolVar(&strict, "strict", false, "Fail instead of warning on configurations likely to produce misleading results")
+	rootCmd.PersistentFlags().BoolVar(&requireObjects, "require-objects", false, "Fail list and get runs when the preflight check finds no objects to target, instead of warning")
+	rootCmd.PersistentFlags().StringVar(&latencyUnit, "latency-unit", "ms", "Unit of the latencies written as numbers to the CSV and summary outputs ('ms', 'us' or 's')")
+	rootCmd.PersistentFlags().StringVar(&outputDir, "output-dir", "", "Directory under which a timestamped subdirectory gets all the artifacts of the run (CSV, summary, manifest, histogram), unless their own path flags are set")
+	rootCmd.PersistentFlags().IntVar(&maxProcs, "max-procs", 0, "GOMAXPROCS of the process, for client-side scheduling to be the same across hosts (0 means the CPUs available to the process, honoring --cpu-affinity and container CPU limits)")
+	rootCmd.PersistentFlags().StringVar(&cpuAffinity, "cpu-affinity", "", "CPUs to pin the process to, like taskset (e.g '0-3,6', only supported on linux)")
+	rootCmd.PersistentFlags().StringVar(&startAtFlag, "start-at", "", "RFC3339 time at which to start generating load, waiting until then if it's in the future (synchronizes instances launched at different times)")
+	rootCmd.PersistentFlags().BoolVar(&injectTraceparent, "inject-traceparent", false, "Send requests with a random W3C traceparent header, logging their trace IDs to look up the apiserver spans (requires APIServerTracing)")
+	rootCmd.PersistentFlags().Float64Var(&traceparentSampleRatio, "traceparent-sample-ratio", 1.0, "Ratio of the requests getting a traceparent header with --inject-traceparent")
+	rootCmd.PersistentFlags().BoolVar(&sendRequestIDs, "send-request-ids", false, "Send a random UUID with each request in --request-id-header, recorded in the request_id CSV column and the failure logs (the audit events of the apiserver record the request URI and time, and their audit ID is in the audit_id column)")
+	rootCmd.PersistentFlags().StringVar(&requestIDHeader, "request-id-header", "X-Request-Id", "Header carrying the request IDs of --send-request-ids (sending them as '"+client.AuditIDHeader+"' makes them the audit IDs of the requests)")
+	rootCmd.PersistentFlags().StringArrayVar(&headerSpecs, "header", nil, "Header to add to every request, as 'Key: Value' (repeatable, replaces the header if the client sets it)")
+	rootCmd.PersistentFlags().StringArrayVar(&resolveSpecs, "resolve", nil, "Connect to addr instead of the resolved address when dialing host:port, keeping host for SNI and certificate verification (like curl's --resolve, format 'host:port:addr', repeatable)")
+	rootCmd.PersistentFlags().StringSliceVar(&protectedNamespaces, "protected-namespaces", defaultProtectedNamespaces, "Comma-separated namespace patterns (shell globs) where deletes and writes above "+fmt.Sprint(protectedWriteMaxQPS)+" QPS are refused without --i-understand-this-is-destructive")
+	rootCmd.PersistentFlags().BoolVar(&destructiveConfirmed, "i-understand-this-is-destructive", false, "Allow deletes and high-QPS writes in the --protected-namespaces")
+	rootCmd.PersistentFlags().StringVar(&dryRun, "dry-run", dryRunNone, "With 'client', log the plan of the run and its first --dry-run-requests requests without sending them, then exit ('none' or 'client')")
+	rootCmd.PersistentFlags().IntVar(&dryRunRequests, "dry-run-requests", 10, "Number of intercepted requests logged by --dry-run=client before exiting")
+	rootCmd.PersistentFlags().BoolVar(&dryRunConfirmed, "confirm", false, "With --dry-run=client, run against the server after logging the plan instead of intercepting the requests")
+	rootCmd.PersistentFlags().DurationVar(&idleConnTimeout, "idle-conn-timeout", 0, "How long idle connections are kept open before being closed, e.g to keep them warm in low-QPS runs (0 means the default of 90s)")
+	rootCmd.PersistentFlags().DurationVar(&maxDuration, "max-duration", 0, "Hard limit of the wall-clock duration of the process, longer than the --total-duration of the command, past which it gets force-terminated with exit code "+fmt.Sprint(exitCodeMaxDuration)+" after a last attempt to flush the results, e.g so a stuck run in a Job can't hang forever (0 for none)")
+	rootCmd.PersistentFlags().StringVar(&caConfigMap, "ca-configmap", "", "Trust the CA bundle of this 'namespace/name[:key]' ConfigMap (the key defaulting to '"+client.DefaultCAConfigMapKey+"', e.g 'default/kube-root-ca.crt') instead of the kubeconfig's, fetching it with the in-cluster service account")
+	rootCmd.PersistentFlags().BoolVar(&keepAlive, "keep-alive", true, "Keep connections alive between requests, --keep-alive=false opening a new connection (and TLS handshake) for every request")
+	rootCmd.PersistentFlags().StringSliceVar(&insecureHosts, "insecure-hosts", nil, "Comma-separated host names whose TLS certificate isn't verified, e.g a debugging proxy (all the other hosts are still verified)")
+}
+
+// Load the kubeconfig and apply the client settings shared by all commands.
+func loadKubeConfig(cmd *cobra.Command) *restclient.Config {
+	data := kubeconfigData
+	if cmd.Flags().Changed("kubeconfig") {
+		if data != "" {
+			exitOnError(cmd.Name(), fmt.Errorf("--kubeconfig and --kubeconfig-data are mutually exclusive"))
+		}
+	} else if data == "" {
+		data = os.Getenv(client.KubeconfigDataEnv)
+	}
+	return applyClientSettings(cmd, client.GetKubeConfig(kubeconfig, data, caConfigMap))
+}
+
+// Apply the client settings shared by all commands to a loaded kubeconfig.
+func applyClientSettings(cmd *cobra.Command, config *restclient.Config) *restclient.Config {
+	config.UserAgent = userAgent
+	config.DisableCompression = !compress
+	if config.UserAgent == "" {
+		config.UserAgent = client.DefaultUserAgent(cmd.Name(), runID)
+	}
+	if len(insecureHosts) > 0 || len(resolveSpecs) > 0 || idleConnTimeout > 0 || !keepAlive {
+		resolve, err := client.ParseResolve(resolveSpecs)
+		if err != nil {
+			exitOnError(cmd.Name(), fmt.Errorf("invalid --resolve: %v", err))
+		}
+		opts := client.TransportOptions{InsecureHosts: insecureHosts, Resolve: resolve, IdleConnTimeout: idleConnTimeout, DisableKeepAlives: !keepAlive}
+		if config, err = client.WithSharedTransport(config, opts); err != nil {
+			exitOnError(cmd.Name(), fmt.Errorf("failed to build the transport for the connection settings: %v", err))
+		}
+	}
+	if len(headerSpecs) > 0 {
+		header, err := client.ParseHeaders(headerSpecs)
+		if err != nil {
+			exitOnError(cmd.Name(), fmt.Errorf("invalid --header: %v", err))
+		}
+		client.WithHeaders(config, header)
+	}
+	if dryRunActive() {
+		client.WithDryRun(config, interceptDryRunRequest)
+	}
+	if sendRequestIDs {
+		client.WithRequestIDs(config, requestIDHeader)
+	}
+	if injectTraceparent {
+		client.WithTraceparent(config, traceparentSampleRatio, func(traceID string, req *http.Request) {
+			klog.Infof("Sending %v %v with trace ID %v", req.Method, req.URL, traceID)
+		})
+	}
+	return config
+}
+
+// Create a context that gets cancelled when the process receives a stop signal.
+func signalContext() (context.Context, context.CancelFunc) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case sig := <-sigs:
+			klog.V(1).Infof("Received stop signal: %v", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(sigs)
+	}()
+	return ctx, cancel
+}
+
+// Wait until --start-at unless it's already past, returning early if the context gets cancelled.
+func waitForStart(ctx context.Context) error {
+	if startAt.IsZero() {
+		return nil
+	}
+	wait := startAt.Sub(clk.Now())
+	if wait <= 0 {
+		klog.Warningf("Start time %v is already past by %v, starting right away", startAtFlag, -wait)
+		return nil
+	}
+	klog.Infof("Waiting %v until the start time %v", wait.Round(time.Millisecond), startAtFlag)
+	select {
+	case <-ctx.Done():
+		return &runStoppedError{reason: stopReasonSignal}
+	case <-clk.After(wait):
+		return nil
+	}
+}
+
+// File descriptors expected per client, its connection and a spare one for reconnects,
+// and the ones needed regardless of the clients (output files, standard streams).
+const (
+	fileDescriptorsPerClient = 2
+	reservedFileDescriptors  = 64
+)
+
+// QPS per client beyond which its connection pool likely becomes the bottleneck instead of the server.
+const maxQPSPerClient = 50
+
+// Check that enough clients are used for the requested QPS, warning (or failing with --strict) otherwise.
+func checkQPSPerClient(qps float32, numClients int) error {
+	if numClients < 1 {
+		return fmt.Errorf("--num-clients must be at least 1")
+	}
+	if perClient := float64(qps) / float64(numClients); perClient > maxQPSPerClient {
+		msg := fmt.Sprintf("%.0f QPS per client exceeds %d, the clients might be the bottleneck rather than the server (use --num-clients=%d or more)",
+			perClient, maxQPSPerClient, int(math.Ceil(float64(qps)/maxQPSPerClient)))
+		if strict {
+			return errors.New(msg)
+		}
+		klog.Warning(msg)
+	}
+	return nil
+}
+
+// Log an error seen by an individual request, unless --quiet is set (failures still show up in the summaries).
+func logRequestError(format string, args ...interface{}) {
+	if !quiet {
+		klog.ErrorDepth(1, fmt.Sprintf(format, args...))
+	}
+}
+
+// Units supported by --latency-unit.
+var latencyUnits = map[string]time.Duration{
+	"ms": time.Millisecond,
+	"us": time.Microsecond,
+	"s":  time.Second,
+}
+
+// Format a latency as a number in the --latency-unit.
+func formatLatency(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(latencyUnits[latencyUnit]), 'f', -1, 64)
+}
+
+// Returned by a command whose run was stopped before its total duration.
+type runStoppedError struct {
+	reason string
+}
+
+func (e *runStoppedError) Error() string {
+	return fmt.Sprintf("run stopped early (reason: %v)", e.reason)
+}
+
+// Exit the process if a command failed, with an exit code matching the kind of failure.
+func exitOnError(command string, err error) {
+	if err == nil {
+		return
+	}
+	if intercepted := dryRunInterceptedCount(); dryRunActive() && intercepted > 0 {
+		// Most likely failing on the requests that weren't sent.
+		klog.Warningf("The %v command stopped in the dry run: %v", command, err)
+		finishDryRun(intercepted)
+	}
+	var stopped *runStoppedError
+	if !errors.As(err, &stopped) {
+		klog.Errorf("Error executing %v command: %v", command, err)
+		os.Exit(1)
+	}
+	klog.Warningf("The %v command was cut short: %v", command, err)
+	klog.Flush()
+	if stopped.reason == stopReasonSignal {
+		os.Exit(exitCodeSignal)
+	}
+	os.Exit(exitCodeStopped)
 }
 
 func Execute() {
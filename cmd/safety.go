@@ -0,0 +1,63 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"path"
+)
+
+// Verbs refused in the --protected-namespaces without --i-understand-this-is-destructive.
+const (
+	destructiveDelete          = "delete"
+	destructiveDeleteNamespace = "delete everything"
+	destructiveCreate          = "create"
+	destructivePatch           = "patch"
+)
+
+// Writes at or below this QPS are tolerated in the protected namespaces, only deletes are always refused.
+const protectedWriteMaxQPS = 5
+
+// Default --protected-namespaces, holding the system components or the workloads of most clusters.
+var defaultProtectedNamespaces = []string{"kube-system", "kube-public", "kube-node-lease", "default"}
+
+// Refuse sending the verb at the given QPS to any of the namespaces matching a --protected-namespaces pattern,
+// unless --i-understand-this-is-destructive is set. The empty namespace stands for all namespaces, so it
+// matches any pattern.
+func checkDestructive(verb string, qps float64, namespaces ...string) error {
+	if destructiveConfirmed {
+		return nil
+	}
+	if (verb == destructiveCreate || verb == destructivePatch) && qps <= protectedWriteMaxQPS {
+		return nil
+	}
+	for _, namespace := range namespaces {
+		for _, pattern := range protectedNamespaces {
+			matched, err := path.Match(pattern, namespace)
+			if err != nil {
+				return fmt.Errorf("invalid --protected-namespaces pattern '%v': %v", pattern, err)
+			}
+			if !matched && namespace != "" {
+				continue
+			}
+			target := fmt.Sprintf("the namespace '%v'", namespace)
+			if namespace == "" {
+				target = "all namespaces"
+			}
+			return fmt.Errorf("refusing to %v in %v, protected by the --protected-namespaces pattern '%v' (pass --i-understand-this-is-destructive to proceed)", verb, target, pattern)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	"github.com/rcrozean/kube-stress/pkg/client"
+)
+
+type SelfTestConfig struct {
+	errorRate     float64
+	latency       time.Duration
+	qps           float32
+	totalDuration time.Duration
+	// Allowed difference between the reported and injected failure rates, 0 meaning 4 standard deviations.
+	tolerance float64
+}
+
+var (
+	selfTestConfig *SelfTestConfig
+	selfTestCmd    *cobra.Command
+)
+
+func init() {
+	selfTestConfig = &SelfTestConfig{}
+	selfTestCmd = &cobra.Command{
+		Use:   "self-test",
+		Short: "Run the list workload against a fake backend failing a given rate of the calls, checking the reported failures match",
+		Run: func(cmd *cobra.Command, args []string) {
+			exitOnError(cmd.Name(), selfTestCommand())
+		},
+	}
+	rootCmd.AddCommand(selfTestCmd)
+	selfTestCmd.Flags().Float64Var(&selfTestConfig.errorRate, "error-rate-injection", 0.02, "Fraction of the list calls the fake backend fails with a 500")
+	selfTestCmd.Flags().DurationVar(&selfTestConfig.latency, "latency", 5*time.Millisecond, "Latency of every call to the fake backend")
+	selfTestCmd.Flags().Float32Var(&selfTestConfig.qps, "qps", 200, "QPS of the list calls")
+	selfTestCmd.Flags().DurationVar(&selfTestConfig.totalDuration, "total-duration", 10*time.Second, "Total duration of the list workload")
+	selfTestCmd.Flags().Float64Var(&selfTestConfig.tolerance, "tolerance", 0, "Allowed difference between the reported failure rate and --error-rate-injection (0 means 4 standard deviations of the observed failure rate)")
+}
+
+// Backend standing in for the apiserver, failing a random fraction of the calls and counting what it did.
+type faultyListRequester struct {
+	errorRate float64
+	latency   time.Duration
+	calls     atomic.Uint64
+	failures  atomic.Uint64
+}
+
+func (r *faultyListRequester) list(ctx context.Context, _ *kubernetes.Clientset, _ int, _ string, _ int, _ string) (listResult, error) {
+	r.calls.Add(1)
+	select {
+	case <-ctx.Done():
+		return listResult{contentLength: -1}, ctx.Err()
+	case <-clk.After(r.latency):
+	}
+	status := http.StatusOK
+	var err error
+	if rng.Float64() < r.errorRate {
+		r.failures.Add(1)
+		status = http.StatusInternalServerError
+		err = apierrors.NewInternalError(errors.New("failure injected by the self-test"))
+	}
+	if info := client.ResponseInfoFrom(ctx); info != nil {
+		info.StatusCode = status
+	}
+	return listResult{contentLength: -1}, err
+}
+
+func selfTestCommand() error {
+	if selfTestConfig.errorRate < 0 || selfTestConfig.errorRate > 1 {
+		return fmt.Errorf("--error-rate-injection must be within [0, 1]")
+	}
+	backend := &faultyListRequester{errorRate: selfTestConfig.errorRate, latency: selfTestConfig.latency}
+	listRequests = backend
+	listResource = "configmaps"
+	listConfig.qps, listConfig.totalDuration = selfTestConfig.qps, selfTestConfig.totalDuration
+	// The clients are only handed to the fake backend, nothing gets sent to this address.
+	configs, connStats := client.TracedConfigs(&restclient.Config{Host: "http://self-test.invalid"}, listConfig.numClients)
+	clients := client.CreateKubeClientsForConfigs(configs)
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	klog.Infof("Running the list workload at %v QPS for %v against a fake backend failing %v of the calls",
+		selfTestConfig.qps, selfTestConfig.totalDuration, selfTestConfig.errorRate)
+	summary, reason := listObjects(ctx, "", clients, configs, connStats)
+	if reason != "" {
+		return &runStoppedError{reason: reason}
+	}
+	calls, failures := backend.calls.Load(), backend.failures.Load()
+	if calls == 0 {
+		return fmt.Errorf("the workload made no calls")
+	}
+	// Without retries, every call to the backend is a list call of the summary.
+	var errs []error
+	if summary.TotalRequests != calls {
+		errs = append(errs, fmt.Errorf("reported %d requests, the backend got %d", summary.TotalRequests, calls))
+	}
+	if summary.FailedRequests != failures {
+		errs = append(errs, fmt.Errorf("reported %d failed requests, the backend failed %d", summary.FailedRequests, failures))
+	}
+	tolerance := selfTestConfig.tolerance
+	if tolerance == 0 {
+		tolerance = 4 * math.Sqrt(selfTestConfig.errorRate*(1-selfTestConfig.errorRate)/float64(calls))
+	}
+	if diff := math.Abs(summary.FailureRate - selfTestConfig.errorRate); diff > tolerance {
+		errs = append(errs, fmt.Errorf("reported failure rate %.4f is off the injected %.4f by more than %.4f", summary.FailureRate, selfTestConfig.errorRate, tolerance))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("self-test failed: %w", errors.Join(errs...))
+	}
+	klog.Infof("Self-test passed: %d failures reported out of %d requests (rate %.4f, injected %v, tolerance %.4f)",
+		summary.FailedRequests, summary.TotalRequests, summary.FailureRate, selfTestConfig.errorRate, tolerance)
+	return nil
+}
@@ -0,0 +1,145 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/klog/v2"
+
+	"github.com/rcrozean/kube-stress/pkg/util"
+)
+
+// Point of the curve of the list latency by collection size measured with --size-series.
+type SizeSeriesPoint struct {
+	Namespace string `json:"namespace"`
+	// Objects in the namespace when the run started, --size-series being what it was meant to hold.
+	Objects    int                 `json:"objects"`
+	TargetSize int                 `json:"target_size"`
+	Latency    util.LatencySummary `json:"latency"`
+}
+
+// Objects counted in each --size-series namespace before the run.
+var sizeSeriesObjects = map[string]int{}
+
+// Namespace of the objects of a --size-series size, e.g 'kube-stress-size-1000'.
+func sizeSeriesNamespace(namespace string, size int) string {
+	return fmt.Sprintf("%v-size-%d", namespace, size)
+}
+
+func sizeSeriesNamespaces(namespace string, sizes []int) []string {
+	namespaces := make([]string, len(sizes))
+	for i, size := range sizes {
+		namespaces[i] = sizeSeriesNamespace(namespace, size)
+	}
+	return namespaces
+}
+
+// Count the objects of each --size-series namespace, first creating the missing ones with --seed-size-series.
+func prepareSizeSeries(ctx context.Context, clients []*kubernetes.Clientset) error {
+	for _, size := range listConfig.sizeSeries {
+		namespace := sizeSeriesNamespace(listConfig.namespace, size)
+		count, err := countObjects(ctx, clients[0], namespace)
+		if err != nil {
+			return fmt.Errorf("failed to count the objects of namespace '%v': %v", namespace, err)
+		}
+		if listConfig.seedSizeSeries && count < size {
+			klog.Infof("Seeding namespace '%v' with %d configmaps of %d bytes, up to %d objects", namespace, size-count, listConfig.seedObjectSize, size)
+			if err := seedObjects(ctx, clients, namespace, size-count); err != nil {
+				return fmt.Errorf("failed to seed namespace '%v': %v", namespace, err)
+			}
+			if count, err = countObjects(ctx, clients[0], namespace); err != nil {
+				return fmt.Errorf("failed to count the objects of namespace '%v': %v", namespace, err)
+			}
+		}
+		if count != size {
+			klog.Warningf("Namespace '%v' holds %d objects rather than %d", namespace, count, size)
+		}
+		sizeSeriesObjects[namespace] = count
+	}
+	return nil
+}
+
+// Count the objects of a namespace with a list of a single one, the server telling how many remain.
+func countObjects(ctx context.Context, kubeClient *kubernetes.Clientset, namespace string) (int, error) {
+	list, err := listRESTClient(kubeClient).Get().
+		Namespace(namespace).
+		Resource(listResource).
+		VersionedParams(&metav1.ListOptions{Limit: 1}, scheme.ParameterCodec).
+		Do(ctx).
+		Get()
+	if err != nil {
+		return 0, err
+	}
+	listMeta, err := meta.ListAccessor(list)
+	if err != nil {
+		return 0, err
+	}
+	count := meta.LenList(list)
+	if remaining := listMeta.GetRemainingItemCount(); remaining != nil {
+		count += int(*remaining)
+	} else if listMeta.GetContinue() != "" {
+		return 0, fmt.Errorf("the server didn't return the remaining item count")
+	}
+	return count, nil
+}
+
+// Create the given number of configmaps in the namespace as fast as the clients go, stopping at the first error.
+func seedObjects(ctx context.Context, clients []*kubernetes.Clientset, namespace string, count int) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var remaining atomic.Int64
+	remaining.Store(int64(count))
+	var firstErr error
+	var errOnce sync.Once
+	var wg sync.WaitGroup
+	for _, c := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil && remaining.Add(-1) >= 0 {
+				if _, err := c.CoreV1().ConfigMaps(namespace).Create(ctx, newConfigMap(listConfig.seedObjectSize), metav1.CreateOptions{}); err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// Log and return the latencies of the --size-series namespaces, in the order of the sizes.
+func reportSizeSeries(stats *listStats) []SizeSeriesPoint {
+	points := make([]SizeSeriesPoint, 0, len(listConfig.sizeSeries))
+	for _, size := range listConfig.sizeSeries {
+		namespace := sizeSeriesNamespace(listConfig.namespace, size)
+		summary := stats.namespaceLatencies[namespace].Summary()
+		klog.Infof("Size series: %d objects in '%v': %d requests, %d successful, p50 = %v, p90 = %v, p99 = %v",
+			sizeSeriesObjects[namespace], namespace, stats.namespaceRequests[namespace].Load(), summary.Count, summary.P50, summary.P90, summary.P99)
+		points = append(points, SizeSeriesPoint{Namespace: namespace, Objects: sizeSeriesObjects[namespace], TargetSize: size, Latency: summary})
+	}
+	return points
+}
@@ -0,0 +1,162 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/klog/v2"
+
+	"github.com/rcrozean/kube-stress/pkg/client"
+	"github.com/rcrozean/kube-stress/pkg/util"
+)
+
+type StalenessConfig struct {
+	namespace     string
+	objectType    string
+	interval      time.Duration
+	totalDuration time.Duration
+}
+
+var (
+	stalenessConfig *StalenessConfig
+	stalenessCmd    *cobra.Command
+)
+
+// Field selector matching no object, so cached lists only return the resourceVersion of the cache.
+var noObjectSelector = fields.OneTermEqualSelector("metadata.name", KubeStress+"-no-such-object").String()
+
+func init() {
+	stalenessConfig = &StalenessConfig{}
+	stalenessCmd = &cobra.Command{
+		Use:   "staleness",
+		Short: "Measure how many resourceVersions the watch cache lags behind etcd",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := stalenessCommand(); err != nil {
+				klog.Errorf("Error executing staleness command: %v", err)
+				os.Exit(1)
+			}
+		},
+	}
+	rootCmd.AddCommand(stalenessCmd)
+	stalenessCmd.Flags().StringVar(&stalenessConfig.namespace, "namespace", KubeStress, "Namespace to do the paired reads in (empty value means all namespaces)")
+	stalenessCmd.Flags().StringVar(&stalenessConfig.objectType, "object-type", "configmaps", "Type of objects to read (any core/v1 resource, e.g 'pods' and 'configmaps')")
+	stalenessCmd.Flags().DurationVar(&stalenessConfig.interval, "interval", time.Second, "Interval between the paired quorum and cached reads")
+	stalenessCmd.Flags().DurationVar(&stalenessConfig.totalDuration, "total-duration", 5*time.Minute, "Total duration for which to run this command")
+}
+
+// Version lags of the watch cache seen over a run.
+type lagTracker struct {
+	lags   []int64
+	failed int
+}
+
+func stalenessCommand() error {
+	kubeClient := client.CreateKubeClients(loadKubeConfig(stalenessCmd), 1)[0]
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	if err := waitForStart(ctx); err != nil {
+		return err
+	}
+	klog.V(1).Infof("Measuring the watch cache lag for '%v' objects in namespace '%v' every %v for %v",
+		stalenessConfig.objectType,
+		stalenessConfig.namespace,
+		stalenessConfig.interval,
+		stalenessConfig.totalDuration)
+
+	tracker := &lagTracker{}
+	defer reportLags(tracker)
+	start := time.Now()
+	ticker := time.NewTicker(stalenessConfig.interval)
+	defer ticker.Stop()
+	for time.Since(start) < stalenessConfig.totalDuration {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			lag, err := measureLag(ctx, kubeClient)
+			if err != nil {
+				tracker.failed++
+				logRequestError("Error seen with paired read: %v", err)
+				continue
+			}
+			klog.V(2).Infof("Watch cache is %d resourceVersions behind etcd", lag)
+			tracker.lags = append(tracker.lags, lag)
+		}
+	}
+	return nil
+}
+
+// Do a quorum read to learn the latest resourceVersion, then a cached read to learn the one of the watch cache.
+func measureLag(ctx context.Context, kubeClient *kubernetes.Clientset) (int64, error) {
+	latest, err := listResourceVersion(ctx, kubeClient, metav1.ListOptions{Limit: 1})
+	if err != nil {
+		return 0, fmt.Errorf("quorum read failed: %v", err)
+	}
+	cached, err := listResourceVersion(ctx, kubeClient, metav1.ListOptions{ResourceVersion: "0", FieldSelector: noObjectSelector})
+	if err != nil {
+		return 0, fmt.Errorf("cached read failed: %v", err)
+	}
+	// A cache which caught up in between the two reads is not behind.
+	if cached > latest {
+		return 0, nil
+	}
+	return latest - cached, nil
+}
+
+// List with the given options, returning the resourceVersion of the list as a number.
+// ResourceVersions are opaque in the API but are etcd revisions for the built-in storage.
+func listResourceVersion(ctx context.Context, kubeClient *kubernetes.Clientset, opts metav1.ListOptions) (int64, error) {
+	list, err := kubeClient.CoreV1().RESTClient().Get().
+		Namespace(stalenessConfig.namespace).
+		Resource(stalenessConfig.objectType).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Do(ctx).
+		Get()
+	if err != nil {
+		return 0, err
+	}
+	accessor, err := meta.ListAccessor(list)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(accessor.GetResourceVersion(), 10, 64)
+}
+
+func reportLags(tracker *lagTracker) {
+	if len(tracker.lags) == 0 {
+		klog.Infof("No successful paired reads (%d failed)", tracker.failed)
+		return
+	}
+	sort.Slice(tracker.lags, func(i, j int) bool { return tracker.lags[i] < tracker.lags[j] })
+	klog.Infof("Watch cache lag over %d paired reads (%d failed): p50 = %d, p90 = %d, p99 = %d, max = %d resourceVersions",
+		len(tracker.lags), tracker.failed,
+		util.Percentile(tracker.lags, 50),
+		util.Percentile(tracker.lags, 90),
+		util.Percentile(tracker.lags, 99),
+		tracker.lags[len(tracker.lags)-1])
+}
@@ -0,0 +1,56 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// The core/v1 subresources which can be read with --object-type=<resource>/<subresource>, by resource.
+// Subresources are only served for single objects, so they can only be fetched with get calls and never listed.
+var readableSubresources = map[string][]string{
+	"status": {"namespaces", "nodes", "persistentvolumeclaims", "persistentvolumes", "pods", "replicationcontrollers", "resourcequotas", "services"},
+	"scale":  {"replicationcontrollers"},
+	"log":    {"pods"},
+}
+
+// Split an --object-type into its resource and subresource (empty if there is none).
+func splitSubresource(objectType string) (string, string) {
+	resource, subresource, _ := strings.Cut(objectType, "/")
+	return resource, subresource
+}
+
+// Check that the subresource, if any, can be fetched for the resource.
+func checkReadableSubresource(resource, subresource string) error {
+	if subresource == "" {
+		return nil
+	}
+	resources, ok := readableSubresources[subresource]
+	if !ok {
+		var supported []string
+		for s := range readableSubresources {
+			supported = append(supported, s)
+		}
+		sort.Strings(supported)
+		return fmt.Errorf("unsupported subresource '%v' (supported subresources are %v)", subresource, strings.Join(supported, ", "))
+	}
+	if !slices.Contains(resources, resource) {
+		return fmt.Errorf("'%v' don't have a '%v' subresource (only %v do)", resource, subresource, strings.Join(resources, ", "))
+	}
+	return nil
+}
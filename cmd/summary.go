@@ -0,0 +1,368 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+
+	"github.com/rcrozean/kube-stress/pkg/util"
+	"github.com/rcrozean/kube-stress/pkg/version"
+)
+
+// Event detected during a run, such as a possible apiserver restart.
+type RunEvent struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Message string    `json:"message"`
+}
+
+// Types of RunEvent.
+const (
+	runEventPossibleRestart = "possible-apiserver-restart"
+	runEventMemoryDowngrade = "memory-downgrade"
+	runEventClientImbalance = "client-imbalance"
+)
+
+// Machine-readable results of a run, written at the end of the run.
+type RunSummary struct {
+	Command string `json:"command"`
+	// Cluster of the run with --clusters, empty for the aggregate of all of them.
+	Cluster   string        `json:"cluster,omitempty"`
+	RunID     string        `json:"run_id"`
+	StartTime time.Time     `json:"start_time"`
+	Duration  time.Duration `json:"duration"`
+	// Unit of the latencies below, written as numbers of it (nanoseconds when empty).
+	LatencyUnit string `json:"latency_unit,omitempty"`
+	// How the watch cache was confirmed warm before the run with --warm-cache-first ('bookmark', 'list' or 'unconfirmed').
+	CacheWarmup      string       `json:"cache_warmup,omitempty"`
+	Version          version.Info `json:"version"`
+	Completed        bool         `json:"completed"`
+	StopReason       string       `json:"stop_reason,omitempty"`
+	TotalRequests    uint64       `json:"total_requests"`
+	FailedRequests   uint64       `json:"failed_requests"`
+	NotFoundRequests uint64       `json:"not_found_requests,omitempty"`
+	FailureRate      float64      `json:"failure_rate"`
+	AchievedQPS      float64      `json:"achieved_qps"`
+	WorkerModel      string       `json:"worker_model,omitempty"`
+	// Number of clients at the end of the run, which can grow with --max-clients.
+	NumClients int `json:"num_clients,omitempty"`
+	// Time from the start of the run to the first call of the last client to make one.
+	ClientOnset time.Duration `json:"client_onset,omitempty"`
+	// Calls handed to each client, failed or not.
+	ClientRequests []uint64 `json:"client_requests,omitempty"`
+	// Connection setup time (dial and TLS handshake) of the clients and the clients which failed to connect, with
+	// --warmup-connections.
+	WarmupLatency  *util.LatencySummary `json:"warmup_connect_latency,omitempty"`
+	WarmupFailures uint64               `json:"warmup_failures,omitempty"`
+	// In-flight calls the limiter settled on with --adaptive-concurrency.
+	AdaptiveConcurrency int    `json:"adaptive_concurrency,omitempty"`
+	SerializedPerClient bool   `json:"serialized_per_client,omitempty"`
+	DroppedRequests     uint64 `json:"dropped_requests,omitempty"`
+	// Highest number of ticks queued in the --dispatch-buffer.
+	DispatchBufferPeak int `json:"dispatch_buffer_peak,omitempty"`
+	// Fraction of the successful calls written to the CSV and JSON outputs with --sample-rate.
+	SampleRate float64 `json:"sample_rate,omitempty"`
+	// CSV rows dropped as the writer couldn't keep up.
+	DroppedCSVRows uint64 `json:"dropped_csv_rows,omitempty"`
+	// Notable events detected during the run, in the order they happened.
+	Events []RunEvent `json:"events,omitempty"`
+	// Change of the apiserver_request_total and etcd_request_duration_seconds series over the run, by series.
+	APIServerMetricDeltas map[string]float64 `json:"apiserver_metric_deltas,omitempty"`
+	TLSHandshakes         uint64             `json:"tls_handshakes"`
+	CompressedResponses   uint64             `json:"compressed_responses"`
+	Retries               uint64             `json:"retries,omitempty"`
+	RetriesSuppressed     uint64             `json:"retries_suppressed,omitempty"`
+	HedgedRequests        uint64             `json:"hedged_requests,omitempty"`
+	HedgeWins             uint64             `json:"hedge_wins,omitempty"`
+	// Connections opened by the clients past their first one.
+	Reconnects uint64 `json:"reconnects,omitempty"`
+	// Number of 429s keyed by the UIDs of the APF flow schema and priority level which throttled them.
+	ThrottledBy        map[string]uint64     `json:"throttled_by,omitempty"`
+	TruncatedResponses uint64                `json:"truncated_responses,omitempty"`
+	DrainTimeouts      uint64                `json:"drain_timeouts,omitempty"`
+	Latency            util.LatencySummary   `json:"latency"`
+	ClientLatencies    []util.LatencySummary `json:"client_latencies,omitempty"`
+	AnnotatedLatency   util.LatencySummary   `json:"annotated_latency"`
+	// Latencies of all the calls, failed or not, by class of their final status code ('2xx', '4xx', '5xx' or 'other').
+	StatusClassLatency map[string]util.LatencySummary `json:"status_class_latency,omitempty"`
+	// Durations of the Server-Timing metrics of the successful responses by name, with --measure-apiserver-queue-wait.
+	ServerTimingLatency map[string]util.LatencySummary `json:"server_timing_latency,omitempty"`
+	// Lists failed by an expired continue token and lists restarted after one, with --follow-continue.
+	ExpiredContinues uint64 `json:"expired_continues,omitempty"`
+	ContinueRestarts uint64 `json:"continue_restarts,omitempty"`
+	// Successful responses whose body was shorter than their Content-Length.
+	LengthMismatches uint64 `json:"content_length_mismatches,omitempty"`
+	// Calls failed by a 5xx relaying an overloaded etcd ('etcdserver: too many requests' and the like).
+	EtcdOverloads uint64 `json:"etcd_overloads,omitempty"`
+	// Successful responses by the content type they were actually served with.
+	ContentTypes map[string]uint64 `json:"content_types,omitempty"`
+	// Latencies by collection size with --size-series, in the order of the sizes.
+	SizeSeries []SizeSeriesPoint `json:"size_series,omitempty"`
+	// What limited the throughput of the run primarily, with --throughput-verdict.
+	ThroughputVerdict string `json:"throughput_verdict,omitempty"`
+}
+
+// Latency summary with the latencies as numbers of a unit.
+type unitLatencySummary struct {
+	Count int     `json:"count"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P95   float64 `json:"p95"`
+	P99   float64 `json:"p99"`
+}
+
+func toUnit(s util.LatencySummary, unit time.Duration) unitLatencySummary {
+	in := func(d time.Duration) float64 { return float64(d) / float64(unit) }
+	return unitLatencySummary{s.Count, in(s.Min), in(s.Max), in(s.Mean), in(s.P50), in(s.P90), in(s.P95), in(s.P99)}
+}
+
+func fromUnit(s unitLatencySummary, unit time.Duration) util.LatencySummary {
+	from := func(v float64) time.Duration { return time.Duration(v * float64(unit)) }
+	return util.LatencySummary{Count: s.Count, Min: from(s.Min), Max: from(s.Max), Mean: from(s.Mean), P50: from(s.P50), P90: from(s.P90), P95: from(s.P95), P99: from(s.P99)}
+}
+
+func (s *RunSummary) unit() time.Duration {
+	if unit, ok := latencyUnits[s.LatencyUnit]; ok {
+		return unit
+	}
+	return time.Nanosecond
+}
+
+// The summary types with the latencies written in the latency unit of the summary, shadowing the plain ones.
+type (
+	plainRunSummary RunSummary
+	jsonRunSummary  struct {
+		*plainRunSummary
+		Latency             unitLatencySummary            `json:"latency"`
+		ClientLatencies     []unitLatencySummary          `json:"client_latencies,omitempty"`
+		AnnotatedLatency    unitLatencySummary            `json:"annotated_latency"`
+		StatusClassLatency  map[string]unitLatencySummary `json:"status_class_latency,omitempty"`
+		ServerTimingLatency map[string]unitLatencySummary `json:"server_timing_latency,omitempty"`
+		WarmupLatency       *unitLatencySummary           `json:"warmup_connect_latency,omitempty"`
+		SizeSeries          []unitSizeSeriesPoint         `json:"size_series,omitempty"`
+	}
+	unitSizeSeriesPoint struct {
+		SizeSeriesPoint
+		Latency unitLatencySummary `json:"latency"`
+	}
+)
+
+func (s *RunSummary) MarshalJSON() ([]byte, error) {
+	unit := s.unit()
+	out := jsonRunSummary{
+		plainRunSummary:  (*plainRunSummary)(s),
+		Latency:          toUnit(s.Latency, unit),
+		AnnotatedLatency: toUnit(s.AnnotatedLatency, unit),
+	}
+	for _, l := range s.ClientLatencies {
+		out.ClientLatencies = append(out.ClientLatencies, toUnit(l, unit))
+	}
+	if s.StatusClassLatency != nil {
+		out.StatusClassLatency = map[string]unitLatencySummary{}
+		for class, l := range s.StatusClassLatency {
+			out.StatusClassLatency[class] = toUnit(l, unit)
+		}
+	}
+	if s.ServerTimingLatency != nil {
+		out.ServerTimingLatency = map[string]unitLatencySummary{}
+		for name, l := range s.ServerTimingLatency {
+			out.ServerTimingLatency[name] = toUnit(l, unit)
+		}
+	}
+	if s.WarmupLatency != nil {
+		warmup := toUnit(*s.WarmupLatency, unit)
+		out.WarmupLatency = &warmup
+	}
+	for _, point := range s.SizeSeries {
+		out.SizeSeries = append(out.SizeSeries, unitSizeSeriesPoint{SizeSeriesPoint: point, Latency: toUnit(point.Latency, unit)})
+	}
+	return json.Marshal(&out)
+}
+
+func (s *RunSummary) UnmarshalJSON(data []byte) error {
+	in := jsonRunSummary{plainRunSummary: (*plainRunSummary)(s)}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	unit := s.unit()
+	s.Latency = fromUnit(in.Latency, unit)
+	s.AnnotatedLatency = fromUnit(in.AnnotatedLatency, unit)
+	s.ClientLatencies = nil
+	for _, l := range in.ClientLatencies {
+		s.ClientLatencies = append(s.ClientLatencies, fromUnit(l, unit))
+	}
+	s.StatusClassLatency = nil
+	if in.StatusClassLatency != nil {
+		s.StatusClassLatency = map[string]util.LatencySummary{}
+		for class, l := range in.StatusClassLatency {
+			s.StatusClassLatency[class] = fromUnit(l, unit)
+		}
+	}
+	s.ServerTimingLatency = nil
+	if in.ServerTimingLatency != nil {
+		s.ServerTimingLatency = map[string]util.LatencySummary{}
+		for name, l := range in.ServerTimingLatency {
+			s.ServerTimingLatency[name] = fromUnit(l, unit)
+		}
+	}
+	s.WarmupLatency = nil
+	if in.WarmupLatency != nil {
+		warmup := fromUnit(*in.WarmupLatency, unit)
+		s.WarmupLatency = &warmup
+	}
+	s.SizeSeries = nil
+	for _, point := range in.SizeSeries {
+		point.SizeSeriesPoint.Latency = fromUnit(point.Latency, unit)
+		s.SizeSeries = append(s.SizeSeries, point.SizeSeriesPoint)
+	}
+	return nil
+}
+
+// Latencies are recorded in microseconds up to an hour in the --histogram-output-filepath log, with the
+// interval maximum printed in milliseconds.
+const (
+	histogramHighestLatency    = time.Hour
+	histogramSignificantDigits = 3
+)
+
+// Write the latencies as an HdrHistogram log, which can be merged with the logs of other runs.
+func writeHistogramLog(filepath string, start time.Time, elapsed time.Duration, latencies []time.Duration) error {
+	f, err := os.Create(filepath)
+	if err != nil {
+		return err
+	}
+	if err := latencyHistogram(latencies).WriteLog(f, start, elapsed, float64(time.Millisecond/time.Microsecond)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Render the distribution of the latencies as an SVG plot, in the --latency-unit.
+func writeLatencyPlot(filepath string, latencies []time.Duration, withCDF bool) error {
+	f, err := os.Create(filepath)
+	if err != nil {
+		return err
+	}
+	unitRatio := float64(latencyUnits[latencyUnit] / time.Microsecond)
+	if err := util.WriteHistogramSVG(f, latencyHistogram(latencies), unitRatio, latencyUnit, withCDF); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// HdrHistogram of the latencies, in microseconds.
+func latencyHistogram(latencies []time.Duration) *util.Histogram {
+	h := util.NewHistogram(histogramHighestLatency.Microseconds(), histogramSignificantDigits)
+	for _, l := range latencies {
+		h.Record(l.Microseconds())
+	}
+	return h
+}
+
+func writeSummary(filepath string, summary *RunSummary) error {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath, data, 0644)
+}
+
+// Key of the summary in the data of the configmap written by writeSummaryConfigMap.
+const summaryConfigMapKey = "summary.json"
+
+// Largest summary which fits in a configmap, leaving room for its metadata under the 1MiB object size limit.
+const maxConfigMapSummaryBytes = 1000 * 1000
+
+// Write the summary into the given '<namespace>/<name>' configmap, creating it or updating its summary.
+// Summaries too large for a configmap are written without their per-client latencies.
+func writeSummaryConfigMap(ctx context.Context, client *kubernetes.Clientset, ref string, summary *RunSummary) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(ref)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	if len(data) > maxConfigMapSummaryBytes {
+		klog.Warningf("Summary of %d bytes doesn't fit in a configmap, dropping the per-client latencies", len(data))
+		trimmed := *summary
+		trimmed.ClientLatencies = nil
+		if data, err = json.MarshalIndent(&trimmed, "", "  "); err != nil {
+			return err
+		}
+		if len(data) > maxConfigMapSummaryBytes {
+			return fmt.Errorf("summary of %d bytes doesn't fit in a configmap", len(data))
+		}
+	}
+
+	configMaps := client.CoreV1().ConfigMaps(namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configmap, err := configMaps.Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			configmap = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   name,
+					Labels: map[string]string{RunIDLabel: summary.RunID},
+				},
+				Data: map[string]string{summaryConfigMapKey: string(data)},
+			}
+			_, err = configMaps.Create(ctx, configmap, metav1.CreateOptions{})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if configmap.Data == nil {
+			configmap.Data = map[string]string{}
+		}
+		configmap.Data[summaryConfigMapKey] = string(data)
+		if configmap.Labels == nil {
+			configmap.Labels = map[string]string{}
+		}
+		configmap.Labels[RunIDLabel] = summary.RunID
+		_, err = configMaps.Update(ctx, configmap, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+func readSummary(filepath string) (*RunSummary, error) {
+	data, err := os.ReadFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	summary := &RunSummary{}
+	if err := json.Unmarshal(data, summary); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
@@ -0,0 +1,110 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/rcrozean/kube-stress/pkg/client"
+)
+
+// What --throughput-verdict blames for the throughput of a run.
+const (
+	verdictClientQPS      = "client QPS"
+	verdictConnectionPool = "client connection pool"
+	verdictServerAPF      = "server APF"
+	verdictServerCapacity = "server capacity"
+)
+
+// Thresholds of the signals past which --throughput-verdict blames them: the fractions of the attempts throttled
+// with a 429, of the request time spent waiting on the client rate limiter or for a connection, of the calls not
+// dispatched, and of the requested QPS reached.
+const (
+	verdictThrottledRatio = 0.05
+	verdictWaitRatio      = 0.2
+	verdictDroppedRatio   = 0.01
+	verdictQPSRatio       = 0.95
+)
+
+// Client-side waits of the requests of the list calls with --throughput-verdict, summed in nanoseconds.
+type throughputSignals struct {
+	requestTime     atomic.Int64
+	rateLimiterWait atomic.Int64
+	connWait        atomic.Int64
+}
+
+// Add up the waits of the requests of a list call, from their phases (see requestPhaseSpans).
+func (s *throughputSignals) record(trace *client.PhaseTrace) {
+	for _, r := range trace.Requests() {
+		if r.GetConn.IsZero() || r.GotConn.IsZero() || r.BodyDone.IsZero() {
+			continue
+		}
+		s.requestTime.Add(int64(r.BodyDone.Sub(r.Start)))
+		s.rateLimiterWait.Add(int64(r.GetConn.Sub(r.Start)))
+		s.connWait.Add(int64(r.GotConn.Sub(r.GetConn)))
+	}
+}
+
+// Correlate the client-side waits, the drops, the 429s and the server errors of a run into what limited its
+// throughput, logging the signals and the verdict.
+func reportThroughputVerdict(stats *listStats, elapsed time.Duration) string {
+	total, dropped := stats.total.Load(), stats.dropped.Load()
+	if total == 0 {
+		return ""
+	}
+	ratio := func(n, d float64) float64 {
+		if d == 0 {
+			return 0
+		}
+		return n / d
+	}
+	attempts := float64(total + stats.retries.Load() + stats.hedged.Load())
+	throttled := ratio(float64(stats.throttled.Load()), attempts)
+	requestTime := float64(stats.waits.requestTime.Load())
+	rateLimiterWait := ratio(float64(stats.waits.rateLimiterWait.Load()), requestTime)
+	connWait := ratio(float64(stats.waits.connWait.Load()), requestTime)
+	droppedCalls := ratio(float64(dropped), float64(total+dropped))
+	overloaded := ratio(float64(stats.overloaded.Load()), float64(total))
+	succeededQPS := float64(total-stats.failed.Load()-stats.notFound.Load()) / elapsed.Seconds()
+	reached := ratio(succeededQPS, float64(listConfig.qps))
+	klog.Infof("Throughput signals: %.2f QPS of successful calls (%.0f%% of --qps), 429s on %.1f%% of the attempts, %d retries, "+
+		"%.1f%% of the request time waiting on the client rate limiter and %.1f%% for a connection, %.1f%% of the calls not dispatched, %.1f%% failed with a 5xx or a timeout",
+		succeededQPS, reached*100, throttled*100, stats.retries.Load(), rateLimiterWait*100, connWait*100, droppedCalls*100, overloaded*100)
+
+	var verdict, reason string
+	switch {
+	case throttled >= verdictThrottledRatio:
+		verdict, reason = verdictServerAPF, fmt.Sprintf("API Priority and Fairness rejected %.1f%% of the attempts with a 429", throttled*100)
+	case connWait >= verdictWaitRatio:
+		verdict, reason = verdictConnectionPool, fmt.Sprintf("requests spent %.1f%% of their time getting a connection, try more --num-clients", connWait*100)
+	case rateLimiterWait >= verdictWaitRatio:
+		verdict, reason = verdictClientQPS, fmt.Sprintf("requests spent %.1f%% of their time waiting on the client rate limiter", rateLimiterWait*100)
+	case stats.limiter == nil && reached >= verdictQPSRatio && droppedCalls < verdictDroppedRatio:
+		verdict, reason = verdictClientQPS, "the requested --qps was reached, raise it to push the server further"
+	case droppedCalls >= verdictDroppedRatio:
+		verdict, reason = verdictServerCapacity, fmt.Sprintf("%.1f%% of the calls were not dispatched as the in-flight ones were too slow to return", droppedCalls*100)
+	case stats.etcdOverloads.Load() > 0 && 2*stats.etcdOverloads.Load() >= stats.overloaded.Load():
+		verdict, reason = verdictServerCapacity, fmt.Sprintf("mostly of etcd, which reported its overload on %d calls (%.1f%% of the calls failed with a 5xx or a timeout)",
+			stats.etcdOverloads.Load(), overloaded*100)
+	default:
+		verdict, reason = verdictServerCapacity, fmt.Sprintf("the server neither kept up with the requested QPS nor throttled it (%.1f%% of the calls failed with a 5xx or a timeout)", overloaded*100)
+	}
+	klog.Infof("Throughput verdict: limited primarily by %v, %v", verdict, reason)
+	return verdict
+}
@@ -0,0 +1,40 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rcrozean/kube-stress/pkg/version"
+)
+
+var versionCmd *cobra.Command
+
+func init() {
+	versionCmd = &cobra.Command{
+		Use:   "version",
+		Short: "Print the version and build metadata of kube-stress",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Printf("%v %v\n", KubeStress, version.Get())
+		},
+	}
+	rootCmd.AddCommand(versionCmd)
+	// Also available as --version.
+	rootCmd.Version = version.Get().Version
+	rootCmd.SetVersionTemplate(fmt.Sprintf("%v %v\n", KubeStress, version.Get()))
+}
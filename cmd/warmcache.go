@@ -0,0 +1,119 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/scheme"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+)
+
+// How the watch cache was confirmed warm with --warm-cache-first.
+const (
+	cacheWarmBookmark    = "bookmark"
+	cacheWarmList        = "list"
+	cacheWarmUnconfirmed = "unconfirmed"
+)
+
+// How long to wait for the watch cache to be confirmed warm, and between the attempts to confirm it.
+const (
+	cacheWarmTimeout  = 30 * time.Second
+	cacheWarmInterval = time.Second
+)
+
+// Open a watch from the latest resourceVersion and wait until the watch cache is known to have caught up with it,
+// either from a bookmark of the watch or from a cache-served list no older than it. The watch stays open until
+// the returned function is called. Returns how the cache was confirmed warm.
+func warmWatchCache(ctx context.Context, restClient restclient.Interface, namespace, resource string) (string, func(), error) {
+	list, err := restClient.Get().
+		Namespace(namespace).
+		Resource(resource).
+		VersionedParams(&metav1.ListOptions{Limit: 1}, scheme.ParameterCodec).
+		Do(ctx).
+		Get()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get the latest resourceVersion: %v", err)
+	}
+	accessor, err := meta.ListAccessor(list)
+	if err != nil {
+		return "", nil, err
+	}
+	rv := accessor.GetResourceVersion()
+
+	watchCtx, stop := context.WithCancel(ctx)
+	w, err := restClient.Get().
+		Namespace(namespace).
+		Resource(resource).
+		VersionedParams(&metav1.ListOptions{Watch: true, ResourceVersion: rv, AllowWatchBookmarks: true}, scheme.ParameterCodec).
+		Watch(watchCtx)
+	if err != nil {
+		stop()
+		return "", nil, fmt.Errorf("failed to open the warming watch: %v", err)
+	}
+	bookmarked := make(chan struct{})
+	go func() {
+		defer w.Stop()
+		seenBookmark := false
+		for {
+			select {
+			case <-watchCtx.Done():
+				return
+			case event, ok := <-w.ResultChan():
+				if !ok {
+					klog.V(1).Info("The warming watch was closed by the server")
+					return
+				}
+				if event.Type == watch.Bookmark && !seenBookmark {
+					seenBookmark = true
+					close(bookmarked)
+				}
+			}
+		}
+	}()
+
+	timeout := time.After(cacheWarmTimeout)
+	ticker := time.NewTicker(cacheWarmInterval)
+	defer ticker.Stop()
+	for {
+		// Served from the watch cache, which the server only does once it has caught up with the resourceVersion.
+		err := restClient.Get().
+			Namespace(namespace).
+			Resource(resource).
+			VersionedParams(&metav1.ListOptions{Limit: 1, ResourceVersion: rv, ResourceVersionMatch: metav1.ResourceVersionMatchNotOlderThan}, scheme.ParameterCodec).
+			Do(ctx).
+			Error()
+		if err == nil {
+			return cacheWarmList, stop, nil
+		}
+		klog.V(1).Infof("Watch cache not confirmed warm yet: %v", err)
+		select {
+		case <-ctx.Done():
+			stop()
+			return "", nil, ctx.Err()
+		case <-bookmarked:
+			return cacheWarmBookmark, stop, nil
+		case <-timeout:
+			return cacheWarmUnconfirmed, stop, nil
+		case <-ticker.C:
+		}
+	}
+}
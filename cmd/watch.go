@@ -0,0 +1,588 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	"github.com/rcrozean/kube-stress/pkg/client"
+	"github.com/rcrozean/kube-stress/pkg/util"
+)
+
+type WatchConfig struct {
+	namespace     string
+	objectType    string
+	numWatchers   int
+	totalDuration time.Duration
+	checkOrdering bool
+	// Only watching the objects matching them, the same ones being patched with --churn-qps.
+	labelSelector string
+	fieldSelector string
+	churnQPS      float32
+	// Outputs getting a row for every event received, like the ones of the list command.
+	csvOutputFilepath string
+	csvColumns        string
+	jsonlFilepath     string
+	influxOutput      string
+	influxPrecision   string
+}
+
+var (
+	watchConfig *WatchConfig
+	watchCmd    *cobra.Command
+	// Sinks getting the rows of the events received.
+	watchSinks []ResultSink
+	// Delivery latencies of the events of timed writes, across all the watchers.
+	watchDeliveryLatencies = util.NewLatencyTracker()
+)
+
+func init() {
+	watchConfig = &WatchConfig{}
+	watchCmd = &cobra.Command{
+		Use:   "watch",
+		Short: "Watch objects of a given type in the cluster",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := watchCommand(); err != nil {
+				klog.Errorf("Error executing watch command: %v", err)
+				os.Exit(1)
+			}
+		},
+	}
+	rootCmd.AddCommand(watchCmd)
+	watchCmd.Flags().StringVar(&watchConfig.namespace, "namespace", KubeStress, "Namespace to watch the objects in (empty value means all namespaces)")
+	watchCmd.Flags().StringVar(&watchConfig.objectType, "object-type", "configmaps", "Type of objects to watch (any core/v1 resource, e.g 'pods' and 'configmaps')")
+	watchCmd.Flags().IntVar(&watchConfig.numWatchers, "num-watchers", 10, "Number of watches to run, each with its own client")
+	watchCmd.Flags().DurationVar(&watchConfig.totalDuration, "total-duration", 5*time.Minute, "Total duration for which to run this command")
+	watchCmd.Flags().BoolVar(&watchConfig.checkOrdering, "check-ordering", false, "Track the resourceVersion of every object to detect out-of-order, duplicate and missed events")
+	watchCmd.Flags().StringVar(&watchConfig.labelSelector, "label-selector", "", "Only watch the objects matching this label selector")
+	watchCmd.Flags().StringVar(&watchConfig.fieldSelector, "field-selector", "", "Only watch the objects matching this field selector")
+	watchCmd.Flags().Float32Var(&watchConfig.churnQPS, "churn-qps", 0, "Patch the watched objects, which must already exist (e.g created by the create command), at this QPS to time the delivery of their events. "+
+		"Without it, only the events of the writes of other commands recording their time are timed (e.g the annotation churn of the patch command)")
+	watchCmd.Flags().StringVar(&watchConfig.csvOutputFilepath, "csv-output-filepath", "", "Path to the output CSV file getting a row for every event received, preceded by a header")
+	watchCmd.Flags().StringVar(&watchConfig.csvColumns, "csv-columns", "", "Comma-separated, ordered list of the columns of the event outputs (defaults to '"+strings.Join(defaultWatchCSVColumns, ",")+"')")
+	watchCmd.Flags().StringVar(&watchConfig.jsonlFilepath, "jsonl-output-filepath", "", "Path to an output file getting the --csv-columns of every event received as a JSON object per line")
+	watchCmd.Flags().StringVar(&watchConfig.influxOutput, "influx-output", "", "File path, or HTTP(S) URL of an InfluxDB write endpoint, getting a '"+influxEventMeasurement+"' point in line protocol for every event received (tagged by event type, resource and namespace, with object_key, resource_version and delivery_latency_ms fields)")
+	watchCmd.Flags().StringVar(&watchConfig.influxPrecision, "influx-precision", "ns", "Precision of the timestamps of --influx-output ('ns', 'us', 'ms' or 's')")
+}
+
+// Events received by a single watcher.
+type watchStats struct {
+	events     atomic.Uint64
+	errors     atomic.Uint64
+	reconnects atomic.Uint64
+	relists    atomic.Uint64
+	// Relists caused by a too old resourceVersion (410 Gone), out of all the relists.
+	expired atomic.Uint64
+	// Bookmarks only move the resourceVersion to resume from, they aren't counted as events.
+	bookmarks atomic.Uint64
+	// Events breaking the ordering guarantees of the watch, only counted with --check-ordering.
+	anomalies atomic.Uint64
+}
+
+// Tracks the state of every object as seen through a single watcher, to check the events it receives.
+type orderingChecker struct {
+	// Last resourceVersion seen for each object key.
+	lastRV map[string]int64
+	// Last resourceVersion seen on the stream, events being delivered in resourceVersion order.
+	streamRV int64
+	// Last write time seen for each object key, so that only the events of new writes are timed.
+	writtenAt map[string]int64
+}
+
+func watchCommand() error {
+	if watchConfig.churnQPS < 0 {
+		return fmt.Errorf("--churn-qps must not be negative")
+	}
+	if watchConfig.churnQPS > 0 {
+		if err := checkDestructive(destructivePatch, float64(watchConfig.churnQPS), watchConfig.namespace); err != nil {
+			return err
+		}
+	}
+	if err := checkFileDescriptors(watchConfig.numWatchers); err != nil {
+		return err
+	}
+	if err := createWatchSinks(); err != nil {
+		return err
+	}
+	defer func() {
+		for _, sink := range watchSinks {
+			sink.Close()
+		}
+	}()
+	clients := client.CreateKubeClients(loadKubeConfig(watchCmd), watchConfig.numWatchers)
+	signalCtx, signalCancel := signalContext()
+	defer signalCancel()
+	var churnPool *namePool
+	if watchConfig.churnQPS > 0 {
+		var err error
+		if churnPool, err = listChurnPool(signalCtx, clients[0]); err != nil {
+			return err
+		}
+	}
+	if err := waitForStart(signalCtx); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), watchConfig.totalDuration)
+	defer cancel()
+	go func() {
+		<-signalCtx.Done()
+		cancel()
+	}()
+
+	klog.V(1).Infof("Running %v watches for '%v' objects in namespace '%v' (label selector '%v', field selector '%v') for %v",
+		watchConfig.numWatchers,
+		watchConfig.objectType,
+		watchConfig.namespace,
+		watchConfig.labelSelector,
+		watchConfig.fieldSelector,
+		watchConfig.totalDuration)
+
+	start := time.Now()
+	stats := make([]*watchStats, len(clients))
+	var wg sync.WaitGroup
+	for i, c := range clients {
+		stats[i] = &watchStats{}
+		wg.Add(1)
+		go func(i int, c *kubernetes.Clientset) {
+			defer wg.Done()
+			runWatcher(ctx, i, c, stats[i])
+		}(i, c)
+	}
+	churn := &watchChurnStats{latencies: util.NewLatencyTracker()}
+	if churnPool != nil {
+		klog.V(1).Infof("Patching %d of the watched objects with QPS = %v", churnPool.size(), watchConfig.churnQPS)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			churnWatchedObjects(ctx, clients[0], churnPool, churn)
+		}()
+	}
+	wg.Wait()
+	reportWatchStats(stats, time.Since(start))
+	if churnPool != nil {
+		l := churn.latencies.Summary()
+		klog.Infof("Patched the watched objects %d times (%d failed), patch latency: p50 = %v, p99 = %v", churn.patched.Load(), churn.failed.Load(), l.P50, l.P99)
+		if skipped := churn.skipped.Load(); skipped > 0 {
+			klog.Warningf("%d patches were skipped, all %d workers being busy", skipped, watchChurnWorkers)
+		}
+	}
+	return nil
+}
+
+// Create the sinks of the event outputs, sharing the columns of the CSV and JSON ones.
+func createWatchSinks() error {
+	csvColumns = defaultWatchCSVColumns
+	if watchConfig.csvColumns != "" {
+		columns, err := parseCSVColumns(watchConfig.csvColumns)
+		if err != nil {
+			return err
+		}
+		csvColumns = columns
+	}
+	if watchConfig.csvOutputFilepath != "" {
+		writer := util.NewThreadSafeCsvWriter(watchConfig.csvOutputFilepath)
+		writer.Write(csvColumns)
+		watchSinks = append(watchSinks, &csvResultSink{writer: writer})
+	}
+	if watchConfig.jsonlFilepath != "" {
+		sink, err := newJSONResultSink(watchConfig.jsonlFilepath)
+		if err != nil {
+			return fmt.Errorf("failed to create the JSON output: %v", err)
+		}
+		watchSinks = append(watchSinks, sink)
+	}
+	if watchConfig.influxOutput != "" {
+		sink, err := newInfluxResultSink(watchConfig.influxOutput, watchConfig.influxPrecision)
+		if err != nil {
+			return fmt.Errorf("failed to create the Influx output: %v", err)
+		}
+		watchSinks = append(watchSinks, sink)
+	}
+	return nil
+}
+
+// Record an event received by a watcher to the sinks.
+func recordWatchEvent(index int, event watch.Event, arrival time.Time, deliveryLatency time.Duration, timed bool) {
+	row := &listRow{start: arrival, clientIndex: index, eventType: string(event.Type), deliveryLatency: deliveryLatency, deliveryTimed: timed}
+	if accessor, err := meta.Accessor(event.Object); err == nil {
+		row.namespace, row.resourceVersion = accessor.GetNamespace(), accessor.GetResourceVersion()
+		row.objectKey, _ = cache.MetaNamespaceKeyFunc(event.Object)
+	}
+	for _, sink := range watchSinks {
+		sink.Record(row)
+	}
+}
+
+// List the objects, then watch from the list's resourceVersion until the context is done,
+// resuming after the watch gets closed and relisting when the resourceVersion is too old.
+func runWatcher(ctx context.Context, index int, c *kubernetes.Clientset, stats *watchStats) {
+	for ctx.Err() == nil {
+		checker, rv, err := listForWatch(ctx, c)
+		if err != nil {
+			if ctx.Err() == nil {
+				logRequestError("Watcher %d failed to list: %v", index, err)
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+		for ctx.Err() == nil {
+			var expired bool
+			if rv, expired, err = watchFrom(ctx, index, c, rv, checker, stats); err != nil && ctx.Err() == nil {
+				logRequestError("Watcher %d failed to watch: %v", index, err)
+				time.Sleep(time.Second)
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			if expired {
+				stats.relists.Add(1)
+				break
+			}
+			stats.reconnects.Add(1)
+		}
+	}
+}
+
+// List the watched objects, i.e those matching the selectors.
+func listWatched(ctx context.Context, c *kubernetes.Clientset) (runtime.Object, []runtime.Object, error) {
+	opts := metav1.ListOptions{LabelSelector: watchConfig.labelSelector, FieldSelector: watchConfig.fieldSelector}
+	list, err := c.CoreV1().RESTClient().Get().
+		Namespace(watchConfig.namespace).
+		Resource(watchConfig.objectType).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Do(ctx).
+		Get()
+	if err != nil {
+		return nil, nil, err
+	}
+	items, err := meta.ExtractList(list)
+	return list, items, err
+}
+
+// List the objects to learn the resourceVersion to watch from, and their individual resourceVersions and write times.
+func listForWatch(ctx context.Context, c *kubernetes.Clientset) (*orderingChecker, string, error) {
+	list, items, err := listWatched(ctx, c)
+	if err != nil {
+		return nil, "", err
+	}
+	listMeta, err := meta.ListAccessor(list)
+	if err != nil {
+		return nil, "", err
+	}
+	checker := &orderingChecker{lastRV: map[string]int64{}, writtenAt: map[string]int64{}}
+	for _, item := range items {
+		key, err := cache.MetaNamespaceKeyFunc(item)
+		if err != nil {
+			continue
+		}
+		if accessor, err := meta.Accessor(item); err == nil {
+			if writtenAt, ok := writeTime(accessor.GetAnnotations()); ok {
+				checker.writtenAt[key] = writtenAt.UnixNano()
+			}
+		}
+		if watchConfig.checkOrdering {
+			if _, rv, err := keyAndRV(item); err == nil {
+				checker.lastRV[key] = rv
+			}
+		}
+	}
+	checker.streamRV, _ = strconv.ParseInt(listMeta.GetResourceVersion(), 10, 64)
+	return checker, listMeta.GetResourceVersion(), nil
+}
+
+// Whether an error means the resourceVersion to watch from is too old, i.e already compacted.
+func isTooOldResourceVersion(err error) bool {
+	return apierrors.IsResourceExpired(err) || apierrors.IsGone(err)
+}
+
+// Watch from the given resourceVersion until the watch is closed, returning the last resourceVersion seen
+// and whether it expired (i.e the server returned an error event, usually 410 Gone).
+func watchFrom(ctx context.Context, index int, c *kubernetes.Clientset, rv string, checker *orderingChecker, stats *watchStats) (string, bool, error) {
+	opts := metav1.ListOptions{
+		Watch:               true,
+		ResourceVersion:     rv,
+		AllowWatchBookmarks: true,
+		LabelSelector:       watchConfig.labelSelector,
+		FieldSelector:       watchConfig.fieldSelector,
+	}
+	watcher, err := c.CoreV1().RESTClient().Get().
+		Namespace(watchConfig.namespace).
+		Resource(watchConfig.objectType).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Watch(ctx)
+	if isTooOldResourceVersion(err) {
+		stats.expired.Add(1)
+		klog.V(1).Infof("Watcher %d relisting, resourceVersion %v is too old: %v", index, rv, err)
+		return rv, true, nil
+	}
+	if err != nil {
+		return rv, false, err
+	}
+	defer watcher.Stop()
+
+	for event := range watcher.ResultChan() {
+		arrival := time.Now()
+		if event.Type == watch.Error {
+			stats.errors.Add(1)
+			if len(watchSinks) > 0 {
+				recordWatchEvent(index, event, arrival, 0, false)
+			}
+			err := apierrors.FromObject(event.Object)
+			if isTooOldResourceVersion(err) {
+				stats.expired.Add(1)
+				klog.V(1).Infof("Watcher %d relisting, resourceVersion %v is too old: %v", index, rv, err)
+				return rv, true, nil
+			}
+			return rv, true, fmt.Errorf("watch from resourceVersion %v returned an error: %v", rv, err)
+		}
+		if accessor, err := meta.Accessor(event.Object); err == nil {
+			rv = accessor.GetResourceVersion()
+		}
+		if event.Type == watch.Bookmark {
+			stats.bookmarks.Add(1)
+			continue
+		}
+		stats.events.Add(1)
+		latency, timed := checker.deliveryLatency(event, arrival)
+		if timed {
+			watchDeliveryLatencies.Record(latency)
+		}
+		if len(watchSinks) > 0 {
+			recordWatchEvent(index, event, arrival, latency, timed)
+		}
+		if watchConfig.checkOrdering {
+			if anomaly := checker.check(event); anomaly != "" {
+				stats.anomalies.Add(1)
+				klog.Warningf("Watch anomaly: %v", anomaly)
+			}
+		}
+	}
+	return rv, false, nil
+}
+
+func keyAndRV(obj runtime.Object) (string, int64, error) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return "", 0, err
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return "", 0, err
+	}
+	rv, err := strconv.ParseInt(accessor.GetResourceVersion(), 10, 64)
+	return key, rv, err
+}
+
+// Check an event against the state seen so far, returning a description of the anomaly if any.
+func (c *orderingChecker) check(event watch.Event) string {
+	key, rv, err := keyAndRV(event.Object)
+	if err != nil {
+		return fmt.Sprintf("%v event with an unparsable object: %v", event.Type, err)
+	}
+	defer func() {
+		c.streamRV = rv
+		if event.Type == watch.Deleted {
+			delete(c.lastRV, key)
+		} else {
+			c.lastRV[key] = rv
+		}
+	}()
+
+	if rv <= c.streamRV {
+		return fmt.Sprintf("%v event for %v at resourceVersion %d, not after the previous event at %d", event.Type, key, rv, c.streamRV)
+	}
+	last, known := c.lastRV[key]
+	switch {
+	case event.Type == watch.Added && known:
+		return fmt.Sprintf("ADDED event for %v which already exists (at resourceVersion %d), its deletion was missed", key, last)
+	case event.Type != watch.Added && !known:
+		return fmt.Sprintf("%v event for unknown object %v, its creation was missed", event.Type, key)
+	}
+	return ""
+}
+
+// Latest of the write times recorded by the annotations of an object, i.e the time of its latest timed write.
+func writeTime(annotations map[string]string) (time.Time, bool) {
+	var latest time.Time
+	for _, annotation := range []string{writtenAtAnnotation, patchedAtAnnotation} {
+		if t, err := time.Parse(time.RFC3339Nano, annotations[annotation]); err == nil && t.After(latest) {
+			latest = t
+		}
+	}
+	return latest, !latest.IsZero()
+}
+
+// Delay from the time the latest write of the object was sent to the arrival of its event, only known for the
+// MODIFIED events of the writes recording their time. The events of other writes carry the time seen last,
+// and aren't timed (nor are the ADDED events, which may be those of objects newly matching the selectors).
+func (c *orderingChecker) deliveryLatency(event watch.Event, arrival time.Time) (time.Duration, bool) {
+	key, err := cache.MetaNamespaceKeyFunc(event.Object)
+	if err != nil {
+		return 0, false
+	}
+	accessor, err := meta.Accessor(event.Object)
+	if err != nil {
+		return 0, false
+	}
+	if event.Type == watch.Deleted {
+		delete(c.writtenAt, key)
+		return 0, false
+	}
+	writtenAt, ok := writeTime(accessor.GetAnnotations())
+	if !ok || writtenAt.UnixNano() == c.writtenAt[key] {
+		return 0, false
+	}
+	c.writtenAt[key] = writtenAt.UnixNano()
+	return arrival.Sub(writtenAt), event.Type == watch.Modified
+}
+
+// Patches of the watched objects sent with --churn-qps.
+type watchChurnStats struct {
+	patched   atomic.Uint64
+	failed    atomic.Uint64
+	latencies *util.LatencyTracker
+	// Ticks skipped because all the workers were busy, e.g with a slow apiserver.
+	skipped atomic.Uint64
+}
+
+// Number of workers sending the --churn-qps patches, bounding the patches in flight.
+const watchChurnWorkers = 10
+
+// List the watched objects to patch with --churn-qps, which must exist.
+func listChurnPool(ctx context.Context, c *kubernetes.Clientset) (*namePool, error) {
+	_, items, err := listWatched(ctx, c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the objects to patch: %v", err)
+	}
+	pool := newNamePool()
+	for _, item := range items {
+		if key, err := cache.MetaNamespaceKeyFunc(item); err == nil {
+			pool.add(key)
+		}
+	}
+	if pool.size() == 0 {
+		return nil, fmt.Errorf("no '%v' objects to patch in namespace '%v' matching the selectors, create them first with the create command", watchConfig.objectType, watchConfig.namespace)
+	}
+	return pool, nil
+}
+
+// Patch random objects of the pool at --churn-qps until the context is done, with at most watchChurnWorkers
+// patches in flight.
+func churnWatchedObjects(ctx context.Context, c *kubernetes.Clientset, pool *namePool, stats *watchChurnStats) {
+	ticker := time.NewTicker(time.Duration(1000000000.0/watchConfig.churnQPS) * time.Nanosecond)
+	defer ticker.Stop()
+
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < watchChurnWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range work {
+				churnOnce(ctx, c, key, stats)
+			}
+		}()
+	}
+	defer wg.Wait()
+	defer close(work)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			key, _ := pool.pick(rng)
+			select {
+			case work <- key:
+			default:
+				stats.skipped.Add(1)
+			}
+		}
+	}
+}
+
+// Set the write time annotation of an object to the current time, which times the delivery of its event.
+func churnOnce(ctx context.Context, c *kubernetes.Clientset, key string, stats *watchChurnStats) {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return
+	}
+	start := time.Now()
+	patch, _ := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{writtenAtAnnotation: start.Format(time.RFC3339Nano)},
+		},
+	})
+	err = c.CoreV1().RESTClient().Patch(types.MergePatchType).
+		Namespace(namespace).
+		Resource(watchConfig.objectType).
+		Name(name).
+		Body(patch).
+		Do(ctx).
+		Error()
+	if err != nil {
+		if ctx.Err() == nil {
+			stats.failed.Add(1)
+			logRequestError("Failed to patch %v: %v", key, err)
+		}
+		return
+	}
+	stats.latencies.Record(time.Since(start))
+	stats.patched.Add(1)
+}
+
+func reportWatchStats(stats []*watchStats, elapsed time.Duration) {
+	var events, errors, reconnects, relists, expired, bookmarks, anomalies uint64
+	for i, s := range stats {
+		klog.V(1).Infof("Watcher %d: %d events, %d bookmarks, %d errors, %d reconnects, %d relists (%d after a too old resourceVersion), %d anomalies",
+			i, s.events.Load(), s.bookmarks.Load(), s.errors.Load(), s.reconnects.Load(), s.relists.Load(), s.expired.Load(), s.anomalies.Load())
+		events += s.events.Load()
+		errors += s.errors.Load()
+		reconnects += s.reconnects.Load()
+		relists += s.relists.Load()
+		expired += s.expired.Load()
+		bookmarks += s.bookmarks.Load()
+		anomalies += s.anomalies.Load()
+	}
+	klog.Infof("Received %d events (%.2f events/s) and %d bookmarks across %d watchers, with %d error events, %d reconnects and %d relists (%d after a too old resourceVersion)",
+		events, float64(events)/elapsed.Seconds(), bookmarks, len(stats), errors, reconnects, relists, expired)
+	if d := watchDeliveryLatencies.Summary(); d.Count > 0 {
+		klog.Infof("Delivery latency of the %d timed events: p50 = %v, p90 = %v, p99 = %v, max = %v", d.Count, d.P50, d.P90, d.P99, d.Max)
+	} else {
+		klog.Infof("No events of timed writes were received, so no delivery latencies to report (see --churn-qps)")
+	}
+	if watchConfig.checkOrdering {
+		klog.Infof("Detected %d ordering anomalies (out-of-order, duplicate or missed events)", anomalies)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func annotatedConfigMap(annotations map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "cm", Annotations: annotations}}
+}
+
+func TestDeliveryLatency(t *testing.T) {
+	written := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	arrival := written.Add(250 * time.Millisecond)
+	writtenAt := map[string]string{writtenAtAnnotation: written.Format(time.RFC3339Nano)}
+	cases := []struct {
+		name      string
+		seen      map[string]int64
+		event     watch.Event
+		want      time.Duration
+		wantTimed bool
+	}{
+		{
+			name:      "modified by a timed write",
+			event:     watch.Event{Type: watch.Modified, Object: annotatedConfigMap(writtenAt)},
+			want:      250 * time.Millisecond,
+			wantTimed: true,
+		},
+		{
+			name:  "modified by another write, carrying the time seen last",
+			seen:  map[string]int64{"ns/cm": written.UnixNano()},
+			event: watch.Event{Type: watch.Modified, Object: annotatedConfigMap(writtenAt)},
+		},
+		{
+			name:  "modified without a write time",
+			event: watch.Event{Type: watch.Modified, Object: annotatedConfigMap(nil)},
+		},
+		{
+			name:  "added, possibly newly matching the selectors",
+			event: watch.Event{Type: watch.Added, Object: annotatedConfigMap(writtenAt)},
+		},
+		{
+			name:  "deleted",
+			seen:  map[string]int64{"ns/cm": written.Add(-time.Second).UnixNano()},
+			event: watch.Event{Type: watch.Deleted, Object: annotatedConfigMap(writtenAt)},
+		},
+		{
+			name: "latest of the written and patched times",
+			event: watch.Event{Type: watch.Modified, Object: annotatedConfigMap(map[string]string{
+				writtenAtAnnotation: written.Add(-time.Minute).Format(time.RFC3339Nano),
+				patchedAtAnnotation: written.Format(time.RFC3339Nano),
+			})},
+			want:      250 * time.Millisecond,
+			wantTimed: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			checker := &orderingChecker{writtenAt: map[string]int64{}}
+			for key, seen := range c.seen {
+				checker.writtenAt[key] = seen
+			}
+			got, timed := checker.deliveryLatency(c.event, arrival)
+			if timed != c.wantTimed || (timed && got != c.want) {
+				t.Errorf("deliveryLatency() = %v, %v, want %v, %v", got, timed, c.want, c.wantTimed)
+			}
+		})
+	}
+}
+
+func TestDeliveryLatencyTimesEachWriteOnce(t *testing.T) {
+	checker := &orderingChecker{writtenAt: map[string]int64{}}
+	written := time.Now()
+	event := watch.Event{Type: watch.Modified, Object: annotatedConfigMap(map[string]string{writtenAtAnnotation: written.Format(time.RFC3339Nano)})}
+	if _, timed := checker.deliveryLatency(event, written.Add(time.Second)); !timed {
+		t.Fatalf("first event of the write was not timed")
+	}
+	if _, timed := checker.deliveryLatency(event, written.Add(2*time.Second)); timed {
+		t.Errorf("second event carrying the same write time was timed")
+	}
+	deleted := watch.Event{Type: watch.Deleted, Object: event.Object}
+	if _, timed := checker.deliveryLatency(deleted, written.Add(3*time.Second)); timed {
+		t.Errorf("DELETED event was timed")
+	}
+	if _, ok := checker.writtenAt["ns/cm"]; ok {
+		t.Errorf("write time of the deleted object was kept")
+	}
+}
+
+func TestIsTooOldResourceVersion(t *testing.T) {
+	resource := schema.GroupResource{Resource: "configmaps"}
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "expired", err: apierrors.NewResourceExpired("too old resource version: 1 (2)"), want: true},
+		{name: "gone", err: apierrors.NewGone("gone"), want: true},
+		{name: "expired error event", err: apierrors.FromObject(&apierrors.NewResourceExpired("too old resource version").ErrStatus), want: true},
+		{name: "not found", err: apierrors.NewNotFound(resource, "cm")},
+		{name: "too many requests", err: apierrors.NewTooManyRequests("slow down", 1)},
+		{name: "internal error", err: apierrors.NewInternalError(fmt.Errorf("etcdserver: request timed out"))},
+		{name: "no error"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := isTooOldResourceVersion(c.err); got != c.want {
+				t.Errorf("isTooOldResourceVersion(%v) = %v, want %v", c.err, got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	"github.com/rcrozean/kube-stress/pkg/client"
+	"github.com/rcrozean/kube-stress/pkg/util"
+)
+
+// Annotation holding the time the latest write of an object was sent, by this command and the watch --churn-qps.
+const writtenAtAnnotation = KubeStress + "/written-at"
+
+type WatchLatencyConfig struct {
+	namespace     string
+	qps           float32
+	totalDuration time.Duration
+	timeout       time.Duration
+}
+
+var (
+	watchLatencyConfig *WatchLatencyConfig
+	watchLatencyCmd    *cobra.Command
+)
+
+func init() {
+	watchLatencyConfig = &WatchLatencyConfig{}
+	watchLatencyCmd = &cobra.Command{
+		Use:   "watch-latency",
+		Short: "Write timestamps to a sentinel object and measure how long a watch takes to deliver each write",
+		Run: func(cmd *cobra.Command, args []string) {
+			exitOnError(cmd.Name(), watchLatencyCommand())
+		},
+	}
+	rootCmd.AddCommand(watchLatencyCmd)
+	watchLatencyCmd.Flags().StringVar(&watchLatencyConfig.namespace, "namespace", KubeStress, "Namespace where the sentinel configmap is created (and deleted at the end)")
+	watchLatencyCmd.Flags().Float32Var(&watchLatencyConfig.qps, "qps", 10.0, "Rate at which the sentinel configmap is written, writes being sent one at a time")
+	watchLatencyCmd.Flags().DurationVar(&watchLatencyConfig.totalDuration, "total-duration", 5*time.Minute, "Total duration for which to run this command")
+	watchLatencyCmd.Flags().DurationVar(&watchLatencyConfig.timeout, "propagation-timeout", 30*time.Second, "How long to wait at the end for the watch to deliver the last writes before counting them as missed")
+}
+
+type watchLatencyStats struct {
+	writeLatencies *util.LatencyTracker
+	watchDelays    *util.LatencyTracker
+	written        atomic.Uint64
+	failedWrites   atomic.Uint64
+	// Events received, the last time written and the times the watch had to be reopened.
+	received    atomic.Uint64
+	lastWritten atomic.Int64
+	lastSeen    atomic.Int64
+	rewatches   atomic.Uint64
+}
+
+func watchLatencyCommand() error {
+	if watchLatencyConfig.qps <= 0 {
+		return fmt.Errorf("--qps must be positive")
+	}
+	if err := checkDestructive(destructivePatch, float64(watchLatencyConfig.qps), watchLatencyConfig.namespace); err != nil {
+		return err
+	}
+	// The watch gets its own client, so it doesn't share a connection with the writes.
+	clients := client.CreateKubeClients(loadKubeConfig(watchLatencyCmd), 2)
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	sentinel, err := clients[0].CoreV1().ConfigMaps(watchLatencyConfig.namespace).Create(ctx, newConfigMap(0), metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create the sentinel configmap: %v", err)
+	}
+	defer func() {
+		if err := clients[0].CoreV1().ConfigMaps(watchLatencyConfig.namespace).Delete(context.Background(), sentinel.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			klog.Errorf("Failed to delete the sentinel configmap '%v': %v", sentinel.Name, err)
+		}
+	}()
+	stats := &watchLatencyStats{
+		writeLatencies: util.NewLatencyTracker(),
+		watchDelays:    util.NewLatencyTracker(),
+	}
+	watchDone := make(chan struct{})
+	watchCtx, stopWatch := context.WithCancel(ctx)
+	defer stopWatch()
+	go func() {
+		defer close(watchDone)
+		watchSentinel(watchCtx, clients[1], sentinel, stats)
+	}()
+
+	if err := waitForStart(ctx); err != nil {
+		return err
+	}
+	klog.V(1).Infof("Writing the sentinel configmap '%v' in namespace '%v' with QPS = %v for %v",
+		sentinel.Name,
+		watchLatencyConfig.namespace,
+		watchLatencyConfig.qps,
+		watchLatencyConfig.totalDuration)
+	defer reportWatchLatencyStats(stats)
+
+	start := time.Now()
+	ticker := time.NewTicker(time.Duration(1000000000.0/watchLatencyConfig.qps) * time.Nanosecond)
+	defer ticker.Stop()
+	for time.Since(start) < watchLatencyConfig.totalDuration {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			writeSentinel(ctx, clients[0], sentinel.Name, stats)
+		}
+	}
+
+	// Give the watch a chance to deliver the last writes.
+	deadline := time.After(watchLatencyConfig.timeout)
+	for stats.lastSeen.Load() < stats.lastWritten.Load() {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-deadline:
+			return nil
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	stopWatch()
+	<-watchDone
+	return nil
+}
+
+// Set the annotation of the sentinel to the current time, which increases with every write as they are sequential.
+func writeSentinel(ctx context.Context, c *kubernetes.Clientset, name string, stats *watchLatencyStats) {
+	start := time.Now()
+	patch, _ := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{writtenAtAnnotation: start.Format(time.RFC3339Nano)},
+		},
+	})
+	if _, err := c.CoreV1().ConfigMaps(watchLatencyConfig.namespace).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		stats.failedWrites.Add(1)
+		logRequestError("Failed to write the sentinel configmap: %v", err)
+		return
+	}
+	stats.writeLatencies.Record(time.Since(start))
+	stats.written.Add(1)
+	stats.lastWritten.Store(start.UnixNano())
+}
+
+// Watch the sentinel from its creation on, recording the delay from the time each write was sent to its event.
+// The watch is reopened from the last event seen when the server closes it.
+func watchSentinel(ctx context.Context, c *kubernetes.Clientset, sentinel *corev1.ConfigMap, stats *watchLatencyStats) {
+	opts := metav1.ListOptions{
+		FieldSelector:   fields.OneTermEqualSelector("metadata.name", sentinel.Name).String(),
+		ResourceVersion: sentinel.ResourceVersion,
+	}
+	for ctx.Err() == nil {
+		watcher, err := c.CoreV1().ConfigMaps(watchLatencyConfig.namespace).Watch(ctx, opts)
+		if err != nil {
+			logRequestError("Failed to watch the sentinel configmap: %v", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		for event := range watcher.ResultChan() {
+			received := time.Now()
+			if event.Type == watch.Error {
+				// Most likely the resource version got compacted, the watch resumes from the current state.
+				klog.V(1).Infof("Watch of the sentinel configmap failed: %v", apierrors.FromObject(event.Object))
+				opts.ResourceVersion = ""
+				continue
+			}
+			configmap, ok := event.Object.(*corev1.ConfigMap)
+			if event.Type != watch.Modified || !ok {
+				continue
+			}
+			opts.ResourceVersion = configmap.ResourceVersion
+			writtenAt, err := time.Parse(time.RFC3339Nano, configmap.Annotations[writtenAtAnnotation])
+			if err != nil {
+				continue
+			}
+			stats.received.Add(1)
+			stats.lastSeen.Store(writtenAt.UnixNano())
+			stats.watchDelays.Record(received.Sub(writtenAt))
+		}
+		watcher.Stop()
+		if ctx.Err() == nil {
+			stats.rewatches.Add(1)
+		}
+	}
+}
+
+func reportWatchLatencyStats(stats *watchLatencyStats) {
+	w, d := stats.writeLatencies.Summary(), stats.watchDelays.Summary()
+	written, received := stats.written.Load(), stats.received.Load()
+	klog.Infof("Wrote the sentinel %d times (%d failed), write latency: p50 = %v, p99 = %v", written, stats.failedWrites.Load(), w.P50, w.P99)
+	klog.Infof("Watch propagation latency: p50 = %v, p90 = %v, p99 = %v, max = %v", d.P50, d.P90, d.P99, d.Max)
+	if received < written {
+		klog.Warningf("%d writes were never delivered by the watch", written-received)
+	}
+	if rw := stats.rewatches.Load(); rw > 0 {
+		klog.Infof("The watch was closed by the server and reopened %d times", rw)
+	}
+}
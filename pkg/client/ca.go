@@ -0,0 +1,76 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+// Key of the CA bundle in the ConfigMap when not given, as in the kube-root-ca.crt ConfigMaps.
+const DefaultCAConfigMapKey = "ca.crt"
+
+// Parse a 'namespace/name[:key]' ConfigMap reference, the key defaulting to DefaultCAConfigMapKey.
+func ParseCAConfigMap(spec string) (namespace, name, key string, err error) {
+	ref, key, found := strings.Cut(spec, ":")
+	if !found {
+		key = DefaultCAConfigMapKey
+	}
+	namespace, name, _ = strings.Cut(ref, "/")
+	if namespace == "" || name == "" || key == "" {
+		return "", "", "", fmt.Errorf("invalid CA ConfigMap '%v', expected 'namespace/name[:key]'", spec)
+	}
+	return namespace, name, key, nil
+}
+
+// Fetch the CA bundle from the given 'namespace/name[:key]' ConfigMap with the in-cluster service account,
+// and make it the only root of trust of the config.
+func LoadCAFromConfigMap(config *restclient.Config, spec string) error {
+	namespace, name, key, err := ParseCAConfigMap(spec)
+	if err != nil {
+		return err
+	}
+	inCluster, err := restclient.InClusterConfig()
+	if err != nil {
+		return fmt.Errorf("the CA ConfigMap is fetched with the in-cluster service account: %v", err)
+	}
+	inCluster.Timeout = 30 * time.Second
+	kubeClient, err := kubernetes.NewForConfig(inCluster)
+	if err != nil {
+		return err
+	}
+	configMap, err := kubeClient.CoreV1().ConfigMaps(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to fetch the CA ConfigMap: %v", err)
+	}
+	data, ok := configMap.Data[key]
+	if !ok {
+		return fmt.Errorf("CA ConfigMap %v/%v has no '%v' key", namespace, name, key)
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM([]byte(data)) {
+		return fmt.Errorf("'%v' of CA ConfigMap %v/%v holds no PEM certificate", key, namespace, name)
+	}
+	config.TLSClientConfig.CAData = []byte(data)
+	config.TLSClientConfig.CAFile = ""
+	config.TLSClientConfig.Insecure = false
+	return nil
+}
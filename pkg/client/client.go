@@ -15,28 +15,79 @@
 package client
 
 import (
+	"encoding/base64"
+	"fmt"
 	"math"
 	"os"
+	"strings"
 
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	restclient "k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/util/flowcontrol"
 	"k8s.io/klog/v2"
+
+	"github.com/rcrozean/kube-stress/pkg/version"
 )
 
-// Get a kubeconfig object from the supplied file path.
-func GetKubeConfig(kubeconfig string) *restclient.Config {
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+// Environment variable holding base64-encoded kubeconfig contents, used in place of a kubeconfig file.
+const KubeconfigDataEnv = "KUBECONFIG_DATA"
+
+// Get a kubeconfig object from the supplied base64-encoded contents if any, otherwise from the supplied file path,
+// trusting the CA bundle of the 'namespace/name[:key]' ConfigMap instead of the kubeconfig's if caConfigMap is set.
+func GetKubeConfig(kubeconfig, kubeconfigData, caConfigMap string) *restclient.Config {
+	var config *restclient.Config
+	var err error
+	if kubeconfigData != "" {
+		config, err = kubeConfigFromData(kubeconfigData)
+	} else {
+		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+	}
 	if err != nil {
-		klog.Errorf("Error reading the kubeconfig file: %v", err)
+		klog.Errorf("Error reading the kubeconfig: %v", err)
 		os.Exit(1)
 	}
+	if caConfigMap != "" {
+		if err := LoadCAFromConfigMap(config, caConfigMap); err != nil {
+			klog.Errorf("Error loading the CA bundle: %v", err)
+			os.Exit(1)
+		}
+	}
+	// The config's String() redacts the credentials.
+	klog.V(4).Infof("Resolved kubeconfig: %v", config)
 	// Disable client-go rate-limiting, we'll manage the test throughput ourselves.
 	config.RateLimiter = flowcontrol.NewTokenBucketRateLimiter(math.MaxFloat32, math.MaxInt)
 	return config
 }
 
+// Get a kubeconfig object for the given context of the kubeconfig file, or for its current context if empty.
+func GetKubeConfigForContext(kubeconfig, context string) (*restclient.Config, error) {
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfig},
+		&clientcmd.ConfigOverrides{CurrentContext: context},
+	).ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	config.RateLimiter = flowcontrol.NewTokenBucketRateLimiter(math.MaxFloat32, math.MaxInt)
+	return config, nil
+}
+
+// Decode base64-encoded kubeconfig contents, without ever echoing them back in errors.
+func kubeConfigFromData(data string) (*restclient.Config, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+	if err != nil {
+		return nil, fmt.Errorf("kubeconfig data isn't valid base64")
+	}
+	return clientcmd.RESTConfigFromKubeConfig(raw)
+}
+
+// User-Agent identifying the requests sent by the given kube-stress command and run.
+func DefaultUserAgent(command, runID string) string {
+	return fmt.Sprintf("kube-stress/%v (%v; run=%v)", version.Get().Version, command, runID)
+}
+
 // Create a given number of k8s clients using the provided kubeconfig.
 func CreateKubeClients(config *restclient.Config, numClients int) []*kubernetes.Clientset {
 	clients := make([]*kubernetes.Clientset, 0, numClients)
@@ -50,3 +101,26 @@ func CreateKubeClients(config *restclient.Config, numClients int) []*kubernetes.
 	}
 	return clients
 }
+
+// Create a k8s client for each of the provided kubeconfigs.
+func CreateKubeClientsForConfigs(configs []*restclient.Config) []*kubernetes.Clientset {
+	clients := make([]*kubernetes.Clientset, 0, len(configs))
+	for _, config := range configs {
+		clients = append(clients, CreateKubeClients(config, 1)...)
+	}
+	return clients
+}
+
+// Create a dynamic k8s client for each of the provided kubeconfigs.
+func CreateDynamicClientsForConfigs(configs []*restclient.Config) []dynamic.Interface {
+	clients := make([]dynamic.Interface, 0, len(configs))
+	for _, config := range configs {
+		client, err := dynamic.NewForConfig(config)
+		if err != nil {
+			klog.Errorf("Error creating a dynamic k8s client: %v", err)
+			os.Exit(1)
+		}
+		clients = append(clients, client)
+	}
+	return clients
+}
@@ -0,0 +1,45 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"errors"
+	"net/http"
+
+	restclient "k8s.io/client-go/rest"
+)
+
+// Returned in place of the responses of the requests intercepted by WithDryRun.
+var ErrDryRun = errors.New("request not sent in client dry-run")
+
+type dryRunRoundTripper struct {
+	intercept func(req *http.Request)
+}
+
+func (t *dryRunRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.intercept(req)
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	return nil, ErrDryRun
+}
+
+// Make all the requests sent through the config fail with ErrDryRun instead of reaching the server,
+// after being passed to intercept.
+func WithDryRun(config *restclient.Config, intercept func(req *http.Request)) {
+	config.Wrap(func(http.RoundTripper) http.RoundTripper {
+		return &dryRunRoundTripper{intercept: intercept}
+	})
+}
@@ -0,0 +1,57 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	restclient "k8s.io/client-go/rest"
+)
+
+type headerRoundTripper struct {
+	rt     http.RoundTripper
+	header http.Header
+}
+
+func (t *headerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for key, values := range t.header {
+		req.Header[key] = values
+	}
+	return t.rt.RoundTrip(req)
+}
+
+// Parse "Key: Value" headers, values of a repeated key being all sent.
+func ParseHeaders(specs []string) (http.Header, error) {
+	header := http.Header{}
+	for _, spec := range specs {
+		key, value, ok := strings.Cut(spec, ":")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid header '%v', expected 'Key: Value'", spec)
+		}
+		header.Add(key, strings.TrimSpace(value))
+	}
+	return header, nil
+}
+
+// Make all the requests sent through the config carry the given headers, replacing any the client sets.
+func WithHeaders(config *restclient.Config, header http.Header) {
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &headerRoundTripper{rt: rt, header: header}
+	})
+}
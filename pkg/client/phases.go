@@ -0,0 +1,145 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// RequestPhases holds the times at which a request went through the phases of its round trip, zero for the
+// phases it skipped (e.g the dial and TLS handshake on a reused connection).
+type RequestPhases struct {
+	// When the request started waiting to be sent, through the client rate limiter and the wrapped round
+	// trippers: the start of the trace for its first request, the end of the previous one for the next ones.
+	Start        time.Time
+	GetConn      time.Time
+	ConnectStart time.Time
+	ConnectDone  time.Time
+	TLSStart     time.Time
+	TLSDone      time.Time
+	GotConn      time.Time
+	WroteRequest time.Time
+	FirstByte    time.Time
+	// When the body was read to its end or closed.
+	BodyDone time.Time
+}
+
+// PhaseTrace records the phases of every request sent through a traced config with a context made by
+// WithPhaseTrace, e.g the pages of a list.
+type PhaseTrace struct {
+	mu       sync.Mutex
+	Start    time.Time
+	requests []*RequestPhases
+}
+
+type phaseTraceKey struct{}
+
+// Return a context which makes the requests sent through a traced config record their phases, starting now.
+func WithPhaseTrace(ctx context.Context) (context.Context, *PhaseTrace) {
+	trace := &PhaseTrace{Start: time.Now()}
+	return context.WithValue(ctx, phaseTraceKey{}, trace), trace
+}
+
+// Return a copy of the phases of the requests recorded so far, in the order they were sent.
+func (t *PhaseTrace) Requests() []RequestPhases {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	requests := make([]RequestPhases, len(t.requests))
+	for i, r := range t.requests {
+		requests[i] = *r
+	}
+	return requests
+}
+
+// Start recording the phases of a new request, returning the hooks recording them.
+func (t *PhaseTrace) startRequest() (*RequestPhases, *httptrace.ClientTrace) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	phases := &RequestPhases{Start: t.Start}
+	if n := len(t.requests); n > 0 && !t.requests[n-1].BodyDone.IsZero() {
+		phases.Start = t.requests[n-1].BodyDone
+	}
+	t.requests = append(t.requests, phases)
+	// Each phase keeps its first time, e.g that of the first dial when several addresses are tried in parallel.
+	set := func(at *time.Time) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if at.IsZero() {
+			*at = time.Now()
+		}
+	}
+	return phases, &httptrace.ClientTrace{
+		GetConn:              func(string) { set(&phases.GetConn) },
+		ConnectStart:         func(string, string) { set(&phases.ConnectStart) },
+		ConnectDone:          func(string, string, error) { set(&phases.ConnectDone) },
+		TLSHandshakeStart:    func() { set(&phases.TLSStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { set(&phases.TLSDone) },
+		GotConn:              func(httptrace.GotConnInfo) { set(&phases.GotConn) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { set(&phases.WroteRequest) },
+		GotFirstResponseByte: func() { set(&phases.FirstByte) },
+	}
+}
+
+func (t *PhaseTrace) bodyDone(phases *RequestPhases) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if phases.BodyDone.IsZero() {
+		phases.BodyDone = time.Now()
+	}
+}
+
+// Body recording when it was read to its end or closed into the phases of its request.
+type phaseBody struct {
+	io.ReadCloser
+	trace  *PhaseTrace
+	phases *RequestPhases
+}
+
+func (b *phaseBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.trace.bodyDone(b.phases)
+	}
+	return n, err
+}
+
+func (b *phaseBody) Close() error {
+	b.trace.bodyDone(b.phases)
+	return b.ReadCloser.Close()
+}
+
+// Install the hooks of the phase trace of the request's context if any, returning the request to send and a
+// function to call with its response.
+func tracePhases(req *http.Request) (*http.Request, func(*http.Response)) {
+	trace, ok := req.Context().Value(phaseTraceKey{}).(*PhaseTrace)
+	if !ok {
+		return req, func(*http.Response) {}
+	}
+	phases, hooks := trace.startRequest()
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), hooks))
+	return req, func(resp *http.Response) {
+		if resp == nil {
+			trace.bodyDone(phases)
+			return
+		}
+		resp.Body = &phaseBody{ReadCloser: resp.Body, trace: trace, phases: phases}
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	restclient "k8s.io/client-go/rest"
+)
+
+// Header of the responses carrying the ID of their audit event, which the server takes from the request when
+// it sets one.
+const AuditIDHeader = "Audit-Id"
+
+type requestIDRoundTripper struct {
+	rt     http.RoundTripper
+	header string
+}
+
+func (t *requestIDRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	id := uuid.New().String()
+	req = req.Clone(req.Context())
+	req.Header.Set(t.header, id)
+	if info := ResponseInfoFrom(req.Context()); info != nil {
+		info.RequestID = id
+	}
+	return t.rt.RoundTrip(req)
+}
+
+// Make every request sent through the config carry a new random UUID in the given header, recorded as the
+// RequestID of its response info.
+func WithRequestIDs(config *restclient.Config, header string) {
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &requestIDRoundTripper{rt: rt, header: header}
+	})
+}
@@ -0,0 +1,75 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A metric of a Server-Timing response header, e.g `etcd;dur=12.5;desc="storage"`.
+type ServerTimingMetric struct {
+	Name     string
+	Duration time.Duration
+}
+
+// Parse the metrics of all the Server-Timing headers of a response. Only the metrics with a valid duration
+// (in milliseconds, as per the spec) are returned, markers without one not attributing any latency.
+func ParseServerTiming(header http.Header) []ServerTimingMetric {
+	var metrics []ServerTimingMetric
+	for _, value := range header.Values("Server-Timing") {
+		for _, entry := range splitUnquoted(value, ',') {
+			params := splitUnquoted(entry, ';')
+			name := strings.TrimSpace(params[0])
+			if name == "" {
+				continue
+			}
+			for _, param := range params[1:] {
+				key, value, _ := strings.Cut(param, "=")
+				if !strings.EqualFold(strings.TrimSpace(key), "dur") {
+					continue
+				}
+				ms, err := strconv.ParseFloat(strings.Trim(strings.TrimSpace(value), `"`), 64)
+				if err == nil && ms >= 0 {
+					metrics = append(metrics, ServerTimingMetric{Name: name, Duration: time.Duration(ms * float64(time.Millisecond))})
+				}
+				break
+			}
+		}
+	}
+	return metrics
+}
+
+// Split s on sep, except within double-quoted strings (where a backslash escapes the next character).
+func splitUnquoted(s string, sep byte) []string {
+	var parts []string
+	quoted, escaped, last := false, false, 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && s[i] == '\\':
+			escaped = true
+		case s[i] == '"':
+			quoted = !quoted
+		case !quoted && s[i] == sep:
+			parts = append(parts, s[last:i])
+			last = i + 1
+		}
+	}
+	return append(parts, s[last:])
+}
@@ -0,0 +1,204 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	restclient "k8s.io/client-go/rest"
+)
+
+// ConnectionStats counts the connection-level events caused by the requests of a single client.
+type ConnectionStats struct {
+	TLSHandshakes atomic.Uint64
+	// New connections obtained by the requests, as opposed to reused (or multiplexed) ones.
+	NewConnections atomic.Uint64
+}
+
+type tracingRoundTripper struct {
+	rt    http.RoundTripper
+	stats *ConnectionStats
+}
+
+// ResponseInfo records metadata of the HTTP request and response of a request sent through a traced config.
+type ResponseInfo struct {
+	Method        string
+	URL           string
+	RequestHeader http.Header
+	StatusCode    int
+	Header        http.Header
+	// Whether the body was gzip-compressed on the wire (the transport transparently decompresses it).
+	Compressed bool
+	// Content-Length of the response, -1 when unknown (chunked or transparently decompressed responses), and the
+	// bytes of the body read so far.
+	ContentLength int64
+	BodyBytes     int64
+	// UUID sent in the request ID header of a config made by WithRequestIDs.
+	RequestID string
+	// Set before sending the request to capture the start of the body of an error response into ErrorBody.
+	CaptureErrorBody bool
+	ErrorBody        []byte
+}
+
+// Maximum size of the body captured with CaptureErrorBody.
+const maxErrorBodyBytes = 64 << 10
+
+// Body of a response whose start was already read, replayed before the rest of it.
+type replayedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// Body counting the bytes read from it into the response info.
+type countingBody struct {
+	io.ReadCloser
+	info *ResponseInfo
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.info.BodyBytes += int64(n)
+	return n, err
+}
+
+type responseInfoKey struct{}
+
+// Return a context which makes a request sent through a traced config record its response metadata.
+func WithResponseInfo(ctx context.Context) (context.Context, *ResponseInfo) {
+	info := &ResponseInfo{}
+	return context.WithValue(ctx, responseInfoKey{}, info), info
+}
+
+// Return the response info recorded for requests sent with the context, if it was made by WithResponseInfo.
+func ResponseInfoFrom(ctx context.Context) *ResponseInfo {
+	info, _ := ctx.Value(responseInfoKey{}).(*ResponseInfo)
+	return info
+}
+
+// ConnectTiming records the time a request spent dialing its connection and in the TLS handshake.
+type ConnectTiming struct {
+	mu           sync.Mutex
+	connectStart time.Time
+	tlsStart     time.Time
+	Connect      time.Duration
+	TLSHandshake time.Duration
+	// Whether the request got an existing connection, without dialing one.
+	Reused bool
+}
+
+// Return a context which makes a request record its connection setup timings.
+func WithConnectTiming(ctx context.Context) (context.Context, *ConnectTiming) {
+	timing := &ConnectTiming{}
+	trace := &httptrace.ClientTrace{
+		ConnectStart: func(string, string) {
+			timing.mu.Lock()
+			defer timing.mu.Unlock()
+			// Only the first dial counts when several addresses are tried in parallel.
+			if timing.connectStart.IsZero() {
+				timing.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(_, _ string, err error) {
+			timing.mu.Lock()
+			defer timing.mu.Unlock()
+			if err == nil && timing.Connect == 0 {
+				timing.Connect = time.Since(timing.connectStart)
+			}
+		},
+		TLSHandshakeStart: func() {
+			timing.mu.Lock()
+			defer timing.mu.Unlock()
+			timing.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			timing.mu.Lock()
+			defer timing.mu.Unlock()
+			if err == nil {
+				timing.TLSHandshake = time.Since(timing.tlsStart)
+			}
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			timing.mu.Lock()
+			defer timing.mu.Unlock()
+			timing.Reused = info.Reused
+		},
+	}
+	return httptrace.WithClientTrace(ctx, trace), timing
+}
+
+// Total time spent setting up the connection, dialing and in the TLS handshake.
+func (t *ConnectTiming) Total() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.Connect + t.TLSHandshake
+}
+
+func (t *tracingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	trace := &httptrace.ClientTrace{
+		TLSHandshakeStart: func() { t.stats.TLSHandshakes.Add(1) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			if !info.Reused {
+				t.stats.NewConnections.Add(1)
+			}
+		},
+	}
+	req, tracedResponse := tracePhases(req)
+	resp, err := t.rt.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	tracedResponse(resp)
+	info, ok := req.Context().Value(responseInfoKey{}).(*ResponseInfo)
+	if ok {
+		info.Method = req.Method
+		info.URL = req.URL.String()
+		info.RequestHeader = req.Header
+		info.ErrorBody = nil
+	}
+	if ok && resp != nil {
+		info.StatusCode = resp.StatusCode
+		info.Header = resp.Header
+		info.Compressed = resp.Uncompressed || resp.Header.Get("Content-Encoding") == "gzip"
+		info.ContentLength, info.BodyBytes = resp.ContentLength, 0
+		if info.CaptureErrorBody && resp.StatusCode >= http.StatusBadRequest {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+			info.ErrorBody = body
+			resp.Body = &replayedBody{Reader: io.MultiReader(bytes.NewReader(body), resp.Body), Closer: resp.Body}
+		}
+		resp.Body = &countingBody{ReadCloser: resp.Body, info: info}
+	}
+	return resp, err
+}
+
+// Copy the config for each of the given number of clients, tracking connection stats separately for each copy.
+func TracedConfigs(config *restclient.Config, numClients int) ([]*restclient.Config, []*ConnectionStats) {
+	configs := make([]*restclient.Config, 0, numClients)
+	stats := make([]*ConnectionStats, 0, numClients)
+	for i := 0; i < numClients; i++ {
+		clientStats := &ConnectionStats{}
+		clientConfig := restclient.CopyConfig(config)
+		clientConfig.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+			return &tracingRoundTripper{rt: rt, stats: clientStats}
+		})
+		configs = append(configs, clientConfig)
+		stats = append(stats, clientStats)
+	}
+	return configs, stats
+}
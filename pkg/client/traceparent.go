@@ -0,0 +1,53 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	crand "crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+
+	restclient "k8s.io/client-go/rest"
+)
+
+type traceparentRoundTripper struct {
+	rt          http.RoundTripper
+	sampleRatio float64
+	onInject    func(traceID string, req *http.Request)
+}
+
+func (t *traceparentRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if rand.Float64() >= t.sampleRatio || req.Header.Get("traceparent") != "" {
+		return t.rt.RoundTrip(req)
+	}
+	var ids [24]byte
+	crand.Read(ids[:])
+	traceID, spanID := hex.EncodeToString(ids[:16]), hex.EncodeToString(ids[16:])
+	req = req.Clone(req.Context())
+	// Version 00 with the sampled flag set, so the apiserver records the spans of the request.
+	req.Header.Set("traceparent", fmt.Sprintf("00-%v-%v-01", traceID, spanID))
+	t.onInject(traceID, req)
+	return t.rt.RoundTrip(req)
+}
+
+// Make the given ratio of the requests sent through the config carry a new random W3C traceparent header,
+// calling onInject with the trace ID of each of them.
+func WithTraceparent(config *restclient.Config, sampleRatio float64, onInject func(traceID string, req *http.Request)) {
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &traceparentRoundTripper{rt: rt, sampleRatio: sampleRatio, onInject: onInject}
+	})
+}
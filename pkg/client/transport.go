@@ -0,0 +1,134 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	restclient "k8s.io/client-go/rest"
+)
+
+// TransportOptions tune the HTTP transport built by WithSharedTransport.
+type TransportOptions struct {
+	// Maximum number of connections to the server (0 means no limit).
+	MaxConnsPerHost int
+	// Host names whose certificate isn't verified, the certificates of all the other hosts still are.
+	InsecureHosts []string
+	// Addresses to connect to instead of the resolved ones, by "host:port" dialed. The TLS server name
+	// and certificate verification still use the host.
+	Resolve map[string]string
+	// How long an idle connection is kept open (0 keeps the default of the transport).
+	IdleConnTimeout time.Duration
+	// Close the connection after each request instead of keeping it alive for the next ones.
+	DisableKeepAlives bool
+}
+
+// Parse curl-like "host:port:addr" overrides into the Resolve option, addr being an IP address or host name
+// (IPv6 addresses may be in brackets).
+func ParseResolve(specs []string) (map[string]string, error) {
+	resolve := map[string]string{}
+	for _, spec := range specs {
+		host, rest, ok := strings.Cut(spec, ":")
+		port, addr, ok2 := strings.Cut(rest, ":")
+		if !ok || !ok2 || host == "" || port == "" || addr == "" {
+			return nil, fmt.Errorf("invalid override '%v', expected 'host:port:addr'", spec)
+		}
+		addr = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+		resolve[net.JoinHostPort(host, port)] = net.JoinHostPort(addr, port)
+	}
+	return resolve, nil
+}
+
+// Return a copy of the config whose requests all go through a single new transport built with the given options,
+// including the requests of all the clients created from copies of the returned config.
+// A config already returned by WithSharedTransport gets a copy of its transport with the options applied on top.
+func WithSharedTransport(config *restclient.Config, opts TransportOptions) (*restclient.Config, error) {
+	var transport *http.Transport
+	if base, ok := config.Transport.(*http.Transport); ok {
+		transport = base.Clone()
+	} else {
+		tlsConfig, err := restclient.TLSConfigFor(config)
+		if err != nil {
+			return nil, err
+		}
+		transport = utilnet.SetTransportDefaults(&http.Transport{TLSClientConfig: tlsConfig})
+	}
+	if opts.MaxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = opts.MaxConnsPerHost
+	}
+	if opts.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = opts.IdleConnTimeout
+	}
+	if opts.DisableKeepAlives {
+		transport.DisableKeepAlives = true
+	}
+	if len(opts.Resolve) > 0 {
+		dial := transport.DialContext
+		if dial == nil {
+			dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+		}
+		resolve := opts.Resolve
+		transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+			if target, ok := resolve[address]; ok {
+				address = target
+			}
+			return dial(ctx, network, address)
+		}
+	}
+	if len(opts.InsecureHosts) > 0 && transport.TLSClientConfig != nil && !transport.TLSClientConfig.InsecureSkipVerify {
+		skipVerifyFor(transport.TLSClientConfig, config, opts.InsecureHosts)
+	}
+	shared := restclient.CopyConfig(config)
+	shared.Transport = transport
+	// The TLS settings now live in the transport, client-go refuses a custom transport along with them.
+	shared.TLSClientConfig = restclient.TLSClientConfig{}
+	return shared, nil
+}
+
+// Replace the verification of the server certificates by one skipping the given hosts.
+func skipVerifyFor(tlsConfig *tls.Config, config *restclient.Config, hosts []string) {
+	// No SNI is sent for IP addresses, the server name is then the one the config connects to.
+	defaultServerName := tlsConfig.ServerName
+	if u, err := url.Parse(config.Host); err == nil && defaultServerName == "" {
+		defaultServerName = u.Hostname()
+	}
+	roots := tlsConfig.RootCAs
+	tlsConfig.InsecureSkipVerify = true
+	tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+		serverName := state.ServerName
+		if serverName == "" {
+			serverName = defaultServerName
+		}
+		if slices.Contains(hosts, serverName) {
+			return nil
+		}
+		opts := x509.VerifyOptions{DNSName: serverName, Roots: roots, Intermediates: x509.NewCertPool()}
+		for _, cert := range state.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		_, err := state.PeerCertificates[0].Verify(opts)
+		return err
+	}
+}
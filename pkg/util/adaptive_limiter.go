@@ -0,0 +1,115 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// Latency growth over the unloaded one tolerated before the limit gets reduced.
+	adaptiveRTTTolerance = 1.5
+	// Weight of a new limit estimate in the limit, smoothing its changes.
+	adaptiveSmoothing = 0.2
+	// Relative drift of the unloaded latency estimate at each limit update.
+	adaptiveMinRTTDrift = 0.001
+	// Minimum number of samples averaged into the short-term latency before updating the limit.
+	adaptiveMinShortWindow = 10
+)
+
+// Limiter of the requests in flight, discovering the concurrency the server sustains without queuing.
+// It follows the gradient algorithm: the limit grows while the short-term latency stays in line with the
+// unloaded one, and shrinks in proportion when it rises above it.
+type AdaptiveLimiter struct {
+	lock       sync.Mutex
+	limit      float64
+	maxLimit   float64
+	inFlight   int
+	minRTT     float64
+	shortSum   float64
+	shortCount int
+	// Signalled on each release, to wake up an Acquire waiting for a free slot.
+	released chan struct{}
+}
+
+// Create a limiter starting at the initial limit, never going over the maximum one.
+func NewAdaptiveLimiter(initial, maxLimit int) *AdaptiveLimiter {
+	return &AdaptiveLimiter{
+		limit:    float64(initial),
+		maxLimit: float64(maxLimit),
+		released: make(chan struct{}, 1),
+	}
+}
+
+// Wait for a request to be allowed in flight, returning false if the context got cancelled first.
+// Every successful Acquire must be followed by a Release.
+func (l *AdaptiveLimiter) Acquire(ctx context.Context) bool {
+	for {
+		l.lock.Lock()
+		if l.inFlight < int(l.limit) {
+			l.inFlight++
+			l.lock.Unlock()
+			return true
+		}
+		l.lock.Unlock()
+		select {
+		case <-ctx.Done():
+			return false
+		case <-l.released:
+		}
+	}
+}
+
+// Release a request once it completed, taking its latency into account if it succeeded.
+func (l *AdaptiveLimiter) Release(rtt time.Duration, succeeded bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.inFlight--
+	select {
+	case l.released <- struct{}{}:
+	default:
+	}
+	if !succeeded {
+		return
+	}
+	l.shortSum += float64(rtt)
+	l.shortCount++
+	if l.shortCount < max(adaptiveMinShortWindow, int(l.limit)) {
+		return
+	}
+	shortRTT := l.shortSum / float64(l.shortCount)
+	l.shortSum, l.shortCount = 0, 0
+
+	// The unloaded latency is the lowest short-term one, slowly drifting up so that it follows a server getting slower.
+	if l.minRTT == 0 || shortRTT < l.minRTT {
+		l.minRTT = shortRTT
+	} else {
+		l.minRTT *= 1 + adaptiveMinRTTDrift
+	}
+	gradient := math.Max(0.5, math.Min(1, adaptiveRTTTolerance*l.minRTT/shortRTT))
+	// The square root of the limit leaves room to probe for more concurrency while the latency stays flat.
+	estimate := l.limit*gradient + math.Sqrt(l.limit)
+	l.limit = math.Max(1, math.Min(l.maxLimit, (1-adaptiveSmoothing)*l.limit+adaptiveSmoothing*estimate))
+}
+
+// Current limit of the requests in flight.
+func (l *AdaptiveLimiter) Limit() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return int(l.limit)
+}
@@ -0,0 +1,54 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"sync"
+	"time"
+)
+
+// BurstDetector tells when a number of events happened within a sliding time window. It fires once per
+// burst: a new burst can only be detected once the window passed after the previous one.
+type BurstDetector struct {
+	lock      sync.Mutex
+	threshold int
+	window    time.Duration
+	events    []time.Time
+	lastBurst time.Time
+}
+
+func NewBurstDetector(threshold int, window time.Duration) *BurstDetector {
+	return &BurstDetector{threshold: threshold, window: window}
+}
+
+// Record an event at the given time, returning whether it completed a burst.
+func (d *BurstDetector) Record(t time.Time) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	cutoff := t.Add(-d.window)
+	kept := d.events[:0]
+	for _, e := range d.events {
+		if e.After(cutoff) {
+			kept = append(kept, e)
+		}
+	}
+	d.events = append(kept, t)
+	if len(d.events) < d.threshold || (!d.lastBurst.IsZero() && t.Sub(d.lastBurst) < d.window) {
+		return false
+	}
+	d.lastBurst = t
+	d.events = d.events[:0]
+	return true
+}
@@ -15,13 +15,22 @@
 package util
 
 import (
+	"bytes"
 	"encoding/csv"
+	"io"
 	"os"
 	"sync"
+	"sync/atomic"
 
 	"k8s.io/klog/v2"
 )
 
+// CsvWriter is implemented by the CSV writers safe for concurrent use.
+type CsvWriter interface {
+	Write(row []string)
+	Flush()
+}
+
 type ThreadSafeCsvWriter struct {
 	lock      sync.Mutex
 	csvWriter *csv.Writer
@@ -48,3 +57,138 @@ func (w *ThreadSafeCsvWriter) Flush() {
 	defer w.lock.Unlock()
 	w.csvWriter.Flush()
 }
+
+// Policies for the rows written while the buffer of a BufferedCsvWriter is full.
+const (
+	CsvBackpressureBlock  = "block"
+	CsvBackpressureDrop   = "drop"
+	CsvBackpressureSample = "sample"
+)
+
+// With the sample policy, only one in this many rows is kept once the buffer is half full.
+const csvSampleRate = 10
+
+// BufferedCsvWriter writes the rows from a background goroutine, so slow writes don't hold up the callers
+// unless its buffer fills up with the block policy.
+type BufferedCsvWriter struct {
+	rows      chan []string
+	done      chan struct{}
+	policy    string
+	sampled   atomic.Uint64
+	dropped   atomic.Uint64
+	csvWriter *csv.Writer
+	// Whether the rows get appended to a file which already had some.
+	appended bool
+}
+
+// Create a writer truncating the file, or with appendTo adding the rows after the ones already in it.
+func NewBufferedCsvWriter(fileName string, bufferSize int, policy string, appendTo bool) *BufferedCsvWriter {
+	csvFile, size, err := openCsvFile(fileName, appendTo)
+	if err != nil {
+		klog.Errorf("Failed to create file: %v", err)
+		os.Exit(1)
+	}
+	w := &BufferedCsvWriter{
+		rows:      make(chan []string, bufferSize),
+		done:      make(chan struct{}),
+		policy:    policy,
+		csvWriter: csv.NewWriter(csvFile),
+		appended:  size > 0,
+	}
+	go func() {
+		defer close(w.done)
+		for row := range w.rows {
+			w.csvWriter.Write(row)
+		}
+		w.csvWriter.Flush()
+		if err := w.csvWriter.Error(); err != nil {
+			klog.Errorf("Failed to write CSV rows: %v", err)
+		}
+		if err := csvFile.Close(); err != nil {
+			klog.Errorf("Failed to close file: %v", err)
+		}
+	}()
+	return w
+}
+
+func (w *BufferedCsvWriter) Write(row []string) {
+	switch w.policy {
+	case CsvBackpressureBlock:
+		w.rows <- row
+		return
+	case CsvBackpressureSample:
+		if len(w.rows) > cap(w.rows)/2 && w.sampled.Add(1)%csvSampleRate != 0 {
+			w.dropped.Add(1)
+			return
+		}
+	}
+	select {
+	case w.rows <- row:
+	default:
+		w.dropped.Add(1)
+	}
+}
+
+// Flush writes out the buffered rows and stops the writer, no rows can be written afterwards.
+func (w *BufferedCsvWriter) Flush() {
+	close(w.rows)
+	<-w.done
+}
+
+// Appended returns whether the file already had rows, e.g a header which shouldn't be written again.
+func (w *BufferedCsvWriter) Appended() bool {
+	return w.appended
+}
+
+// Size of the chunks read back from the end of a file appended to, looking for the end of its last full row.
+const csvTailChunk = 64 << 10
+
+// Open a CSV file for writing, truncated or positioned at its end with appendTo. A last row left partially
+// written, e.g by a process killed mid-write, is cut off so the new rows don't get glued to it.
+// Returns the size of the file before any new row.
+func openCsvFile(fileName string, appendTo bool) (*os.File, int64, error) {
+	if !appendTo {
+		f, err := os.Create(fileName)
+		return f, 0, err
+	}
+	f, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, 0, err
+	}
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	end := size
+	buf := make([]byte, csvTailChunk)
+	for end > 0 {
+		n := min(end, csvTailChunk)
+		if _, err := f.ReadAt(buf[:n], end-n); err != nil {
+			f.Close()
+			return nil, 0, err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			end = end - n + int64(i) + 1
+			break
+		}
+		end -= n
+	}
+	if end < size {
+		klog.Warningf("Cutting off the last %d bytes of %v, a partially written row", size-end, fileName)
+		if err := f.Truncate(end); err != nil {
+			f.Close()
+			return nil, 0, err
+		}
+	}
+	if _, err := f.Seek(end, io.SeekStart); err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, end, nil
+}
+
+// Dropped returns the number of rows dropped because the buffer was full.
+func (w *BufferedCsvWriter) Dropped() uint64 {
+	return w.dropped.Load()
+}
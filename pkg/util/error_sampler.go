@@ -0,0 +1,86 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"regexp"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// Digit runs (resource versions, UIDs, ports, ...) are ignored when fingerprinting errors.
+var fingerprintDigits = regexp.MustCompile(`[0-9]+`)
+
+// ErrorLogSampler logs the first few occurrences of each distinct error and afterwards
+// only emits periodic "seen X more" summaries, so high failure rates don't flood the logs.
+type ErrorLogSampler struct {
+	lock     sync.Mutex
+	burst    int
+	interval time.Duration
+	errors   map[string]*sampledError
+}
+
+type sampledError struct {
+	message     string
+	seen        int
+	suppressed  int
+	lastSummary time.Time
+}
+
+func NewErrorLogSampler(burst int, interval time.Duration) *ErrorLogSampler {
+	return &ErrorLogSampler{
+		burst:    burst,
+		interval: interval,
+		errors:   map[string]*sampledError{},
+	}
+}
+
+// Log the error prefixed with the given message, unless its fingerprint was already logged too often.
+func (s *ErrorLogSampler) LogError(msg string, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	fingerprint := fingerprintDigits.ReplaceAllString(err.Error(), "N")
+	e, ok := s.errors[fingerprint]
+	if !ok {
+		e = &sampledError{message: msg + ": " + err.Error(), lastSummary: time.Now()}
+		s.errors[fingerprint] = e
+	}
+	e.seen++
+	if e.seen <= s.burst {
+		klog.Errorf("%v: %v", msg, err)
+		return
+	}
+	e.suppressed++
+	if time.Since(e.lastSummary) >= s.interval {
+		klog.Errorf("Seen %d more of this error (%d total): %v", e.suppressed, e.seen, e.message)
+		e.suppressed = 0
+		e.lastSummary = time.Now()
+	}
+}
+
+// Log summaries for all errors with occurrences that haven't been reported yet.
+func (s *ErrorLogSampler) Flush() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, e := range s.errors {
+		if e.suppressed > 0 {
+			klog.Errorf("Seen %d more of this error (%d total): %v", e.suppressed, e.seen, e.message)
+			e.suppressed = 0
+		}
+	}
+}
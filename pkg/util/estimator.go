@@ -0,0 +1,70 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// PercentileEstimator approximates the percentiles of a stream of latencies in bounded memory, for the latency
+// trackers which don't keep every sample.
+type PercentileEstimator interface {
+	Record(latency time.Duration)
+	// Percentile p (between 0 and 100) of the latencies recorded, 0 when none were.
+	Percentile(p float64) time.Duration
+	// Add the latencies recorded by another estimator of the same kind.
+	Merge(other PercentileEstimator) error
+}
+
+// Estimates the percentiles with an HdrHistogram of the latencies in microseconds, up to boundedHighestLatency
+// (above which they're clamped), the percentiles being the lowest values of the buckets they fall in.
+type hdrEstimator struct {
+	hist  *Histogram
+	count int64
+}
+
+func NewHdrEstimator() PercentileEstimator {
+	return &hdrEstimator{hist: NewHistogram(boundedHighestLatency.Microseconds(), boundedSignificantDigits)}
+}
+
+func (e *hdrEstimator) Record(latency time.Duration) {
+	e.hist.Record(latency.Microseconds())
+	e.count++
+}
+
+func (e *hdrEstimator) Percentile(p float64) time.Duration {
+	rank := max(int64(math.Ceil(p/100*float64(e.count))), 1)
+	var seen int64
+	var percentile time.Duration
+	e.hist.ForEachValue(func(value, count int64) {
+		if seen < rank {
+			percentile = time.Duration(value) * time.Microsecond
+		}
+		seen += count
+	})
+	return percentile
+}
+
+func (e *hdrEstimator) Merge(other PercentileEstimator) error {
+	o, ok := other.(*hdrEstimator)
+	if !ok {
+		return fmt.Errorf("can't merge a %T into an HdrHistogram estimator", other)
+	}
+	e.hist.Add(o.hist)
+	e.count += o.count
+	return nil
+}
@@ -0,0 +1,60 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"runtime/debug"
+	"runtime/metrics"
+	"sync"
+	"time"
+)
+
+const gcCyclesMetric = "/gc/cycles/total:gc-cycles"
+
+// Tells whether a time window overlapped a stop-the-world pause of this process' garbage collector.
+// The pause history is only re-read when a GC cycle completed since the last call, which keeps it cheap
+// enough to call for every request. The runtime keeps the last 256 pauses, so windows must be checked
+// soon after they end.
+type GCPauseTracker struct {
+	lock   sync.Mutex
+	sample []metrics.Sample
+	cycles uint64
+	stats  debug.GCStats
+}
+
+func NewGCPauseTracker() *GCPauseTracker {
+	return &GCPauseTracker{sample: []metrics.Sample{{Name: gcCyclesMetric}}}
+}
+
+// Whether a GC pause overlapped the window from start to end.
+func (t *GCPauseTracker) Overlaps(start, end time.Time) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	metrics.Read(t.sample)
+	if cycles := t.sample[0].Value.Uint64(); cycles != t.cycles {
+		t.cycles = cycles
+		debug.ReadGCStats(&t.stats)
+	}
+	// Most recent first, so the search stops at the first pause which ended before the window.
+	for i, pauseEnd := range t.stats.PauseEnd {
+		if pauseEnd.Before(start) {
+			return false
+		}
+		if pauseEnd.Add(-t.stats.Pause[i]).Before(end) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+	"time"
+)
+
+// Cookies of the V2 encoding of HdrHistogram, uncompressed and compressed.
+const (
+	hdrEncodingCookie           = 0x1c849303 | 0x10
+	hdrCompressedEncodingCookie = 0x1c849304 | 0x10
+)
+
+// Histogram is a minimal HdrHistogram with a lowest discernible value of 1, only able to record values and encode
+// itself in the standard compressed V2 encoding, for logs mergeable by any HdrHistogram implementation.
+type Histogram struct {
+	highestTrackableValue       int64
+	significantDigits           int
+	subBucketHalfCountMagnitude int
+	subBucketHalfCount          int
+	subBucketMask               int64
+	counts                      []int64
+	maxValue                    int64
+}
+
+func NewHistogram(highestTrackableValue int64, significantDigits int) *Histogram {
+	largestValueWithSingleUnitResolution := int64(2)
+	for i := 0; i < significantDigits; i++ {
+		largestValueWithSingleUnitResolution *= 10
+	}
+	subBucketCountMagnitude := bits.Len64(uint64(largestValueWithSingleUnitResolution - 1))
+	subBucketHalfCountMagnitude := max(subBucketCountMagnitude, 1) - 1
+	subBucketCount := int64(1) << (subBucketHalfCountMagnitude + 1)
+
+	bucketCount := 1
+	for smallestUntrackableValue := subBucketCount; smallestUntrackableValue < highestTrackableValue; smallestUntrackableValue <<= 1 {
+		bucketCount++
+		if smallestUntrackableValue > (1<<62)-1 {
+			break
+		}
+	}
+	return &Histogram{
+		highestTrackableValue:       highestTrackableValue,
+		significantDigits:           significantDigits,
+		subBucketHalfCountMagnitude: subBucketHalfCountMagnitude,
+		subBucketHalfCount:          int(subBucketCount / 2),
+		subBucketMask:               subBucketCount - 1,
+		counts:                      make([]int64, (bucketCount+1)*int(subBucketCount/2)),
+	}
+}
+
+// Record a value, clamped to the range of the histogram.
+func (h *Histogram) Record(v int64) {
+	v = min(max(v, 0), h.highestTrackableValue)
+	h.counts[h.countsIndex(v)]++
+	h.maxValue = max(h.maxValue, v)
+}
+
+func (h *Histogram) countsIndex(v int64) int {
+	bucketIndex := bits.Len64(uint64(v|h.subBucketMask)) - (h.subBucketHalfCountMagnitude + 1)
+	subBucketIndex := int(v >> bucketIndex)
+	return (bucketIndex+1)<<h.subBucketHalfCountMagnitude + subBucketIndex - h.subBucketHalfCount
+}
+
+// Add the counts of another histogram of the same range and precision.
+func (h *Histogram) Add(other *Histogram) {
+	for i, count := range other.counts {
+		h.counts[i] += count
+	}
+	h.maxValue = max(h.maxValue, other.maxValue)
+}
+
+// Call fn with the lowest value of each non-empty bucket and its count, in increasing value order.
+func (h *Histogram) ForEachValue(fn func(value, count int64)) {
+	for i, count := range h.counts {
+		if count == 0 {
+			continue
+		}
+		bucketIndex := i>>h.subBucketHalfCountMagnitude - 1
+		subBucketIndex := i&(h.subBucketHalfCount-1) + h.subBucketHalfCount
+		if bucketIndex < 0 {
+			subBucketIndex -= h.subBucketHalfCount
+			bucketIndex = 0
+		}
+		fn(int64(subBucketIndex)<<bucketIndex, count)
+	}
+}
+
+// Encode the histogram in the compressed V2 encoding, base64-encoded as in the HdrHistogram log format.
+func (h *Histogram) Encode() (string, error) {
+	// Counts are zig-zag LEB128 encoded, with runs of several empty counts as a single negative number.
+	var payload []byte
+	last := h.countsIndex(h.maxValue)
+	for i := 0; i <= last; i++ {
+		zeros := int64(0)
+		for i+int(zeros) <= last && h.counts[i+int(zeros)] == 0 {
+			zeros++
+		}
+		if zeros > 1 {
+			payload = binary.AppendVarint(payload, -zeros)
+			i += int(zeros) - 1
+			continue
+		}
+		payload = binary.AppendVarint(payload, h.counts[i])
+	}
+
+	var encoded bytes.Buffer
+	for _, field := range []any{
+		int32(hdrEncodingCookie),
+		int32(len(payload)),
+		// Normalizing index offset.
+		int32(0),
+		int32(h.significantDigits),
+		// Lowest discernible value.
+		int64(1),
+		h.highestTrackableValue,
+		// Integer to double value conversion ratio.
+		float64(1),
+	} {
+		binary.Write(&encoded, binary.BigEndian, field)
+	}
+	encoded.Write(payload)
+
+	var compressed bytes.Buffer
+	w := zlib.NewWriter(&compressed)
+	if _, err := io.Copy(w, &encoded); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	binary.Write(&out, binary.BigEndian, int32(hdrCompressedEncodingCookie))
+	binary.Write(&out, binary.BigEndian, int32(compressed.Len()))
+	out.Write(compressed.Bytes())
+	return base64.StdEncoding.EncodeToString(out.Bytes()), nil
+}
+
+// Write the histogram as the single interval of an HdrHistogram log (format version 1.3), the interval
+// maximum being printed in units of maxValueUnitRatio.
+func (h *Histogram) WriteLog(w io.Writer, start time.Time, length time.Duration, maxValueUnitRatio float64) error {
+	encoded, err := h.Encode()
+	if err != nil {
+		return err
+	}
+	startSeconds := float64(start.UnixMilli()) / 1000
+	_, err = fmt.Fprintf(w, "#[Histogram log format version 1.3]\n"+
+		"#[StartTime: %.3f (seconds since epoch), %v]\n"+
+		"\"StartTimestamp\",\"Interval_Length\",\"Interval_Max\",\"Interval_Compressed_Histogram\"\n"+
+		"%.3f,%.3f,%.3f,%v\n",
+		startSeconds, start.Format(time.UnixDate),
+		startSeconds, length.Seconds(), float64(h.maxValue)/maxValueUnitRatio, encoded)
+	return err
+}
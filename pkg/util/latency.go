@@ -0,0 +1,178 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"cmp"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LatencyTracker accumulates latency samples from concurrent requests.
+type LatencyTracker struct {
+	lock    sync.Mutex
+	samples []time.Duration
+	// Set once bounded, replacing the samples, along with the exact count, sum and extremes.
+	estimator    PercentileEstimator
+	newEstimator func() PercentileEstimator
+	count        int
+	sum          time.Duration
+	min, max     time.Duration
+}
+
+// Range and precision of the histogram of NewHdrEstimator, whose latencies are recorded in microseconds.
+const (
+	boundedHighestLatency    = time.Hour
+	boundedSignificantDigits = 3
+)
+
+// Statistics computed over all the samples recorded by a LatencyTracker.
+type LatencySummary struct {
+	Count int           `json:"count"`
+	Min   time.Duration `json:"min"`
+	Max   time.Duration `json:"max"`
+	Mean  time.Duration `json:"mean"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P95   time.Duration `json:"p95"`
+	P99   time.Duration `json:"p99"`
+}
+
+func NewLatencyTracker() *LatencyTracker {
+	return &LatencyTracker{}
+}
+
+func (t *LatencyTracker) Record(latency time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.estimator != nil {
+		t.recordBounded(latency)
+		return
+	}
+	t.samples = append(t.samples, latency)
+}
+
+func (t *LatencyTracker) recordBounded(latency time.Duration) {
+	if t.count == 0 || latency < t.min {
+		t.min = latency
+	}
+	t.max = max(t.max, latency)
+	t.count++
+	t.sum += latency
+	t.estimator.Record(latency)
+}
+
+// Switch to recording into percentile estimators of the given kind rather than keeping every sample, e.g
+// NewHdrEstimator whose percentiles are accurate to 3 significant digits (of microseconds). The samples recorded
+// so far are moved into the estimator.
+func (t *LatencyTracker) Bound(newEstimator func() PercentileEstimator) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.estimator != nil {
+		return
+	}
+	t.estimator, t.newEstimator = newEstimator(), newEstimator
+	for _, s := range t.samples {
+		t.recordBounded(s)
+	}
+	t.samples = nil
+}
+
+// Return a copy of the samples recorded so far, none being kept once the tracker is bounded.
+func (t *LatencyTracker) Samples() []time.Duration {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return append([]time.Duration(nil), t.samples...)
+}
+
+// Compute the summary statistics. All values are zero when no samples were recorded.
+func (t *LatencyTracker) Summary() LatencySummary {
+	t.lock.Lock()
+	if t.estimator != nil {
+		defer t.lock.Unlock()
+		return t.summarizeBounded()
+	}
+	samples := make([]time.Duration, len(t.samples))
+	copy(samples, t.samples)
+	t.lock.Unlock()
+	return summarize(samples)
+}
+
+// Compute the summary statistics of the samples recorded so far and discard them, starting over.
+func (t *LatencyTracker) SummaryAndReset() LatencySummary {
+	t.lock.Lock()
+	if t.estimator != nil {
+		defer t.lock.Unlock()
+		summary := t.summarizeBounded()
+		t.estimator = t.newEstimator()
+		t.count, t.sum, t.min, t.max = 0, 0, 0, 0
+		return summary
+	}
+	samples := t.samples
+	t.samples = nil
+	t.lock.Unlock()
+	return summarize(samples)
+}
+
+// Summary statistics of the given samples, sorting them in place.
+func summarize(samples []time.Duration) LatencySummary {
+	if len(samples) == 0 {
+		return LatencySummary{}
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+
+	var total time.Duration
+	for _, s := range samples {
+		total += s
+	}
+	return LatencySummary{
+		Count: len(samples),
+		Min:   samples[0],
+		Max:   samples[len(samples)-1],
+		Mean:  total / time.Duration(len(samples)),
+		P50:   Percentile(samples, 50),
+		P90:   Percentile(samples, 90),
+		P95:   Percentile(samples, 95),
+		P99:   Percentile(samples, 99),
+	}
+}
+
+// Summary statistics of a bounded tracker, the percentiles being estimated.
+func (t *LatencyTracker) summarizeBounded() LatencySummary {
+	if t.count == 0 {
+		return LatencySummary{}
+	}
+	return LatencySummary{
+		Count: t.count,
+		Min:   t.min,
+		Max:   t.max,
+		Mean:  t.sum / time.Duration(t.count),
+		P50:   t.estimator.Percentile(50),
+		P90:   t.estimator.Percentile(90),
+		P95:   t.estimator.Percentile(95),
+		P99:   t.estimator.Percentile(99),
+	}
+}
+
+// Nearest-rank percentile over non-empty, sorted samples.
+func Percentile[T cmp.Ordered](sorted []T, p float64) T {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,108 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// Layout of the plots written by WriteHistogramSVG, in pixels, and the number of bars.
+const (
+	plotWidth  = 800
+	plotHeight = 400
+	plotMargin = 60
+	plotBins   = 60
+)
+
+// Render the distribution of the values recorded in the histogram as an SVG bar chart over a logarithmic
+// axis, optionally with the CDF overlaid. Values get divided by unitRatio and labelled with unit on the axis.
+func WriteHistogramSVG(w io.Writer, h *Histogram, unitRatio float64, unit string, withCDF bool) error {
+	var values, counts []int64
+	var total int64
+	h.ForEachValue(func(value, count int64) {
+		values = append(values, max(value, 1))
+		counts = append(counts, count)
+		total += count
+	})
+	if total == 0 {
+		return fmt.Errorf("no values to plot")
+	}
+	logMin, logMax := math.Log10(float64(values[0])), math.Log10(float64(values[len(values)-1]))
+	if logMax-logMin < 1 {
+		logMin, logMax = logMin-0.5, logMax+0.5
+	}
+	innerWidth, innerHeight := float64(plotWidth-2*plotMargin), float64(plotHeight-2*plotMargin)
+	x := func(v float64) float64 {
+		return plotMargin + (math.Log10(v)-logMin)/(logMax-logMin)*innerWidth
+	}
+
+	bins := make([]int64, plotBins)
+	var highest int64
+	for i, v := range values {
+		bin := min(int((math.Log10(float64(v))-logMin)/(logMax-logMin)*plotBins), plotBins-1)
+		bins[bin] += counts[i]
+		highest = max(highest, bins[bin])
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="12">`+"\n", plotWidth, plotHeight)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="white"/>`+"\n", plotWidth, plotHeight)
+	barWidth := innerWidth / plotBins
+	for i, count := range bins {
+		if count == 0 {
+			continue
+		}
+		height := float64(count) / float64(highest) * innerHeight
+		fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="steelblue"><title>%d</title></rect>`+"\n",
+			plotMargin+float64(i)*barWidth, plotHeight-plotMargin-height, barWidth*0.9, height, count)
+	}
+	if withCDF {
+		var points []string
+		var cumulative int64
+		for i, v := range values {
+			cumulative += counts[i]
+			points = append(points, fmt.Sprintf("%.1f,%.1f", x(float64(v)), plotHeight-plotMargin-float64(cumulative)/float64(total)*innerHeight))
+		}
+		fmt.Fprintf(&b, `<polyline points="%v" fill="none" stroke="darkorange" stroke-width="2"/>`+"\n", strings.Join(points, " "))
+		for _, p := range []int{0, 50, 90, 99} {
+			y := plotHeight - plotMargin - float64(p)/100*innerHeight
+			fmt.Fprintf(&b, `<text x="%d" y="%.1f" fill="darkorange">%d%%</text>`+"\n", plotWidth-plotMargin+5, y+4, p)
+		}
+	}
+
+	// Axes, with ticks at 1, 2 and 5 times every power of ten on the value axis.
+	fmt.Fprintf(&b, `<path d="M%d,%d V%d H%d" fill="none" stroke="black"/>`+"\n", plotMargin, plotMargin, plotHeight-plotMargin, plotWidth-plotMargin)
+	for e := math.Floor(logMin); e <= logMax; e++ {
+		for _, m := range []float64{1, 2, 5} {
+			v := m * math.Pow(10, e)
+			if l := math.Log10(v); l < logMin || l > logMax {
+				continue
+			}
+			tx := x(v)
+			fmt.Fprintf(&b, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%d" stroke="black"/>`+"\n", tx, plotHeight-plotMargin, tx, plotHeight-plotMargin+5)
+			fmt.Fprintf(&b, `<text x="%.1f" y="%d" text-anchor="middle">%g</text>`+"\n", tx, plotHeight-plotMargin+20, v/unitRatio)
+		}
+	}
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="middle">latency (%v)</text>`+"\n", plotWidth/2, plotHeight-15, unit)
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">%d</text>`+"\n", plotMargin-5, plotMargin+4, highest)
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">0</text>`+"\n", plotMargin-5, plotHeight-plotMargin+4)
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="middle">%d calls</text>`+"\n", plotWidth/2, plotMargin-20, total)
+	b.WriteString("</svg>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
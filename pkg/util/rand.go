@@ -17,6 +17,7 @@ package util
 import (
 	"math/rand"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -49,3 +50,38 @@ func RandomString(n int) string {
 
 	return sb.String()
 }
+
+// ThreadSafeRand wraps a seeded rand.Rand so it can be shared across request goroutines.
+type ThreadSafeRand struct {
+	lock sync.Mutex
+	rand *rand.Rand
+}
+
+// Create a random number generator from the given seed (0 means seed from the current time).
+func NewThreadSafeRand(seed int64) *ThreadSafeRand {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &ThreadSafeRand{rand: rand.New(rand.NewSource(seed))}
+}
+
+// Return a random int in the closed interval [min, max].
+func (r *ThreadSafeRand) IntRange(min, max int) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return min + r.rand.Intn(max-min+1)
+}
+
+// Return a random float64 in the half-open interval [0.0, 1.0).
+func (r *ThreadSafeRand) Float64() float64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.rand.Float64()
+}
+
+// Return a normally distributed float64 of mean 0 and standard deviation 1.
+func (r *ThreadSafeRand) NormFloat64() float64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.rand.NormFloat64()
+}
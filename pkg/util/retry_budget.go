@@ -0,0 +1,57 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import "sync"
+
+// RetryBudget only permits retries while they stay below a fraction of the recent requests,
+// similar to the gRPC/Finagle retry budgets: every request deposits `ratio` tokens and every
+// retry withdraws a whole one. The balance is capped, so only recent requests count.
+type RetryBudget struct {
+	lock      sync.Mutex
+	ratio     float64
+	tokens    float64
+	maxTokens float64
+}
+
+// Create a retry budget allowing retries for the given fraction of requests, plus a reserve
+// of retries that lets the first few failures be retried.
+func NewRetryBudget(ratio float64, reserve int) *RetryBudget {
+	return &RetryBudget{
+		ratio:     ratio,
+		tokens:    float64(reserve),
+		maxTokens: float64(reserve),
+	}
+}
+
+func (b *RetryBudget) OnRequest() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.tokens += b.ratio
+	if b.tokens > b.maxTokens {
+		b.tokens = b.maxTokens
+	}
+}
+
+// Withdraw a retry from the budget, returning false if the budget is exhausted.
+func (b *RetryBudget) TryRetry() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
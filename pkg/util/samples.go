@@ -0,0 +1,87 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// A single request outcome, as served by a SampleBuffer.
+type Sample struct {
+	Timestamp time.Time `json:"ts"`
+	LatencyMs float64   `json:"latency_ms"`
+	// HTTP status code of the response, 0 if none was received.
+	Status int `json:"status"`
+}
+
+// SampleBuffer keeps the most recent samples in a ring buffer until they are scraped.
+type SampleBuffer struct {
+	lock    sync.Mutex
+	samples []Sample
+	next    int
+	full    bool
+	// Samples overwritten before being scraped.
+	overwritten uint64
+}
+
+func NewSampleBuffer(size int) *SampleBuffer {
+	return &SampleBuffer{samples: make([]Sample, size)}
+}
+
+func (b *SampleBuffer) Add(sample Sample) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.full {
+		b.overwritten++
+	}
+	b.samples[b.next] = sample
+	b.next = (b.next + 1) % len(b.samples)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// Return the buffered samples, oldest first, and clear the buffer.
+func (b *SampleBuffer) Drain() []Sample {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	var drained []Sample
+	if b.full {
+		drained = append(drained, b.samples[b.next:]...)
+	}
+	drained = append(drained, b.samples[:b.next]...)
+	b.next, b.full = 0, false
+	return drained
+}
+
+// Serve the samples collected since the previous request as a JSON array, clearing them.
+func (b *SampleBuffer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	samples := b.Drain()
+	if samples == nil {
+		samples = []Sample{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(samples)
+}
+
+// Number of samples overwritten before being scraped, because the buffer was too small for the scrape interval.
+func (b *SampleBuffer) Overwritten() uint64 {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.overwritten
+}
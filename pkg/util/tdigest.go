@@ -0,0 +1,152 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Compression of a t-digest with NewTDigestEstimator, bounding the number of its centroids to around that many.
+const DefaultTDigestCompression = 100
+
+// Estimates the percentiles with a merging t-digest (Dunning & Ertl), clustering the latencies into centroids
+// which get smaller towards the tails. It adapts to any range of latencies, and merging digests keeps their
+// accuracy.
+type tdigestEstimator struct {
+	compression float64
+	// Sorted by mean, the latencies recorded since the last compression waiting in the buffer.
+	centroids []centroid
+	buffer    []centroid
+	count     float64
+	min, max  float64
+}
+
+type centroid struct {
+	mean, weight float64
+}
+
+func NewTDigestEstimator(compression float64) PercentileEstimator {
+	return &tdigestEstimator{compression: compression}
+}
+
+func (d *tdigestEstimator) Record(latency time.Duration) {
+	d.add(centroid{mean: float64(latency), weight: 1})
+}
+
+func (d *tdigestEstimator) add(c centroid) {
+	if d.count == 0 || c.mean < d.min {
+		d.min = c.mean
+	}
+	if d.count == 0 || c.mean > d.max {
+		d.max = c.mean
+	}
+	d.count += c.weight
+	d.buffer = append(d.buffer, c)
+	if len(d.buffer) >= int(5*d.compression) {
+		d.compress()
+	}
+}
+
+// Scale function k1 of the t-digest, mapping a quantile to the index of the centroid it falls in.
+func (d *tdigestEstimator) k(q float64) float64 {
+	return d.compression / (2 * math.Pi) * math.Asin(2*q-1)
+}
+
+func (d *tdigestEstimator) kInverse(k float64) float64 {
+	if k >= d.compression/4 {
+		return 1
+	}
+	return (math.Sin(k*2*math.Pi/d.compression) + 1) / 2
+}
+
+// Merge the buffered latencies into the centroids, each centroid covering at most one unit of the scale function.
+func (d *tdigestEstimator) compress() {
+	if len(d.buffer) == 0 {
+		return
+	}
+	all := append(d.buffer, d.centroids...)
+	sort.Slice(all, func(i, j int) bool { return all[i].mean < all[j].mean })
+	merged := make([]centroid, 0, len(d.centroids)+1)
+	current := all[0]
+	var before float64
+	limit := d.count * d.kInverse(d.k(0)+1)
+	for _, c := range all[1:] {
+		if before+current.weight+c.weight <= limit {
+			current.mean += (c.mean - current.mean) * c.weight / (current.weight + c.weight)
+			current.weight += c.weight
+			continue
+		}
+		before += current.weight
+		merged = append(merged, current)
+		current = c
+		limit = d.count * d.kInverse(d.k(before/d.count)+1)
+	}
+	d.centroids = append(merged, current)
+	d.buffer = d.buffer[:0]
+}
+
+func (d *tdigestEstimator) Percentile(p float64) time.Duration {
+	if d.count == 0 {
+		return 0
+	}
+	d.compress()
+	target := p / 100 * d.count
+	// Interpolates between the centers of the centroids, the extremes being the ends of the first and last ones.
+	first := d.centroids[0]
+	if target < first.weight/2 {
+		return time.Duration(math.Round(interpolate(d.min, first.mean, target, 0, first.weight/2)))
+	}
+	var cumulative float64
+	for i := 0; i < len(d.centroids)-1; i++ {
+		c, next := d.centroids[i], d.centroids[i+1]
+		left, right := cumulative+c.weight/2, cumulative+c.weight+next.weight/2
+		if target <= right {
+			return time.Duration(math.Round(interpolate(c.mean, next.mean, target, left, right)))
+		}
+		cumulative += c.weight
+	}
+	last := d.centroids[len(d.centroids)-1]
+	return time.Duration(math.Round(interpolate(last.mean, d.max, target, cumulative+last.weight/2, d.count)))
+}
+
+// Value at position x between (x0, v0) and (x1, v1), clamped to that segment.
+func interpolate(v0, v1, x, x0, x1 float64) float64 {
+	if x1 <= x0 || x <= x0 {
+		return v0
+	}
+	if x >= x1 {
+		return v1
+	}
+	return v0 + (v1-v0)*(x-x0)/(x1-x0)
+}
+
+func (d *tdigestEstimator) Merge(other PercentileEstimator) error {
+	o, ok := other.(*tdigestEstimator)
+	if !ok {
+		return fmt.Errorf("can't merge a %T into a t-digest estimator", other)
+	}
+	for _, cs := range [][]centroid{o.centroids, o.buffer} {
+		for _, c := range cs {
+			d.add(c)
+		}
+	}
+	if o.count > 0 {
+		d.min, d.max = math.Min(d.min, o.min), math.Max(d.max, o.max)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// WeightedChoice picks among named options with probabilities proportional to their weights.
+type WeightedChoice struct {
+	names      []string
+	cumulative []float64
+}
+
+// Create a weighted choice among the given names, weights being indexed like the names.
+func NewWeightedChoice(names []string, weights []float64) *WeightedChoice {
+	w := &WeightedChoice{names: names}
+	total := 0.0
+	for _, weight := range weights {
+		total += weight
+		w.cumulative = append(w.cumulative, total)
+	}
+	return w
+}
+
+// Create a choice where the k-th name (from 1) has a weight of 1/k^exponent, so the first names are picked most.
+func NewZipfChoice(names []string, exponent float64) *WeightedChoice {
+	weights := make([]float64, len(names))
+	for i := range names {
+		weights[i] = 1 / math.Pow(float64(i+1), exponent)
+	}
+	return NewWeightedChoice(names, weights)
+}
+
+// Parse a weighted choice from a spec like "list=9,create=1".
+func ParseWeightedChoice(spec string) (*WeightedChoice, error) {
+	var names []string
+	var weights []float64
+	total := 0
+	for _, entry := range strings.Split(spec, ",") {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid entry '%v', expected <name>=<weight>", entry)
+		}
+		weight, err := strconv.Atoi(parts[1])
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid weight in entry '%v'", entry)
+		}
+		total += weight
+		names = append(names, parts[0])
+		weights = append(weights, float64(weight))
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("at least one weight must be positive")
+	}
+	return NewWeightedChoice(names, weights), nil
+}
+
+// Names of all the options, in the order they were specified.
+func (w *WeightedChoice) Names() []string {
+	return w.names
+}
+
+func (w *WeightedChoice) Pick(r *ThreadSafeRand) string {
+	n := r.Float64() * w.cumulative[len(w.cumulative)-1]
+	for i, c := range w.cumulative {
+		if n < c {
+			return w.names[i]
+		}
+	}
+	return w.names[len(w.names)-1]
+}
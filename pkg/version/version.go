@@ -0,0 +1,74 @@
+// Copyright © 2022 Shyam Jeedigunta <shyam123.jvs95@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Set with -ldflags "-X github.com/rcrozean/kube-stress/pkg/version.version=..." and so on, taking precedence
+// over the build info recorded by the go toolchain.
+var (
+	version   string
+	gitCommit string
+	buildDate string
+)
+
+// Info describes the build of the running kube-stress binary.
+type Info struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"git_commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get the build metadata recorded in the binary by the go toolchain.
+func Get() Info {
+	info := Info{
+		Version:   "unknown",
+		GitCommit: "unknown",
+		BuildDate: "unknown",
+		GoVersion: runtime.Version(),
+	}
+	if buildInfo, ok := debug.ReadBuildInfo(); ok {
+		if buildInfo.Main.Version != "" {
+			info.Version = buildInfo.Main.Version
+		}
+		for _, setting := range buildInfo.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				info.GitCommit = setting.Value
+			case "vcs.time":
+				info.BuildDate = setting.Value
+			}
+		}
+	}
+	if version != "" {
+		info.Version = version
+	}
+	if gitCommit != "" {
+		info.GitCommit = gitCommit
+	}
+	if buildDate != "" {
+		info.BuildDate = buildDate
+	}
+	return info
+}
+
+func (i Info) String() string {
+	return fmt.Sprintf("version %v, git commit %v, built %v with %v", i.Version, i.GitCommit, i.BuildDate, i.GoVersion)
+}